@@ -3,13 +3,24 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
+	_ "time/tzdata" // horarios de geocercas; la imagen alpine no trae zoneinfo
 
 	"github.com/AlexG695/geo-engine-core/config"
 	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/AlexG695/geo-engine-core/internal/gt06"
 	"github.com/AlexG695/geo-engine-core/internal/handlers"
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
 	"github.com/AlexG695/geo-engine-core/internal/middleware"
+	"github.com/AlexG695/geo-engine-core/internal/mqtt"
 	"github.com/AlexG695/geo-engine-core/internal/platform/logger"
+	"github.com/AlexG695/geo-engine-core/internal/udp"
 	"github.com/AlexG695/geo-engine-core/internal/ws"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -63,8 +74,8 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{cfg.AllowedOrigins},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Geo-Key", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-Request-ID"},
-		ExposeHeaders:    []string{"Content-Length", "X-Geo-Key", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-Request-ID"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Geo-Key", "X-Geo-Actor", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-Request-ID"},
+		ExposeHeaders:    []string{"Content-Length", "X-Total-Count", "X-Geo-Key", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-Request-ID"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -74,15 +85,145 @@ func main() {
 	r.Use(middleware.RateLimit(redisClient, "100-M"))
 	r.Use(middleware.APIKeyAuth(cfg.APISecret))
 
-	locationHandler := handlers.NewLocationHandler(queries, redisClient, sugar, wsHub)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ingestService := ingest.NewService(queries, ingest.SQLTx(conn), ingest.NewRedisCache(redisClient), wsHub, sugar, ingest.Options{
+		MaxClockSkew:        cfg.FixMaxClockSkew,
+		MaxFixAge:           cfg.FixMaxAge,
+		GeofenceWorkers:     cfg.GeofenceWorkers,
+		GeofenceQueueSize:   cfg.GeofenceQueueSize,
+		MaxGeofenceAccuracy: cfg.GeofenceMaxAccuracy,
+		SpeedLimitKmh:       cfg.SpeedLimitKmh,
+		SpeedToleranceKmh:   cfg.SpeedToleranceKmh,
+		SpeedMinDuration:    cfg.SpeedMinDuration,
+		DriverFreshness:     cfg.DriverFreshness,
+	})
+
+	// listeners sigue a los transportes que alimentan a ingestService; hay
+	// que esperarlos antes de drenar el pool de geocercas.
+	var listeners sync.WaitGroup
+
+	locationHandler := handlers.NewLocationHandler(queries, ingest.SQLTx(conn), redisClient, sugar, wsHub, ingestService, handlers.GeometryLimits{
+		MaxVertices: cfg.GeofenceMaxVertices,
+		MaxAreaKm2:  cfg.GeofenceMaxAreaKm2,
+	})
 	locationHandler.RegisterRoutes(r)
 
+	var bridge *mqtt.Bridge
+	if cfg.MQTTBrokerURL != "" {
+		bridge, err = mqtt.NewBridge(mqtt.Options{
+			BrokerURL:     cfg.MQTTBrokerURL,
+			ClientID:      cfg.MQTTClientID,
+			Username:      cfg.MQTTUsername,
+			Password:      cfg.MQTTPassword,
+			LocationTopic: cfg.MQTTLocationTopic,
+			EventTopic:    cfg.MQTTEventTopic,
+		}, ingestService, sugar)
+		if err != nil {
+			sugar.Fatal("Configuración MQTT inválida:", err)
+		}
+		ingestService.AddGeofenceListener(bridge)
+		if err := bridge.Start(); err != nil {
+			sugar.Error("No se pudo conectar a MQTT:", err)
+		}
+	}
+
+	if cfg.UDPAddr != "" {
+		// Token con el que el tracker firma sus datagramas; se pide al darlo
+		// de alta, protegido por la API key como el resto de la API.
+		r.GET("/drivers/:id/udp-token", func(c *gin.Context) {
+			id := c.Param("id")
+			c.JSON(200, gin.H{"device_id": id, "token": udp.DeviceToken(cfg.APISecret, id)})
+		})
+
+		udpServer := udp.NewServer(cfg.UDPAddr, cfg.APISecret, ingestService, sugar)
+		listeners.Add(1)
+		go func() {
+			defer listeners.Done()
+			if err := udpServer.ListenAndServe(ctx); err != nil {
+				sugar.Error("Listener UDP detenido:", err)
+			}
+		}()
+	}
+
+	if cfg.GT06Addr != "" {
+		gt06Server := gt06.NewServer(cfg.GT06Addr, ingestService, queries, cfg.GT06AllowUnknownIMEI, sugar)
+		listeners.Add(1)
+		go func() {
+			defer listeners.Done()
+			if err := gt06Server.ListenAndServe(ctx); err != nil {
+				sugar.Error("Gateway GT06 detenido:", err)
+			}
+		}()
+	}
+
+	if cfg.GeofenceScheduleInterval > 0 {
+		listeners.Add(1)
+		go func() {
+			defer listeners.Done()
+			ingestService.RunScheduler(ctx, cfg.GeofenceScheduleInterval)
+		}()
+	}
+
+	if cfg.DriverSweepInterval > 0 {
+		listeners.Add(1)
+		go func() {
+			defer listeners.Done()
+			ingestService.RunStaleSweeper(ctx, cfg.DriverSweepInterval)
+		}()
+	}
+
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "online", "version": "1.0.0"})
 	})
 
+	r.GET("/metrics/geofences", func(c *gin.Context) {
+		c.JSON(200, ingestService.GeofenceStats())
+	})
+
 	r.GET("/ws", locationHandler.ServeWS)
 
-	sugar.Info("Geo-Engine iniciando en puerto 8080")
-	r.Run(":8080")
+	srv := &http.Server{
+		Addr:    ":8080",
+		Handler: r,
+	}
+
+	go func() {
+		sugar.Info("Geo-Engine iniciando en puerto 8080")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			sugar.Fatal("Servidor HTTP detenido:", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	sugar.Info("Apagando Geo-Engine...")
+
+	// Primero se cortan las entradas, después se drenan las colas.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		sugar.Warn("Apagado HTTP incompleto:", err)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		listeners.Wait()
+		ingestService.Close()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		sugar.Infow("Colas de geocercas drenadas", "stats", ingestService.GeofenceStats())
+	case <-shutdownCtx.Done():
+		sugar.Warnw("Tiempo de apagado agotado con geocercas pendientes", "stats", ingestService.GeofenceStats())
+	}
+
+	// El bridge se cierra al final para publicar los eventos del drenado.
+	if bridge != nil {
+		bridge.Stop()
+	}
 }
@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/caarlos0/env/v10"
 	"github.com/joho/godotenv"
@@ -12,6 +13,24 @@ type Config struct {
 
 	Port string `env:"PORT" envDefault:"8080"`
 
+	UDPAddr string `env:"UDP_ADDR" envDefault:":9000"`
+
+	GT06Addr string `env:"GT06_ADDR" envDefault:":5023"`
+
+	GT06AllowUnknownIMEI bool `env:"GT06_ALLOW_UNKNOWN_IMEI" envDefault:"false"`
+
+	MQTTBrokerURL string `env:"MQTT_BROKER_URL" envDefault:""`
+
+	MQTTClientID string `env:"MQTT_CLIENT_ID" envDefault:"geo-engine"`
+
+	MQTTUsername string `env:"MQTT_USERNAME" envDefault:""`
+
+	MQTTPassword string `env:"MQTT_PASSWORD" envDefault:""`
+
+	MQTTLocationTopic string `env:"MQTT_LOCATION_TOPIC" envDefault:"fleet/+/location"`
+
+	MQTTEventTopic string `env:"MQTT_EVENT_TOPIC" envDefault:"fleet/{device_id}/geofence"`
+
 	APISecret string `env:"API_SECRET,required"`
 
 	RedisAddr string `env:"REDIS_ADDR" envDefault:"redis:6379"`
@@ -21,6 +40,34 @@ type Config struct {
 	EnvMode string `env:"ENV_MODE" envDefault:"development"`
 
 	AllowedOrigins string `env:"ALLOWED_ORIGINS" envDefault:"http://localhost:5173"`
+
+	FixMaxClockSkew time.Duration `env:"FIX_MAX_CLOCK_SKEW" envDefault:"2m"`
+
+	FixMaxAge time.Duration `env:"FIX_MAX_AGE" envDefault:"72h"`
+
+	GeofenceWorkers int `env:"GEOFENCE_WORKERS" envDefault:"8"`
+
+	GeofenceQueueSize int `env:"GEOFENCE_QUEUE_SIZE" envDefault:"1024"`
+
+	GeofenceMaxAccuracy float64 `env:"GEOFENCE_MAX_ACCURACY" envDefault:"100"`
+
+	GeofenceScheduleInterval time.Duration `env:"GEOFENCE_SCHEDULE_INTERVAL" envDefault:"1m"`
+
+	GeofenceMaxVertices int `env:"GEOFENCE_MAX_VERTICES" envDefault:"10000"`
+
+	GeofenceMaxAreaKm2 float64 `env:"GEOFENCE_MAX_AREA_KM2" envDefault:"10000"`
+
+	SpeedLimitKmh float64 `env:"SPEED_LIMIT_KMH" envDefault:"0"`
+
+	SpeedToleranceKmh float64 `env:"SPEED_TOLERANCE_KMH" envDefault:"5"`
+
+	SpeedMinDuration time.Duration `env:"SPEED_MIN_DURATION" envDefault:"10s"`
+
+	DriverFreshness time.Duration `env:"DRIVER_FRESHNESS" envDefault:"5m"`
+
+	DriverSweepInterval time.Duration `env:"DRIVER_SWEEP_INTERVAL" envDefault:"1m"`
+
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"15s"`
 }
 
 func Load() *Config {
@@ -6,36 +6,116 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type DeviceGroup struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type DeviceGroupMember struct {
+	GroupID  uuid.UUID `json:"group_id"`
+	DeviceID string    `json:"device_id"`
+}
+
+type DeviceImei struct {
+	Imei      string    `json:"imei"`
+	DeviceID  string    `json:"device_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type Geofence struct {
-	ID        uuid.UUID   `json:"id"`
-	Name      string      `json:"name"`
-	Area      interface{} `json:"area"`
-	CreatedAt time.Time   `json:"created_at"`
+	ID                 uuid.UUID       `json:"id"`
+	Name               string          `json:"name"`
+	Area               interface{}     `json:"area"`
+	CreatedAt          time.Time       `json:"created_at"`
+	DwellSeconds       sql.NullInt32   `json:"dwell_seconds"`
+	MinFixes           int32           `json:"min_fixes"`
+	MinDurationSeconds int32           `json:"min_duration_seconds"`
+	ExitBufferMeters   float64         `json:"exit_buffer_meters"`
+	Shape              string          `json:"shape"`
+	Center             interface{}     `json:"center"`
+	RadiusMeters       sql.NullFloat64 `json:"radius_meters"`
+	Path               interface{}     `json:"path"`
+	WidthMeters        sql.NullFloat64 `json:"width_meters"`
+	Schedule           json.RawMessage `json:"schedule"`
+	SpeedLimitKmh      sql.NullFloat64 `json:"speed_limit_kmh"`
+	DeletedAt          sql.NullTime    `json:"deleted_at"`
+	UpdatedBy          sql.NullString  `json:"updated_by"`
+	Description        sql.NullString  `json:"description"`
+	Color              sql.NullString  `json:"color"`
+	Category           sql.NullString  `json:"category"`
+	Tags               []string        `json:"tags"`
+	Properties         json.RawMessage `json:"properties"`
 }
 
-type GeofenceEvent struct {
-	ID         uuid.UUID `json:"id"`
+type GeofenceDeviceAssignment struct {
 	GeofenceID uuid.UUID `json:"geofence_id"`
 	DeviceID   string    `json:"device_id"`
-	EventType  string    `json:"event_type"`
-	Timestamp  time.Time `json:"timestamp"`
+}
+
+type GeofenceEvent struct {
+	ID                     uuid.UUID       `json:"id"`
+	GeofenceID             uuid.UUID       `json:"geofence_id"`
+	DeviceID               string          `json:"device_id"`
+	EventType              string          `json:"event_type"`
+	Timestamp              time.Time       `json:"timestamp"`
+	DurationSeconds        sql.NullInt32   `json:"duration_seconds"`
+	Decision               sql.NullString  `json:"decision"`
+	Accuracy               sql.NullFloat64 `json:"accuracy"`
+	BoundaryDistanceMeters sql.NullFloat64 `json:"boundary_distance_meters"`
+	StartSpeedKmh          sql.NullFloat64 `json:"start_speed_kmh"`
+	PeakSpeedKmh           sql.NullFloat64 `json:"peak_speed_kmh"`
+	EndSpeedKmh            sql.NullFloat64 `json:"end_speed_kmh"`
+}
+
+type GeofenceGroupAssignment struct {
+	GeofenceID uuid.UUID `json:"geofence_id"`
+	GroupID    uuid.UUID `json:"group_id"`
+}
+
+type GeofenceVersion struct {
+	GeofenceID         uuid.UUID       `json:"geofence_id"`
+	Version            int32           `json:"version"`
+	Action             string          `json:"action"`
+	ChangedBy          sql.NullString  `json:"changed_by"`
+	ChangedAt          time.Time       `json:"changed_at"`
+	Name               string          `json:"name"`
+	Area               interface{}     `json:"area"`
+	Shape              string          `json:"shape"`
+	Center             interface{}     `json:"center"`
+	RadiusMeters       sql.NullFloat64 `json:"radius_meters"`
+	Path               interface{}     `json:"path"`
+	WidthMeters        sql.NullFloat64 `json:"width_meters"`
+	DwellSeconds       sql.NullInt32   `json:"dwell_seconds"`
+	MinFixes           int32           `json:"min_fixes"`
+	MinDurationSeconds int32           `json:"min_duration_seconds"`
+	ExitBufferMeters   float64         `json:"exit_buffer_meters"`
+	Schedule           json.RawMessage `json:"schedule"`
+	SpeedLimitKmh      sql.NullFloat64 `json:"speed_limit_kmh"`
+	Description        sql.NullString  `json:"description"`
+	Color              sql.NullString  `json:"color"`
+	Category           sql.NullString  `json:"category"`
+	Tags               []string        `json:"tags"`
+	Properties         json.RawMessage `json:"properties"`
 }
 
 type Location struct {
-	ID        uuid.UUID       `json:"id"`
-	DeviceID  string          `json:"device_id"`
-	Latitude  float64         `json:"latitude"`
-	Longitude float64         `json:"longitude"`
-	Geom      interface{}     `json:"geom"`
-	H3Ix      interface{}     `json:"h3_ix"`
-	Accuracy  sql.NullFloat64 `json:"accuracy"`
-	Heading   sql.NullFloat64 `json:"heading"`
-	Speed     sql.NullFloat64 `json:"speed"`
-	IsMock    sql.NullBool    `json:"is_mock"`
-	CreatedAt sql.NullTime    `json:"created_at"`
+	ID         uuid.UUID       `json:"id"`
+	DeviceID   string          `json:"device_id"`
+	Latitude   float64         `json:"latitude"`
+	Longitude  float64         `json:"longitude"`
+	Geom       interface{}     `json:"geom"`
+	H3Ix       interface{}     `json:"h3_ix"`
+	Accuracy   sql.NullFloat64 `json:"accuracy"`
+	Heading    sql.NullFloat64 `json:"heading"`
+	Speed      sql.NullFloat64 `json:"speed"`
+	IsMock     sql.NullBool    `json:"is_mock"`
+	CreatedAt  sql.NullTime    `json:"created_at"`
+	RecordedAt time.Time       `json:"recorded_at"`
 }
@@ -6,25 +6,120 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type Querier interface {
+	// Idempotente; 0 filas solo si el grupo no existe.
+	AddDeviceGroupMember(ctx context.Context, arg AddDeviceGroupMemberParams) (int64, error)
+	// Idempotente; 0 filas solo si la zona no existe.
+	AssignGeofenceToDevice(ctx context.Context, arg AssignGeofenceToDeviceParams) (int64, error)
+	// Idempotente; 0 filas si la zona o el grupo no existen.
+	AssignGeofenceToGroup(ctx context.Context, arg AssignGeofenceToGroupParams) (int64, error)
+	// Vértices y área del buffer que se guardaría para un círculo, para aplicarle
+	// los mismos límites que a un polígono.
+	CheckCircleGeometry(ctx context.Context, arg CheckCircleGeometryParams) (CheckCircleGeometryRow, error)
+	// Revisa la línea central de un corredor (que no se cruce consigo misma) y
+	// devuelve vértices y área del buffer que se guardaría.
+	CheckCorridorGeometry(ctx context.Context, arg CheckCorridorGeometryParams) (CheckCorridorGeometryRow, error)
+	// Revisa un Polygon/MultiPolygon antes de guardarlo: validez, motivo y punto
+	// del problema (ST_IsValidDetail), y vértices y área de lo que se guardaría.
+	// Con repair, una geometría inválida pasa por ST_MakeValid y se conservan
+	// solo sus partes poligonales.
+	CheckGeofenceGeometry(ctx context.Context, arg CheckGeofenceGeometryParams) (CheckGeofenceGeometryRow, error)
+	// Total de zonas con los mismos filtros que GetGeofences, para paginar.
+	CountGeofences(ctx context.Context, arg CountGeofencesParams) (int32, error)
+	CreateCircleGeofence(ctx context.Context, arg CreateCircleGeofenceParams) (CreateCircleGeofenceRow, error)
+	// geojson es la línea central (LineString); width_meters es el ancho total.
+	CreateCorridorGeofence(ctx context.Context, arg CreateCorridorGeofenceParams) (CreateCorridorGeofenceRow, error)
+	// Sin fila si ya existe un grupo con ese nombre.
+	CreateDeviceGroup(ctx context.Context, name string) (DeviceGroup, error)
+	// updated_by (como en el resto de las escrituras) es quién hizo el cambio y
+	// queda en la versión que registra el trigger.
 	CreateGeofence(ctx context.Context, arg CreateGeofenceParams) (CreateGeofenceRow, error)
 	// Guarda una nueva ubicación y devuelve el ID insertado.
 	CreateLocation(ctx context.Context, arg CreateLocationParams) (uuid.UUID, error)
-	DeleteGeofence(ctx context.Context, id uuid.UUID) error
+	// No borra grupos asignados a geocercas: esas zonas quedarían aplicando a
+	// todos los dispositivos.
+	DeleteDeviceGroup(ctx context.Context, id uuid.UUID) (int64, error)
+	DeleteDeviceIMEI(ctx context.Context, imei string) (int64, error)
+	// Borrado lógico: la zona deja de evaluarse pero sus eventos y versiones se
+	// conservan y se puede restaurar.
+	DeleteGeofence(ctx context.Context, arg DeleteGeofenceParams) (int64, error)
+	// Zonas que contienen el punto más las de $3 (donde estaba el dispositivo),
+	// para poder confirmar salidas aunque ya esté lejos. La distancia al borde
+	// permite comparar contra la precisión del fix. Círculos y corredores se
+	// evalúan en geography con sus parámetros; area solo prefiltra. Las zonas
+	// fuera de horario en $4 (hora del fix) solo vuelven por $3, marcadas con
+	// off_schedule, para poder cerrar la visita. Solo cuentan las zonas
+	// asignadas al dispositivo $5; las que dejaron de estarlo (o se borraron) se
+	// descartan. speed_limit_kmh 0 indica que se usa el límite
+	// global. tags viaja en los eventos para que los consumidores los enruten.
 	FindGeofencesContainingPoint(ctx context.Context, arg FindGeofencesContainingPointParams) ([]FindGeofencesContainingPointRow, error)
+	GetDeviceGroup(ctx context.Context, id uuid.UUID) (DeviceGroup, error)
+	GetDeviceIDByIMEI(ctx context.Context, imei string) (string, error)
 	GetDriverRoute(ctx context.Context, deviceID string) (string, error)
-	GetGeofences(ctx context.Context) ([]GetGeofencesRow, error)
+	// Último fix de cada dispositivo activo desde since que cae dentro del área
+	// (Polygon o MultiPolygon GeoJSON), con su distancia al centro del
+	// rectángulo que la contiene, opcionalmente solo entre device_ids.
+	GetDriversWithin(ctx context.Context, arg GetDriversWithinParams) ([]GetDriversWithinRow, error)
+	GetGeofenceName(ctx context.Context, id uuid.UUID) (string, error)
+	// Cadena vacía si la zona no tiene horario.
+	GetGeofenceSchedule(ctx context.Context, id uuid.UUID) (string, error)
+	// geojson es siempre el polígono (circunscrito en círculos y corredores);
+	// los parámetros originales de cada forma vienen aparte.
+	// Los filtros NULL no se aplican: tags exige todas las etiquetas, search
+	// busca en el nombre (con los comodines ya escapados) y el bbox se cruza con
+	// el área. page_limit NULL devuelve todas.
+	GetGeofences(ctx context.Context, arg GetGeofencesParams) ([]GetGeofencesRow, error)
 	// Obtiene la última ubicación conocida de un dispositivo.
 	GetLatestLocationByDevice(ctx context.Context, deviceID string) (Location, error)
-	// Busca conductores dentro de un radio (en metros) usando PostGIS.
-	// ST_DWithin usa índices espaciales, así que es ULTRA rápido.
+	// Último fix de cada dispositivo activo desde since que cae dentro del radio
+	// (en metros), con su distancia al centro, opcionalmente solo entre
+	// device_ids. Ordena por distancia o, con by_last_seen, del más reciente al
+	// más viejo.
 	GetNearbyDrivers(ctx context.Context, arg GetNearbyDriversParams) ([]GetNearbyDriversRow, error)
+	// Los max_results dispositivos más cercanos (KNN sobre el último fix de cada
+	// uno), opcionalmente solo entre device_ids y dentro de max_distance metros.
+	GetNearestDrivers(ctx context.Context, arg GetNearestDriversParams) ([]GetNearestDriversRow, error)
+	ListDeviceGroupMembers(ctx context.Context, groupID uuid.UUID) ([]string, error)
+	ListDeviceGroups(ctx context.Context) ([]ListDeviceGroupsRow, error)
+	ListDeviceIMEIs(ctx context.Context, deviceID sql.NullString) ([]DeviceImei, error)
+	ListGeofenceDeviceAssignments(ctx context.Context, geofenceID uuid.UUID) ([]string, error)
+	ListGeofenceGroupAssignments(ctx context.Context, geofenceID uuid.UUID) ([]ListGeofenceGroupAssignmentsRow, error)
+	// Historial de la zona, de la más nueva a la más vieja, con la geometría
+	// anterior a cada cambio (vacía en el alta).
+	ListGeofenceVersions(ctx context.Context, geofenceID uuid.UUID) ([]ListGeofenceVersionsRow, error)
+	// Zonas con horario, si están activas en at y su bbox para buscar a los
+	// dispositivos que quedan adentro.
+	ListScheduledGeofences(ctx context.Context, at time.Time) ([]ListScheduledGeofencesRow, error)
 	LogGeofenceEvent(ctx context.Context, arg LogGeofenceEventParams) error
+	RemoveDeviceGroupMember(ctx context.Context, arg RemoveDeviceGroupMemberParams) (int64, error)
+	// Sin fila si el grupo no existe o el nombre ya lo usa otro.
+	RenameDeviceGroup(ctx context.Context, arg RenameDeviceGroupParams) (DeviceGroup, error)
+	// Vuelve la zona (aunque esté borrada) al estado de una versión; el trigger
+	// la registra como una versión nueva.
+	RestoreGeofenceVersion(ctx context.Context, arg RestoreGeofenceVersionParams) (RestoreGeofenceVersionRow, error)
+	// schedule NULL quita el horario (la zona queda siempre activa).
+	SetGeofenceSchedule(ctx context.Context, arg SetGeofenceScheduleParams) (int64, error)
+	// geofence_active_at usa AT TIME ZONE: un nombre que Postgres no conoce
+	// rompería cada consulta que evalúe la zona.
+	TimezoneExists(ctx context.Context, name string) (bool, error)
+	UnassignGeofenceFromDevice(ctx context.Context, arg UnassignGeofenceFromDeviceParams) (int64, error)
+	UnassignGeofenceFromGroup(ctx context.Context, arg UnassignGeofenceFromGroupParams) (int64, error)
+	// shape NULL conserva la geometría actual; si no, la reemplaza con geojson
+	// (polygon/corridor), lng/lat/radius_meters (circle) o width_meters
+	// (corridor). dwell_seconds NULL conserva el umbral actual; 0 lo desactiva.
+	// Los parámetros de histéresis NULL también conservan el valor actual.
+	// speed_limit_kmh sigue la regla de dwell_seconds: 0 vuelve al límite global.
+	// Los metadatos NULL también se conservan; description, color y category
+	// vacíos los borran.
 	UpdateGeofence(ctx context.Context, arg UpdateGeofenceParams) (UpdateGeofenceRow, error)
+	// Reasigna el IMEI si ya estaba registrado; created_at conserva el alta.
+	UpsertDeviceIMEI(ctx context.Context, arg UpsertDeviceIMEIParams) (DeviceImei, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -8,19 +8,391 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const addDeviceGroupMember = `-- name: AddDeviceGroupMember :execrows
+INSERT INTO device_group_members (group_id, device_id)
+SELECT id, $1::text FROM device_groups WHERE id = $2
+ON CONFLICT (group_id, device_id) DO UPDATE SET device_id = EXCLUDED.device_id
+`
+
+type AddDeviceGroupMemberParams struct {
+	DeviceID string    `json:"device_id"`
+	GroupID  uuid.UUID `json:"group_id"`
+}
+
+// Idempotente; 0 filas solo si el grupo no existe.
+func (q *Queries) AddDeviceGroupMember(ctx context.Context, arg AddDeviceGroupMemberParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, addDeviceGroupMember, arg.DeviceID, arg.GroupID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const assignGeofenceToDevice = `-- name: AssignGeofenceToDevice :execrows
+INSERT INTO geofence_device_assignments (geofence_id, device_id)
+SELECT id, $1::text FROM geofences WHERE id = $2 AND deleted_at IS NULL
+ON CONFLICT (geofence_id, device_id) DO UPDATE SET device_id = EXCLUDED.device_id
+`
+
+type AssignGeofenceToDeviceParams struct {
+	DeviceID   string    `json:"device_id"`
+	GeofenceID uuid.UUID `json:"geofence_id"`
+}
+
+// Idempotente; 0 filas solo si la zona no existe.
+func (q *Queries) AssignGeofenceToDevice(ctx context.Context, arg AssignGeofenceToDeviceParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, assignGeofenceToDevice, arg.DeviceID, arg.GeofenceID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const assignGeofenceToGroup = `-- name: AssignGeofenceToGroup :execrows
+INSERT INTO geofence_group_assignments (geofence_id, group_id)
+SELECT z.id, g.id
+FROM geofences z, device_groups g
+WHERE z.id = $1 AND z.deleted_at IS NULL AND g.id = $2
+ON CONFLICT (geofence_id, group_id) DO UPDATE SET group_id = EXCLUDED.group_id
+`
+
+type AssignGeofenceToGroupParams struct {
+	GeofenceID uuid.UUID `json:"geofence_id"`
+	GroupID    uuid.UUID `json:"group_id"`
+}
+
+// Idempotente; 0 filas si la zona o el grupo no existen.
+func (q *Queries) AssignGeofenceToGroup(ctx context.Context, arg AssignGeofenceToGroupParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, assignGeofenceToGroup, arg.GeofenceID, arg.GroupID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const checkCircleGeometry = `-- name: CheckCircleGeometry :one
+SELECT ST_NPoints(area)::int AS vertices,
+       COALESCE(ST_Area(area::geography), 0)::float8 AS area_sq_meters
+FROM (SELECT geofence_buffer(ST_SetSRID(ST_MakePoint($1::float8, $2::float8), 4326)::geography,
+                             $3::float8) AS area) b
+`
+
+type CheckCircleGeometryParams struct {
+	Lng          float64 `json:"lng"`
+	Lat          float64 `json:"lat"`
+	RadiusMeters float64 `json:"radius_meters"`
+}
+
+type CheckCircleGeometryRow struct {
+	Vertices     int32   `json:"vertices"`
+	AreaSqMeters float64 `json:"area_sq_meters"`
+}
+
+// Vértices y área del buffer que se guardaría para un círculo, para aplicarle
+// los mismos límites que a un polígono.
+func (q *Queries) CheckCircleGeometry(ctx context.Context, arg CheckCircleGeometryParams) (CheckCircleGeometryRow, error) {
+	row := q.db.QueryRowContext(ctx, checkCircleGeometry, arg.Lng, arg.Lat, arg.RadiusMeters)
+	var i CheckCircleGeometryRow
+	err := row.Scan(&i.Vertices, &i.AreaSqMeters)
+	return i, err
+}
+
+const checkCorridorGeometry = `-- name: CheckCorridorGeometry :one
+WITH input AS (
+    SELECT ST_GeomFromGeoJSON($1::text) AS path
+)
+SELECT ST_IsSimple(path)::bool AS simple,
+       ST_NPoints(area)::int AS vertices,
+       COALESCE(ST_Area(area::geography), 0)::float8 AS area_sq_meters
+FROM (SELECT path, geofence_buffer(path::geography, $2::float8 / 2) AS area FROM input) b
+`
+
+type CheckCorridorGeometryParams struct {
+	Geojson     string  `json:"geojson"`
+	WidthMeters float64 `json:"width_meters"`
+}
+
+type CheckCorridorGeometryRow struct {
+	Simple       bool    `json:"simple"`
+	Vertices     int32   `json:"vertices"`
+	AreaSqMeters float64 `json:"area_sq_meters"`
+}
+
+// Revisa la línea central de un corredor (que no se cruce consigo misma) y
+// devuelve vértices y área del buffer que se guardaría.
+func (q *Queries) CheckCorridorGeometry(ctx context.Context, arg CheckCorridorGeometryParams) (CheckCorridorGeometryRow, error) {
+	row := q.db.QueryRowContext(ctx, checkCorridorGeometry, arg.Geojson, arg.WidthMeters)
+	var i CheckCorridorGeometryRow
+	err := row.Scan(&i.Simple, &i.Vertices, &i.AreaSqMeters)
+	return i, err
+}
+
+const checkGeofenceGeometry = `-- name: CheckGeofenceGeometry :one
+WITH input AS (
+    SELECT ST_GeomFromGeoJSON($1::text) AS geom
+), detail AS (
+    SELECT geom, ST_IsValidDetail(geom) AS d FROM input
+), checked AS (
+    SELECT d,
+           CASE WHEN $2::bool AND NOT (d).valid
+                    THEN ST_CollectionExtract(ST_MakeValid(geom), 3)
+                ELSE geom
+               END AS geom
+    FROM detail
+)
+SELECT (d).valid::bool AS valid,
+       COALESCE((d).reason, '')::text AS reason,
+       ((d).location IS NOT NULL)::bool AS has_location,
+       COALESCE(ST_Y((d).location), 0)::float8 AS location_latitude,
+       COALESCE(ST_X((d).location), 0)::float8 AS location_longitude,
+       (NOT (d).valid AND $2::bool AND ST_IsValid(geom) AND NOT ST_IsEmpty(geom))::bool AS repaired,
+       ST_AsGeoJSON(geom)::text AS geojson,
+       ST_NPoints(geom)::int AS vertices,
+       COALESCE(ST_Area(geom::geography), 0)::float8 AS area_sq_meters
+FROM checked
+`
+
+type CheckGeofenceGeometryParams struct {
+	Geojson string `json:"geojson"`
+	Repair  bool   `json:"repair"`
+}
+
+type CheckGeofenceGeometryRow struct {
+	Valid             bool    `json:"valid"`
+	Reason            string  `json:"reason"`
+	HasLocation       bool    `json:"has_location"`
+	LocationLatitude  float64 `json:"location_latitude"`
+	LocationLongitude float64 `json:"location_longitude"`
+	Repaired          bool    `json:"repaired"`
+	Geojson           string  `json:"geojson"`
+	Vertices          int32   `json:"vertices"`
+	AreaSqMeters      float64 `json:"area_sq_meters"`
+}
+
+// Revisa un Polygon/MultiPolygon antes de guardarlo: validez, motivo y punto
+// del problema (ST_IsValidDetail), y vértices y área de lo que se guardaría.
+// Con repair, una geometría inválida pasa por ST_MakeValid y se conservan
+// solo sus partes poligonales.
+func (q *Queries) CheckGeofenceGeometry(ctx context.Context, arg CheckGeofenceGeometryParams) (CheckGeofenceGeometryRow, error) {
+	row := q.db.QueryRowContext(ctx, checkGeofenceGeometry, arg.Geojson, arg.Repair)
+	var i CheckGeofenceGeometryRow
+	err := row.Scan(
+		&i.Valid,
+		&i.Reason,
+		&i.HasLocation,
+		&i.LocationLatitude,
+		&i.LocationLongitude,
+		&i.Repaired,
+		&i.Geojson,
+		&i.Vertices,
+		&i.AreaSqMeters,
+	)
+	return i, err
+}
+
+const countGeofences = `-- name: CountGeofences :one
+SELECT count(*)::int
+FROM geofences
+WHERE deleted_at IS NULL
+  AND ($1::text[] IS NULL OR tags @> $1::text[])
+  AND ($2::text IS NULL OR category = $2::text)
+  AND ($3::text IS NULL OR name ILIKE '%' || $3::text || '%')
+  AND ($4::float8 IS NULL
+       OR ST_Intersects(area, ST_MakeEnvelope($4::float8, $5::float8,
+                                              $6::float8, $7::float8, 4326)))
+`
+
+type CountGeofencesParams struct {
+	Tags     []string        `json:"tags"`
+	Category sql.NullString  `json:"category"`
+	Search   sql.NullString  `json:"search"`
+	MinLng   sql.NullFloat64 `json:"min_lng"`
+	MinLat   sql.NullFloat64 `json:"min_lat"`
+	MaxLng   sql.NullFloat64 `json:"max_lng"`
+	MaxLat   sql.NullFloat64 `json:"max_lat"`
+}
+
+// Total de zonas con los mismos filtros que GetGeofences, para paginar.
+func (q *Queries) CountGeofences(ctx context.Context, arg CountGeofencesParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, countGeofences,
+		pq.Array(arg.Tags),
+		arg.Category,
+		arg.Search,
+		arg.MinLng,
+		arg.MinLat,
+		arg.MaxLng,
+		arg.MaxLat,
+	)
+	var count int32
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createCircleGeofence = `-- name: CreateCircleGeofence :one
+INSERT INTO geofences (
+    name, shape, center, radius_meters, area, dwell_seconds, min_fixes, min_duration_seconds, exit_buffer_meters,
+    speed_limit_kmh, updated_by, description, color, category, tags, properties
+) VALUES (
+             $1, 'circle',
+             ST_SetSRID(ST_MakePoint($2::float8, $3::float8), 4326)::geography,
+             $4::float8,
+             geofence_buffer(ST_SetSRID(ST_MakePoint($2::float8, $3::float8), 4326)::geography, $4::float8),
+             $5, $6, $7, $8,
+             $9, $10,
+             $11, $12, $13, $14::text[], $15::jsonb
+         )
+    RETURNING id, name
+`
+
+type CreateCircleGeofenceParams struct {
+	Name               string          `json:"name"`
+	Lng                float64         `json:"lng"`
+	Lat                float64         `json:"lat"`
+	RadiusMeters       float64         `json:"radius_meters"`
+	DwellSeconds       sql.NullInt32   `json:"dwell_seconds"`
+	MinFixes           int32           `json:"min_fixes"`
+	MinDurationSeconds int32           `json:"min_duration_seconds"`
+	ExitBufferMeters   float64         `json:"exit_buffer_meters"`
+	SpeedLimitKmh      sql.NullFloat64 `json:"speed_limit_kmh"`
+	UpdatedBy          sql.NullString  `json:"updated_by"`
+	Description        sql.NullString  `json:"description"`
+	Color              sql.NullString  `json:"color"`
+	Category           sql.NullString  `json:"category"`
+	Tags               []string        `json:"tags"`
+	Properties         json.RawMessage `json:"properties"`
+}
+
+type CreateCircleGeofenceRow struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+func (q *Queries) CreateCircleGeofence(ctx context.Context, arg CreateCircleGeofenceParams) (CreateCircleGeofenceRow, error) {
+	row := q.db.QueryRowContext(ctx, createCircleGeofence,
+		arg.Name,
+		arg.Lng,
+		arg.Lat,
+		arg.RadiusMeters,
+		arg.DwellSeconds,
+		arg.MinFixes,
+		arg.MinDurationSeconds,
+		arg.ExitBufferMeters,
+		arg.SpeedLimitKmh,
+		arg.UpdatedBy,
+		arg.Description,
+		arg.Color,
+		arg.Category,
+		pq.Array(arg.Tags),
+		arg.Properties,
+	)
+	var i CreateCircleGeofenceRow
+	err := row.Scan(&i.ID, &i.Name)
+	return i, err
+}
+
+const createCorridorGeofence = `-- name: CreateCorridorGeofence :one
+INSERT INTO geofences (
+    name, shape, path, width_meters, area, dwell_seconds, min_fixes, min_duration_seconds, exit_buffer_meters,
+    speed_limit_kmh, updated_by, description, color, category, tags, properties
+) VALUES (
+             $1, 'corridor',
+             ST_GeomFromGeoJSON($2::text)::geography,
+             $3::float8,
+             geofence_buffer(ST_GeomFromGeoJSON($2::text)::geography, $3::float8 / 2),
+             $4, $5, $6, $7,
+             $8, $9,
+             $10, $11, $12, $13::text[], $14::jsonb
+         )
+    RETURNING id, name
+`
+
+type CreateCorridorGeofenceParams struct {
+	Name               string          `json:"name"`
+	Geojson            string          `json:"geojson"`
+	WidthMeters        float64         `json:"width_meters"`
+	DwellSeconds       sql.NullInt32   `json:"dwell_seconds"`
+	MinFixes           int32           `json:"min_fixes"`
+	MinDurationSeconds int32           `json:"min_duration_seconds"`
+	ExitBufferMeters   float64         `json:"exit_buffer_meters"`
+	SpeedLimitKmh      sql.NullFloat64 `json:"speed_limit_kmh"`
+	UpdatedBy          sql.NullString  `json:"updated_by"`
+	Description        sql.NullString  `json:"description"`
+	Color              sql.NullString  `json:"color"`
+	Category           sql.NullString  `json:"category"`
+	Tags               []string        `json:"tags"`
+	Properties         json.RawMessage `json:"properties"`
+}
+
+type CreateCorridorGeofenceRow struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// geojson es la línea central (LineString); width_meters es el ancho total.
+func (q *Queries) CreateCorridorGeofence(ctx context.Context, arg CreateCorridorGeofenceParams) (CreateCorridorGeofenceRow, error) {
+	row := q.db.QueryRowContext(ctx, createCorridorGeofence,
+		arg.Name,
+		arg.Geojson,
+		arg.WidthMeters,
+		arg.DwellSeconds,
+		arg.MinFixes,
+		arg.MinDurationSeconds,
+		arg.ExitBufferMeters,
+		arg.SpeedLimitKmh,
+		arg.UpdatedBy,
+		arg.Description,
+		arg.Color,
+		arg.Category,
+		pq.Array(arg.Tags),
+		arg.Properties,
+	)
+	var i CreateCorridorGeofenceRow
+	err := row.Scan(&i.ID, &i.Name)
+	return i, err
+}
+
+const createDeviceGroup = `-- name: CreateDeviceGroup :one
+INSERT INTO device_groups (name) VALUES ($1)
+ON CONFLICT (name) DO NOTHING
+RETURNING id, name, created_at
+`
+
+// Sin fila si ya existe un grupo con ese nombre.
+func (q *Queries) CreateDeviceGroup(ctx context.Context, name string) (DeviceGroup, error) {
+	row := q.db.QueryRowContext(ctx, createDeviceGroup, name)
+	var i DeviceGroup
+	err := row.Scan(&i.ID, &i.Name, &i.CreatedAt)
+	return i, err
+}
+
 const createGeofence = `-- name: CreateGeofence :one
-INSERT INTO geofences (name, area)
-VALUES ($1, ST_GeomFromGeoJSON($2)) -- <-- Recibe un string GeoJSON
+INSERT INTO geofences (name, area, dwell_seconds, min_fixes, min_duration_seconds, exit_buffer_meters, speed_limit_kmh, updated_by,
+                       description, color, category, tags, properties)
+VALUES ($1, ST_GeomFromGeoJSON($2), $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) -- <-- Recibe un string GeoJSON
     RETURNING id, name
 `
 
 type CreateGeofenceParams struct {
-	Name              string      `json:"name"`
-	StGeomfromgeojson interface{} `json:"st_geomfromgeojson"`
+	Name               string          `json:"name"`
+	StGeomfromgeojson  interface{}     `json:"st_geomfromgeojson"`
+	DwellSeconds       sql.NullInt32   `json:"dwell_seconds"`
+	MinFixes           int32           `json:"min_fixes"`
+	MinDurationSeconds int32           `json:"min_duration_seconds"`
+	ExitBufferMeters   float64         `json:"exit_buffer_meters"`
+	SpeedLimitKmh      sql.NullFloat64 `json:"speed_limit_kmh"`
+	UpdatedBy          sql.NullString  `json:"updated_by"`
+	Description        sql.NullString  `json:"description"`
+	Color              sql.NullString  `json:"color"`
+	Category           sql.NullString  `json:"category"`
+	Tags               []string        `json:"tags"`
+	Properties         json.RawMessage `json:"properties"`
 }
 
 type CreateGeofenceRow struct {
@@ -28,8 +400,24 @@ type CreateGeofenceRow struct {
 	Name string    `json:"name"`
 }
 
+// updated_by (como en el resto de las escrituras) es quién hizo el cambio y
+// queda en la versión que registra el trigger.
 func (q *Queries) CreateGeofence(ctx context.Context, arg CreateGeofenceParams) (CreateGeofenceRow, error) {
-	row := q.db.QueryRowContext(ctx, createGeofence, arg.Name, arg.StGeomfromgeojson)
+	row := q.db.QueryRowContext(ctx, createGeofence,
+		arg.Name,
+		arg.StGeomfromgeojson,
+		arg.DwellSeconds,
+		arg.MinFixes,
+		arg.MinDurationSeconds,
+		arg.ExitBufferMeters,
+		arg.SpeedLimitKmh,
+		arg.UpdatedBy,
+		arg.Description,
+		arg.Color,
+		arg.Category,
+		pq.Array(arg.Tags),
+		arg.Properties,
+	)
 	var i CreateGeofenceRow
 	err := row.Scan(&i.ID, &i.Name)
 	return i, err
@@ -37,23 +425,24 @@ func (q *Queries) CreateGeofence(ctx context.Context, arg CreateGeofenceParams)
 
 const createLocation = `-- name: CreateLocation :one
 INSERT INTO locations (
-    id, device_id, latitude, longitude, accuracy, heading, speed, is_mock, created_at
+    id, device_id, latitude, longitude, accuracy, heading, speed, is_mock, created_at, recorded_at
 ) VALUES (
-             $1, $2, $3, $4, $5, $6, $7, $8, $9
+             $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
          )
     RETURNING id
 `
 
 type CreateLocationParams struct {
-	ID        uuid.UUID       `json:"id"`
-	DeviceID  string          `json:"device_id"`
-	Latitude  float64         `json:"latitude"`
-	Longitude float64         `json:"longitude"`
-	Accuracy  sql.NullFloat64 `json:"accuracy"`
-	Heading   sql.NullFloat64 `json:"heading"`
-	Speed     sql.NullFloat64 `json:"speed"`
-	IsMock    sql.NullBool    `json:"is_mock"`
-	CreatedAt sql.NullTime    `json:"created_at"`
+	ID         uuid.UUID       `json:"id"`
+	DeviceID   string          `json:"device_id"`
+	Latitude   float64         `json:"latitude"`
+	Longitude  float64         `json:"longitude"`
+	Accuracy   sql.NullFloat64 `json:"accuracy"`
+	Heading    sql.NullFloat64 `json:"heading"`
+	Speed      sql.NullFloat64 `json:"speed"`
+	IsMock     sql.NullBool    `json:"is_mock"`
+	CreatedAt  sql.NullTime    `json:"created_at"`
+	RecordedAt time.Time       `json:"recorded_at"`
 }
 
 // Guarda una nueva ubicación y devuelve el ID insertado.
@@ -68,39 +457,125 @@ func (q *Queries) CreateLocation(ctx context.Context, arg CreateLocationParams)
 		arg.Speed,
 		arg.IsMock,
 		arg.CreatedAt,
+		arg.RecordedAt,
 	)
 	var id uuid.UUID
 	err := row.Scan(&id)
 	return id, err
 }
 
-const deleteGeofence = `-- name: DeleteGeofence :exec
-DELETE FROM geofences WHERE id = $1
+const deleteDeviceGroup = `-- name: DeleteDeviceGroup :execrows
+DELETE FROM device_groups
+WHERE id = $1
+  AND NOT EXISTS (SELECT 1 FROM geofence_group_assignments a WHERE a.group_id = $1)
 `
 
-func (q *Queries) DeleteGeofence(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteGeofence, id)
-	return err
+// No borra grupos asignados a geocercas: esas zonas quedarían aplicando a
+// todos los dispositivos.
+func (q *Queries) DeleteDeviceGroup(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteDeviceGroup, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteDeviceIMEI = `-- name: DeleteDeviceIMEI :execrows
+DELETE FROM device_imeis WHERE imei = $1
+`
+
+func (q *Queries) DeleteDeviceIMEI(ctx context.Context, imei string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteDeviceIMEI, imei)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteGeofence = `-- name: DeleteGeofence :execrows
+UPDATE geofences
+SET deleted_at = NOW(), updated_by = $1
+WHERE id = $2 AND deleted_at IS NULL
+`
+
+type DeleteGeofenceParams struct {
+	UpdatedBy sql.NullString `json:"updated_by"`
+	ID        uuid.UUID      `json:"id"`
+}
+
+// Borrado lógico: la zona deja de evaluarse pero sus eventos y versiones se
+// conservan y se puede restaurar.
+func (q *Queries) DeleteGeofence(ctx context.Context, arg DeleteGeofenceParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteGeofence, arg.UpdatedBy, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const findGeofencesContainingPoint = `-- name: FindGeofencesContainingPoint :many
-SELECT id, name
+SELECT id, name, COALESCE(dwell_seconds, 0)::int as dwell_seconds,
+       min_fixes, min_duration_seconds, exit_buffer_meters,
+       (CASE shape
+            WHEN 'circle' THEN ST_DWithin(center, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography, radius_meters)
+            WHEN 'corridor' THEN ST_DWithin(path, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography, width_meters / 2)
+            ELSE ST_Contains(area, ST_SetSRID(ST_MakePoint($1, $2), 4326))
+        END)::bool as inside,
+       (CASE shape
+            WHEN 'circle' THEN abs(ST_Distance(center, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography) - radius_meters)
+            WHEN 'corridor' THEN abs(ST_Distance(path, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography) - width_meters / 2)
+            ELSE ST_Distance(ST_Boundary(area)::geography, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography)
+        END)::float8 as boundary_distance_meters,
+       (NOT geofence_active_at(schedule, $4::timestamptz))::bool as off_schedule,
+       COALESCE(speed_limit_kmh, 0)::float8 as speed_limit_kmh,
+       COALESCE(tags, '{}')::text[] as tags
 FROM geofences
-WHERE ST_Contains(area, ST_SetSRID(ST_MakePoint($1, $2), 4326))
+WHERE deleted_at IS NULL
+  AND geofence_assigned_to(id, $5::text)
+  AND ((ST_Intersects(area, ST_SetSRID(ST_MakePoint($1, $2), 4326))
+            AND geofence_active_at(schedule, $4::timestamptz))
+       OR id = ANY($3::uuid[]))
 `
 
 type FindGeofencesContainingPointParams struct {
 	StMakepoint   interface{} `json:"st_makepoint"`
 	StMakepoint_2 interface{} `json:"st_makepoint_2"`
+	Column3       []uuid.UUID `json:"column_3"`
+	Column4       time.Time   `json:"column_4"`
+	Column5       string      `json:"column_5"`
 }
 
 type FindGeofencesContainingPointRow struct {
-	ID   uuid.UUID `json:"id"`
-	Name string    `json:"name"`
+	ID                     uuid.UUID `json:"id"`
+	Name                   string    `json:"name"`
+	DwellSeconds           int32     `json:"dwell_seconds"`
+	MinFixes               int32     `json:"min_fixes"`
+	MinDurationSeconds     int32     `json:"min_duration_seconds"`
+	ExitBufferMeters       float64   `json:"exit_buffer_meters"`
+	Inside                 bool      `json:"inside"`
+	BoundaryDistanceMeters float64   `json:"boundary_distance_meters"`
+	OffSchedule            bool      `json:"off_schedule"`
+	SpeedLimitKmh          float64   `json:"speed_limit_kmh"`
+	Tags                   []string  `json:"tags"`
 }
 
+// Zonas que contienen el punto más las de $3 (donde estaba el dispositivo),
+// para poder confirmar salidas aunque ya esté lejos. La distancia al borde
+// permite comparar contra la precisión del fix. Círculos y corredores se
+// evalúan en geography con sus parámetros; area solo prefiltra. Las zonas
+// fuera de horario en $4 (hora del fix) solo vuelven por $3, marcadas con
+// off_schedule, para poder cerrar la visita. Solo cuentan las zonas
+// asignadas al dispositivo $5; las que dejaron de estarlo (o se borraron) se
+// descartan. speed_limit_kmh 0 indica que se usa el límite
+// global. tags viaja en los eventos para que los consumidores los enruten.
 func (q *Queries) FindGeofencesContainingPoint(ctx context.Context, arg FindGeofencesContainingPointParams) ([]FindGeofencesContainingPointRow, error) {
-	rows, err := q.db.QueryContext(ctx, findGeofencesContainingPoint, arg.StMakepoint, arg.StMakepoint_2)
+	rows, err := q.db.QueryContext(ctx, findGeofencesContainingPoint,
+		arg.StMakepoint,
+		arg.StMakepoint_2,
+		pq.Array(arg.Column3),
+		arg.Column4,
+		arg.Column5,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -108,7 +583,19 @@ func (q *Queries) FindGeofencesContainingPoint(ctx context.Context, arg FindGeof
 	var items []FindGeofencesContainingPointRow
 	for rows.Next() {
 		var i FindGeofencesContainingPointRow
-		if err := rows.Scan(&i.ID, &i.Name); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.DwellSeconds,
+			&i.MinFixes,
+			&i.MinDurationSeconds,
+			&i.ExitBufferMeters,
+			&i.Inside,
+			&i.BoundaryDistanceMeters,
+			&i.OffSchedule,
+			&i.SpeedLimitKmh,
+			pq.Array(&i.Tags),
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -122,10 +609,32 @@ func (q *Queries) FindGeofencesContainingPoint(ctx context.Context, arg FindGeof
 	return items, nil
 }
 
+const getDeviceGroup = `-- name: GetDeviceGroup :one
+SELECT id, name, created_at FROM device_groups WHERE id = $1
+`
+
+func (q *Queries) GetDeviceGroup(ctx context.Context, id uuid.UUID) (DeviceGroup, error) {
+	row := q.db.QueryRowContext(ctx, getDeviceGroup, id)
+	var i DeviceGroup
+	err := row.Scan(&i.ID, &i.Name, &i.CreatedAt)
+	return i, err
+}
+
+const getDeviceIDByIMEI = `-- name: GetDeviceIDByIMEI :one
+SELECT device_id FROM device_imeis WHERE imei = $1
+`
+
+func (q *Queries) GetDeviceIDByIMEI(ctx context.Context, imei string) (string, error) {
+	row := q.db.QueryRowContext(ctx, getDeviceIDByIMEI, imei)
+	var device_id string
+	err := row.Scan(&device_id)
+	return device_id, err
+}
+
 const getDriverRoute = `-- name: GetDriverRoute :one
 SELECT
     COALESCE(
-            ST_AsGeoJSON(ST_MakeLine(geom ORDER BY created_at))::text,
+            ST_AsGeoJSON(ST_MakeLine(geom ORDER BY recorded_at))::text,
             '{"type": "LineString", "coordinates": []}'
     )::text as geojson_route
 FROM locations
@@ -140,19 +649,194 @@ func (q *Queries) GetDriverRoute(ctx context.Context, deviceID string) (string,
 	return geojson_route, err
 }
 
+const getDriversWithin = `-- name: GetDriversWithin :many
+WITH area AS (
+    SELECT ST_SetSRID(ST_GeomFromGeoJSON($1::text), 4326) AS geom
+), latest AS (
+    SELECT DISTINCT ON (device_id)
+        device_id, latitude, longitude, heading, speed, recorded_at, geom
+    FROM locations
+    WHERE recorded_at > $2::timestamptz
+      AND ($3::text[] IS NULL OR device_id = ANY($3::text[]))
+    ORDER BY device_id, recorded_at DESC
+)
+SELECT
+    latest.device_id, latest.latitude, latest.longitude,
+    COALESCE(latest.heading, 0)::float8 AS heading,
+    COALESCE(latest.speed, 0)::float8 AS speed,
+    latest.recorded_at,
+    ST_Distance(
+            latest.geom::geography,
+            ST_Centroid(ST_Envelope(area.geom))::geography
+    )::float8 AS distance_meters
+FROM latest, area
+WHERE ST_Intersects(latest.geom, area.geom)
+ORDER BY CASE WHEN $4::bool THEN latest.recorded_at END DESC, distance_meters, latest.device_id
+LIMIT $5::int
+`
+
+type GetDriversWithinParams struct {
+	Geojson    string    `json:"geojson"`
+	Since      time.Time `json:"since"`
+	DeviceIds  []string  `json:"device_ids"`
+	ByLastSeen bool      `json:"by_last_seen"`
+	MaxResults int32     `json:"max_results"`
+}
+
+type GetDriversWithinRow struct {
+	DeviceID       string    `json:"device_id"`
+	Latitude       float64   `json:"latitude"`
+	Longitude      float64   `json:"longitude"`
+	Heading        float64   `json:"heading"`
+	Speed          float64   `json:"speed"`
+	RecordedAt     time.Time `json:"recorded_at"`
+	DistanceMeters float64   `json:"distance_meters"`
+}
+
+// Último fix de cada dispositivo activo desde since que cae dentro del área
+// (Polygon o MultiPolygon GeoJSON), con su distancia al centro del
+// rectángulo que la contiene, opcionalmente solo entre device_ids.
+func (q *Queries) GetDriversWithin(ctx context.Context, arg GetDriversWithinParams) ([]GetDriversWithinRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDriversWithin,
+		arg.Geojson,
+		arg.Since,
+		pq.Array(arg.DeviceIds),
+		arg.ByLastSeen,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDriversWithinRow
+	for rows.Next() {
+		var i GetDriversWithinRow
+		if err := rows.Scan(
+			&i.DeviceID,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Heading,
+			&i.Speed,
+			&i.RecordedAt,
+			&i.DistanceMeters,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getGeofenceName = `-- name: GetGeofenceName :one
+SELECT name FROM geofences
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) GetGeofenceName(ctx context.Context, id uuid.UUID) (string, error) {
+	row := q.db.QueryRowContext(ctx, getGeofenceName, id)
+	var name string
+	err := row.Scan(&name)
+	return name, err
+}
+
+const getGeofenceSchedule = `-- name: GetGeofenceSchedule :one
+SELECT COALESCE(schedule::text, '')::text AS schedule
+FROM geofences
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+// Cadena vacía si la zona no tiene horario.
+func (q *Queries) GetGeofenceSchedule(ctx context.Context, id uuid.UUID) (string, error) {
+	row := q.db.QueryRowContext(ctx, getGeofenceSchedule, id)
+	var schedule string
+	err := row.Scan(&schedule)
+	return schedule, err
+}
+
 const getGeofences = `-- name: GetGeofences :many
-SELECT id, name, ST_AsGeoJSON(area)::text as geojson
+SELECT id, name, ST_AsGeoJSON(area)::text as geojson, COALESCE(dwell_seconds, 0)::int as dwell_seconds,
+       min_fixes, min_duration_seconds, exit_buffer_meters,
+       shape,
+       COALESCE(ST_Y(center::geometry), 0)::float8 as center_latitude,
+       COALESCE(ST_X(center::geometry), 0)::float8 as center_longitude,
+       COALESCE(radius_meters, 0)::float8 as radius_meters,
+       COALESCE(ST_AsGeoJSON(path), '')::text as path_geojson,
+       COALESCE(width_meters, 0)::float8 as width_meters,
+       COALESCE(speed_limit_kmh, 0)::float8 as speed_limit_kmh,
+       COALESCE(description, '')::text as description,
+       COALESCE(color, '')::text as color,
+       COALESCE(category, '')::text as category,
+       COALESCE(tags, '{}')::text[] as tags,
+       COALESCE(properties, '{}')::jsonb as properties
 FROM geofences
+WHERE deleted_at IS NULL
+  AND ($1::text[] IS NULL OR tags @> $1::text[])
+  AND ($2::text IS NULL OR category = $2::text)
+  AND ($3::text IS NULL OR name ILIKE '%' || $3::text || '%')
+  AND ($4::float8 IS NULL
+       OR ST_Intersects(area, ST_MakeEnvelope($4::float8, $5::float8,
+                                              $6::float8, $7::float8, 4326)))
+ORDER BY name, id
+LIMIT $8::int OFFSET $9::int
 `
 
+type GetGeofencesParams struct {
+	Tags       []string        `json:"tags"`
+	Category   sql.NullString  `json:"category"`
+	Search     sql.NullString  `json:"search"`
+	MinLng     sql.NullFloat64 `json:"min_lng"`
+	MinLat     sql.NullFloat64 `json:"min_lat"`
+	MaxLng     sql.NullFloat64 `json:"max_lng"`
+	MaxLat     sql.NullFloat64 `json:"max_lat"`
+	PageLimit  sql.NullInt32   `json:"page_limit"`
+	PageOffset int32           `json:"page_offset"`
+}
+
 type GetGeofencesRow struct {
-	ID      uuid.UUID `json:"id"`
-	Name    string    `json:"name"`
-	Geojson string    `json:"geojson"`
+	ID                 uuid.UUID       `json:"id"`
+	Name               string          `json:"name"`
+	Geojson            string          `json:"geojson"`
+	DwellSeconds       int32           `json:"dwell_seconds"`
+	MinFixes           int32           `json:"min_fixes"`
+	MinDurationSeconds int32           `json:"min_duration_seconds"`
+	ExitBufferMeters   float64         `json:"exit_buffer_meters"`
+	Shape              string          `json:"shape"`
+	CenterLatitude     float64         `json:"center_latitude"`
+	CenterLongitude    float64         `json:"center_longitude"`
+	RadiusMeters       float64         `json:"radius_meters"`
+	PathGeojson        string          `json:"path_geojson"`
+	WidthMeters        float64         `json:"width_meters"`
+	SpeedLimitKmh      float64         `json:"speed_limit_kmh"`
+	Description        string          `json:"description"`
+	Color              string          `json:"color"`
+	Category           string          `json:"category"`
+	Tags               []string        `json:"tags"`
+	Properties         json.RawMessage `json:"properties"`
 }
 
-func (q *Queries) GetGeofences(ctx context.Context) ([]GetGeofencesRow, error) {
-	rows, err := q.db.QueryContext(ctx, getGeofences)
+// geojson es siempre el polígono (circunscrito en círculos y corredores);
+// los parámetros originales de cada forma vienen aparte.
+// Los filtros NULL no se aplican: tags exige todas las etiquetas, search
+// busca en el nombre (con los comodines ya escapados) y el bbox se cruza con
+// el área. page_limit NULL devuelve todas.
+func (q *Queries) GetGeofences(ctx context.Context, arg GetGeofencesParams) ([]GetGeofencesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getGeofences,
+		pq.Array(arg.Tags),
+		arg.Category,
+		arg.Search,
+		arg.MinLng,
+		arg.MinLat,
+		arg.MaxLng,
+		arg.MaxLat,
+		arg.PageLimit,
+		arg.PageOffset,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -160,7 +844,27 @@ func (q *Queries) GetGeofences(ctx context.Context) ([]GetGeofencesRow, error) {
 	var items []GetGeofencesRow
 	for rows.Next() {
 		var i GetGeofencesRow
-		if err := rows.Scan(&i.ID, &i.Name, &i.Geojson); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Geojson,
+			&i.DwellSeconds,
+			&i.MinFixes,
+			&i.MinDurationSeconds,
+			&i.ExitBufferMeters,
+			&i.Shape,
+			&i.CenterLatitude,
+			&i.CenterLongitude,
+			&i.RadiusMeters,
+			&i.PathGeojson,
+			&i.WidthMeters,
+			&i.SpeedLimitKmh,
+			&i.Description,
+			&i.Color,
+			&i.Category,
+			pq.Array(&i.Tags),
+			&i.Properties,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -175,9 +879,9 @@ func (q *Queries) GetGeofences(ctx context.Context) ([]GetGeofencesRow, error) {
 }
 
 const getLatestLocationByDevice = `-- name: GetLatestLocationByDevice :one
-SELECT id, device_id, latitude, longitude, geom, h3_ix, accuracy, heading, speed, is_mock, created_at FROM locations
+SELECT id, device_id, latitude, longitude, geom, h3_ix, accuracy, heading, speed, is_mock, created_at, recorded_at FROM locations
 WHERE device_id = $1
-ORDER BY created_at DESC
+ORDER BY recorded_at DESC
     LIMIT 1
 `
 
@@ -197,45 +901,73 @@ func (q *Queries) GetLatestLocationByDevice(ctx context.Context, deviceID string
 		&i.Speed,
 		&i.IsMock,
 		&i.CreatedAt,
+		&i.RecordedAt,
 	)
 	return i, err
 }
 
 const getNearbyDrivers = `-- name: GetNearbyDrivers :many
+WITH latest AS (
+    SELECT DISTINCT ON (device_id)
+        device_id, latitude, longitude, heading, speed, recorded_at, geom
+    FROM locations
+    WHERE recorded_at > $1::timestamptz
+      AND ($2::text[] IS NULL OR device_id = ANY($2::text[]))
+    ORDER BY device_id, recorded_at DESC
+)
 SELECT
-    id, device_id, latitude, longitude, heading, speed, created_at
-FROM locations
-WHERE
-  -- Compara la columna geom contra un punto creado al vuelo
-    ST_DWithin(
-            geom,
-            ST_SetSRID(ST_MakePoint($1::float8, $2::float8), 4326)::geography,
-            $3::float8
-    )
-  AND created_at > NOW() - INTERVAL '5 minutes' -- Solo conductores activos recientemente
-ORDER BY created_at DESC
+    device_id, latitude, longitude,
+    COALESCE(heading, 0)::float8 AS heading,
+    COALESCE(speed, 0)::float8 AS speed,
+    recorded_at,
+    ST_Distance(
+            geom::geography,
+            ST_SetSRID(ST_MakePoint($3::float8, $4::float8), 4326)::geography
+    )::float8 AS distance_meters
+FROM latest
+WHERE ST_DWithin(
+            geom::geography,
+            ST_SetSRID(ST_MakePoint($3::float8, $4::float8), 4326)::geography,
+            $5::float8
+      )
+ORDER BY CASE WHEN $6::bool THEN recorded_at END DESC, distance_meters, device_id
+LIMIT $7::int
 `
 
 type GetNearbyDriversParams struct {
-	Lng          float64 `json:"lng"`
-	Lat          float64 `json:"lat"`
-	RadiusMeters float64 `json:"radius_meters"`
+	Since        time.Time `json:"since"`
+	DeviceIds    []string  `json:"device_ids"`
+	Lng          float64   `json:"lng"`
+	Lat          float64   `json:"lat"`
+	RadiusMeters float64   `json:"radius_meters"`
+	ByLastSeen   bool      `json:"by_last_seen"`
+	MaxResults   int32     `json:"max_results"`
 }
 
 type GetNearbyDriversRow struct {
-	ID        uuid.UUID       `json:"id"`
-	DeviceID  string          `json:"device_id"`
-	Latitude  float64         `json:"latitude"`
-	Longitude float64         `json:"longitude"`
-	Heading   sql.NullFloat64 `json:"heading"`
-	Speed     sql.NullFloat64 `json:"speed"`
-	CreatedAt sql.NullTime    `json:"created_at"`
+	DeviceID       string    `json:"device_id"`
+	Latitude       float64   `json:"latitude"`
+	Longitude      float64   `json:"longitude"`
+	Heading        float64   `json:"heading"`
+	Speed          float64   `json:"speed"`
+	RecordedAt     time.Time `json:"recorded_at"`
+	DistanceMeters float64   `json:"distance_meters"`
 }
 
-// Busca conductores dentro de un radio (en metros) usando PostGIS.
-// ST_DWithin usa índices espaciales, así que es ULTRA rápido.
+// Último fix de cada dispositivo activo desde since que cae dentro del radio
+// (en metros), con su distancia al centro, opcionalmente solo entre
+// device_ids. Ordena por distancia o, con by_last_seen, del más reciente al
+// más viejo.
 func (q *Queries) GetNearbyDrivers(ctx context.Context, arg GetNearbyDriversParams) ([]GetNearbyDriversRow, error) {
-	rows, err := q.db.QueryContext(ctx, getNearbyDrivers, arg.Lng, arg.Lat, arg.RadiusMeters)
+	rows, err := q.db.QueryContext(ctx, getNearbyDrivers,
+		arg.Since,
+		pq.Array(arg.DeviceIds),
+		arg.Lng,
+		arg.Lat,
+		arg.RadiusMeters,
+		arg.ByLastSeen,
+		arg.MaxResults,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -244,13 +976,371 @@ func (q *Queries) GetNearbyDrivers(ctx context.Context, arg GetNearbyDriversPara
 	for rows.Next() {
 		var i GetNearbyDriversRow
 		if err := rows.Scan(
-			&i.ID,
 			&i.DeviceID,
 			&i.Latitude,
 			&i.Longitude,
 			&i.Heading,
 			&i.Speed,
+			&i.RecordedAt,
+			&i.DistanceMeters,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getNearestDrivers = `-- name: GetNearestDrivers :many
+WITH latest AS (
+    SELECT DISTINCT ON (device_id)
+        device_id, latitude, longitude, heading, speed, recorded_at, geom
+    FROM locations
+    WHERE recorded_at > $1::timestamptz
+      AND ($2::text[] IS NULL OR device_id = ANY($2::text[]))
+    ORDER BY device_id, recorded_at DESC
+)
+SELECT
+    device_id, latitude, longitude,
+    COALESCE(heading, 0)::float8 AS heading,
+    COALESCE(speed, 0)::float8 AS speed,
+    recorded_at,
+    ST_Distance(
+            geom::geography,
+            ST_SetSRID(ST_MakePoint($3::float8, $4::float8), 4326)::geography
+    )::float8 AS distance_meters
+FROM latest
+WHERE $5::float8 IS NULL
+   OR ST_DWithin(
+            geom::geography,
+            ST_SetSRID(ST_MakePoint($3::float8, $4::float8), 4326)::geography,
+            $5::float8
+      )
+ORDER BY geom::geography <-> ST_SetSRID(ST_MakePoint($3::float8, $4::float8), 4326)::geography, device_id
+LIMIT $6::int
+`
+
+type GetNearestDriversParams struct {
+	Since       time.Time       `json:"since"`
+	DeviceIds   []string        `json:"device_ids"`
+	Lng         float64         `json:"lng"`
+	Lat         float64         `json:"lat"`
+	MaxDistance sql.NullFloat64 `json:"max_distance"`
+	MaxResults  int32           `json:"max_results"`
+}
+
+type GetNearestDriversRow struct {
+	DeviceID       string    `json:"device_id"`
+	Latitude       float64   `json:"latitude"`
+	Longitude      float64   `json:"longitude"`
+	Heading        float64   `json:"heading"`
+	Speed          float64   `json:"speed"`
+	RecordedAt     time.Time `json:"recorded_at"`
+	DistanceMeters float64   `json:"distance_meters"`
+}
+
+// Los max_results dispositivos más cercanos (KNN sobre el último fix de cada
+// uno), opcionalmente solo entre device_ids y dentro de max_distance metros.
+func (q *Queries) GetNearestDrivers(ctx context.Context, arg GetNearestDriversParams) ([]GetNearestDriversRow, error) {
+	rows, err := q.db.QueryContext(ctx, getNearestDrivers,
+		arg.Since,
+		pq.Array(arg.DeviceIds),
+		arg.Lng,
+		arg.Lat,
+		arg.MaxDistance,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetNearestDriversRow
+	for rows.Next() {
+		var i GetNearestDriversRow
+		if err := rows.Scan(
+			&i.DeviceID,
+			&i.Latitude,
+			&i.Longitude,
+			&i.Heading,
+			&i.Speed,
+			&i.RecordedAt,
+			&i.DistanceMeters,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDeviceGroupMembers = `-- name: ListDeviceGroupMembers :many
+SELECT device_id FROM device_group_members WHERE group_id = $1 ORDER BY device_id
+`
+
+func (q *Queries) ListDeviceGroupMembers(ctx context.Context, groupID uuid.UUID) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listDeviceGroupMembers, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var device_id string
+		if err := rows.Scan(&device_id); err != nil {
+			return nil, err
+		}
+		items = append(items, device_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDeviceGroups = `-- name: ListDeviceGroups :many
+SELECT g.id, g.name, g.created_at, COUNT(m.device_id)::int AS devices
+FROM device_groups g
+         LEFT JOIN device_group_members m ON m.group_id = g.id
+GROUP BY g.id
+ORDER BY g.name
+`
+
+type ListDeviceGroupsRow struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Devices   int32     `json:"devices"`
+}
+
+func (q *Queries) ListDeviceGroups(ctx context.Context) ([]ListDeviceGroupsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listDeviceGroups)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListDeviceGroupsRow
+	for rows.Next() {
+		var i ListDeviceGroupsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
 			&i.CreatedAt,
+			&i.Devices,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDeviceIMEIs = `-- name: ListDeviceIMEIs :many
+SELECT imei, device_id, created_at FROM device_imeis
+WHERE $1::text IS NULL OR device_id = $1
+ORDER BY imei
+`
+
+func (q *Queries) ListDeviceIMEIs(ctx context.Context, deviceID sql.NullString) ([]DeviceImei, error) {
+	rows, err := q.db.QueryContext(ctx, listDeviceIMEIs, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DeviceImei
+	for rows.Next() {
+		var i DeviceImei
+		if err := rows.Scan(&i.Imei, &i.DeviceID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listGeofenceDeviceAssignments = `-- name: ListGeofenceDeviceAssignments :many
+SELECT device_id FROM geofence_device_assignments WHERE geofence_id = $1 ORDER BY device_id
+`
+
+func (q *Queries) ListGeofenceDeviceAssignments(ctx context.Context, geofenceID uuid.UUID) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listGeofenceDeviceAssignments, geofenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var device_id string
+		if err := rows.Scan(&device_id); err != nil {
+			return nil, err
+		}
+		items = append(items, device_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listGeofenceGroupAssignments = `-- name: ListGeofenceGroupAssignments :many
+SELECT g.id, g.name
+FROM geofence_group_assignments a
+         JOIN device_groups g ON g.id = a.group_id
+WHERE a.geofence_id = $1
+ORDER BY g.name
+`
+
+type ListGeofenceGroupAssignmentsRow struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+func (q *Queries) ListGeofenceGroupAssignments(ctx context.Context, geofenceID uuid.UUID) ([]ListGeofenceGroupAssignmentsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listGeofenceGroupAssignments, geofenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListGeofenceGroupAssignmentsRow
+	for rows.Next() {
+		var i ListGeofenceGroupAssignmentsRow
+		if err := rows.Scan(&i.ID, &i.Name); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listGeofenceVersions = `-- name: ListGeofenceVersions :many
+SELECT version, action, changed_by, changed_at, name, shape,
+       ST_AsGeoJSON(area)::text AS geojson,
+       COALESCE(ST_AsGeoJSON(lag(area) OVER (ORDER BY version)), '')::text AS previous_geojson
+FROM geofence_versions
+WHERE geofence_id = $1
+ORDER BY version DESC
+`
+
+type ListGeofenceVersionsRow struct {
+	Version         int32          `json:"version"`
+	Action          string         `json:"action"`
+	ChangedBy       sql.NullString `json:"changed_by"`
+	ChangedAt       time.Time      `json:"changed_at"`
+	Name            string         `json:"name"`
+	Shape           string         `json:"shape"`
+	Geojson         string         `json:"geojson"`
+	PreviousGeojson string         `json:"previous_geojson"`
+}
+
+// Historial de la zona, de la más nueva a la más vieja, con la geometría
+// anterior a cada cambio (vacía en el alta).
+func (q *Queries) ListGeofenceVersions(ctx context.Context, geofenceID uuid.UUID) ([]ListGeofenceVersionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listGeofenceVersions, geofenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListGeofenceVersionsRow
+	for rows.Next() {
+		var i ListGeofenceVersionsRow
+		if err := rows.Scan(
+			&i.Version,
+			&i.Action,
+			&i.ChangedBy,
+			&i.ChangedAt,
+			&i.Name,
+			&i.Shape,
+			&i.Geojson,
+			&i.PreviousGeojson,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listScheduledGeofences = `-- name: ListScheduledGeofences :many
+SELECT id, name,
+       geofence_active_at(schedule, $1::timestamptz)::bool AS active,
+       ST_XMin(area)::float8 AS min_longitude,
+       ST_YMin(area)::float8 AS min_latitude,
+       ST_XMax(area)::float8 AS max_longitude,
+       ST_YMax(area)::float8 AS max_latitude
+FROM geofences
+WHERE schedule IS NOT NULL AND deleted_at IS NULL
+`
+
+type ListScheduledGeofencesRow struct {
+	ID           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	Active       bool      `json:"active"`
+	MinLongitude float64   `json:"min_longitude"`
+	MinLatitude  float64   `json:"min_latitude"`
+	MaxLongitude float64   `json:"max_longitude"`
+	MaxLatitude  float64   `json:"max_latitude"`
+}
+
+// Zonas con horario, si están activas en at y su bbox para buscar a los
+// dispositivos que quedan adentro.
+func (q *Queries) ListScheduledGeofences(ctx context.Context, at time.Time) ([]ListScheduledGeofencesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listScheduledGeofences, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListScheduledGeofencesRow
+	for rows.Next() {
+		var i ListScheduledGeofencesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Active,
+			&i.MinLongitude,
+			&i.MinLatitude,
+			&i.MaxLongitude,
+			&i.MaxLatitude,
 		); err != nil {
 			return nil, err
 		}
@@ -266,48 +1356,381 @@ func (q *Queries) GetNearbyDrivers(ctx context.Context, arg GetNearbyDriversPara
 }
 
 const logGeofenceEvent = `-- name: LogGeofenceEvent :exec
-INSERT INTO geofence_events (geofence_id, device_id, event_type)
-VALUES ($1, $2, $3)
+INSERT INTO geofence_events (
+    geofence_id, device_id, event_type, timestamp, duration_seconds, decision, accuracy, boundary_distance_meters,
+    start_speed_kmh, peak_speed_kmh, end_speed_kmh
+) VALUES (
+             $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+         )
 `
 
 type LogGeofenceEventParams struct {
-	GeofenceID uuid.UUID `json:"geofence_id"`
-	DeviceID   string    `json:"device_id"`
-	EventType  string    `json:"event_type"`
+	GeofenceID             uuid.UUID       `json:"geofence_id"`
+	DeviceID               string          `json:"device_id"`
+	EventType              string          `json:"event_type"`
+	Timestamp              time.Time       `json:"timestamp"`
+	DurationSeconds        sql.NullInt32   `json:"duration_seconds"`
+	Decision               sql.NullString  `json:"decision"`
+	Accuracy               sql.NullFloat64 `json:"accuracy"`
+	BoundaryDistanceMeters sql.NullFloat64 `json:"boundary_distance_meters"`
+	StartSpeedKmh          sql.NullFloat64 `json:"start_speed_kmh"`
+	PeakSpeedKmh           sql.NullFloat64 `json:"peak_speed_kmh"`
+	EndSpeedKmh            sql.NullFloat64 `json:"end_speed_kmh"`
 }
 
 func (q *Queries) LogGeofenceEvent(ctx context.Context, arg LogGeofenceEventParams) error {
-	_, err := q.db.ExecContext(ctx, logGeofenceEvent, arg.GeofenceID, arg.DeviceID, arg.EventType)
+	_, err := q.db.ExecContext(ctx, logGeofenceEvent,
+		arg.GeofenceID,
+		arg.DeviceID,
+		arg.EventType,
+		arg.Timestamp,
+		arg.DurationSeconds,
+		arg.Decision,
+		arg.Accuracy,
+		arg.BoundaryDistanceMeters,
+		arg.StartSpeedKmh,
+		arg.PeakSpeedKmh,
+		arg.EndSpeedKmh,
+	)
 	return err
 }
 
+const removeDeviceGroupMember = `-- name: RemoveDeviceGroupMember :execrows
+DELETE FROM device_group_members WHERE group_id = $1 AND device_id = $2
+`
+
+type RemoveDeviceGroupMemberParams struct {
+	GroupID  uuid.UUID `json:"group_id"`
+	DeviceID string    `json:"device_id"`
+}
+
+func (q *Queries) RemoveDeviceGroupMember(ctx context.Context, arg RemoveDeviceGroupMemberParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, removeDeviceGroupMember, arg.GroupID, arg.DeviceID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const renameDeviceGroup = `-- name: RenameDeviceGroup :one
+UPDATE device_groups
+SET name = $1
+WHERE id = $2
+  AND NOT EXISTS (SELECT 1 FROM device_groups o WHERE o.name = $1 AND o.id <> $2)
+RETURNING id, name, created_at
+`
+
+type RenameDeviceGroupParams struct {
+	Name string    `json:"name"`
+	ID   uuid.UUID `json:"id"`
+}
+
+// Sin fila si el grupo no existe o el nombre ya lo usa otro.
+func (q *Queries) RenameDeviceGroup(ctx context.Context, arg RenameDeviceGroupParams) (DeviceGroup, error) {
+	row := q.db.QueryRowContext(ctx, renameDeviceGroup, arg.Name, arg.ID)
+	var i DeviceGroup
+	err := row.Scan(&i.ID, &i.Name, &i.CreatedAt)
+	return i, err
+}
+
+const restoreGeofenceVersion = `-- name: RestoreGeofenceVersion :one
+UPDATE geofences g
+SET name = v.name,
+    area = v.area,
+    shape = v.shape,
+    center = v.center,
+    radius_meters = v.radius_meters,
+    path = v.path,
+    width_meters = v.width_meters,
+    dwell_seconds = v.dwell_seconds,
+    min_fixes = v.min_fixes,
+    min_duration_seconds = v.min_duration_seconds,
+    exit_buffer_meters = v.exit_buffer_meters,
+    schedule = v.schedule,
+    speed_limit_kmh = v.speed_limit_kmh,
+    description = v.description,
+    color = v.color,
+    category = v.category,
+    tags = v.tags,
+    properties = v.properties,
+    deleted_at = NULL,
+    updated_by = $1
+FROM geofence_versions v
+WHERE v.geofence_id = $2 AND v.version = $3 AND g.id = v.geofence_id
+    RETURNING g.id, g.name
+`
+
+type RestoreGeofenceVersionParams struct {
+	UpdatedBy  sql.NullString `json:"updated_by"`
+	GeofenceID uuid.UUID      `json:"geofence_id"`
+	Version    int32          `json:"version"`
+}
+
+type RestoreGeofenceVersionRow struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// Vuelve la zona (aunque esté borrada) al estado de una versión; el trigger
+// la registra como una versión nueva.
+func (q *Queries) RestoreGeofenceVersion(ctx context.Context, arg RestoreGeofenceVersionParams) (RestoreGeofenceVersionRow, error) {
+	row := q.db.QueryRowContext(ctx, restoreGeofenceVersion, arg.UpdatedBy, arg.GeofenceID, arg.Version)
+	var i RestoreGeofenceVersionRow
+	err := row.Scan(&i.ID, &i.Name)
+	return i, err
+}
+
+const setGeofenceSchedule = `-- name: SetGeofenceSchedule :execrows
+UPDATE geofences
+SET schedule = ($1::text)::jsonb, updated_by = $2
+WHERE id = $3 AND deleted_at IS NULL
+`
+
+type SetGeofenceScheduleParams struct {
+	Schedule  sql.NullString `json:"schedule"`
+	UpdatedBy sql.NullString `json:"updated_by"`
+	ID        uuid.UUID      `json:"id"`
+}
+
+// schedule NULL quita el horario (la zona queda siempre activa).
+func (q *Queries) SetGeofenceSchedule(ctx context.Context, arg SetGeofenceScheduleParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setGeofenceSchedule, arg.Schedule, arg.UpdatedBy, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const timezoneExists = `-- name: TimezoneExists :one
+SELECT EXISTS (SELECT 1 FROM pg_timezone_names WHERE name = $1)
+`
+
+// geofence_active_at usa AT TIME ZONE: un nombre que Postgres no conoce
+// rompería cada consulta que evalúe la zona.
+func (q *Queries) TimezoneExists(ctx context.Context, name string) (bool, error) {
+	row := q.db.QueryRowContext(ctx, timezoneExists, name)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const unassignGeofenceFromDevice = `-- name: UnassignGeofenceFromDevice :execrows
+DELETE FROM geofence_device_assignments WHERE geofence_id = $1 AND device_id = $2
+`
+
+type UnassignGeofenceFromDeviceParams struct {
+	GeofenceID uuid.UUID `json:"geofence_id"`
+	DeviceID   string    `json:"device_id"`
+}
+
+func (q *Queries) UnassignGeofenceFromDevice(ctx context.Context, arg UnassignGeofenceFromDeviceParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, unassignGeofenceFromDevice, arg.GeofenceID, arg.DeviceID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const unassignGeofenceFromGroup = `-- name: UnassignGeofenceFromGroup :execrows
+DELETE FROM geofence_group_assignments WHERE geofence_id = $1 AND group_id = $2
+`
+
+type UnassignGeofenceFromGroupParams struct {
+	GeofenceID uuid.UUID `json:"geofence_id"`
+	GroupID    uuid.UUID `json:"group_id"`
+}
+
+func (q *Queries) UnassignGeofenceFromGroup(ctx context.Context, arg UnassignGeofenceFromGroupParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, unassignGeofenceFromGroup, arg.GeofenceID, arg.GroupID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateGeofence = `-- name: UpdateGeofence :one
 UPDATE geofences
 SET
-    name = $2,
-    area = CASE
-               WHEN length($3::text) > 0 THEN ST_GeomFromGeoJSON($3)
+    name = $1,
+    shape = COALESCE($2::text, shape),
+    area = CASE $2::text
+               WHEN 'polygon' THEN ST_GeomFromGeoJSON($3::text)
+               WHEN 'circle' THEN geofence_buffer(ST_SetSRID(ST_MakePoint($4::float8, $5::float8), 4326)::geography, $6::float8)
+               WHEN 'corridor' THEN geofence_buffer(ST_GeomFromGeoJSON($3::text)::geography, $7::float8 / 2)
                ELSE area
-        END
-WHERE id = $1
-    RETURNING id, name, ST_AsGeoJSON(area)::text as geojson
+        END,
+    center = CASE
+               WHEN $2::text IS NULL THEN center
+               WHEN $2::text = 'circle' THEN ST_SetSRID(ST_MakePoint($4::float8, $5::float8), 4326)::geography
+        END,
+    radius_meters = CASE
+               WHEN $2::text IS NULL THEN radius_meters
+               WHEN $2::text = 'circle' THEN $6::float8
+        END,
+    path = CASE
+               WHEN $2::text IS NULL THEN path
+               WHEN $2::text = 'corridor' THEN ST_GeomFromGeoJSON($3::text)::geography
+        END,
+    width_meters = CASE
+               WHEN $2::text IS NULL THEN width_meters
+               WHEN $2::text = 'corridor' THEN $7::float8
+        END,
+    dwell_seconds = CASE
+               WHEN $8::int IS NULL THEN dwell_seconds
+               ELSE NULLIF($8::int, 0)
+        END,
+    min_fixes = COALESCE($9::int, min_fixes),
+    min_duration_seconds = COALESCE($10::int, min_duration_seconds),
+    exit_buffer_meters = COALESCE($11::float8, exit_buffer_meters),
+    speed_limit_kmh = CASE
+               WHEN $12::float8 IS NULL THEN speed_limit_kmh
+               ELSE NULLIF($12::float8, 0)
+        END,
+    description = CASE
+               WHEN $13::text IS NULL THEN description
+               ELSE NULLIF($13::text, '')
+        END,
+    color = CASE
+               WHEN $14::text IS NULL THEN color
+               ELSE NULLIF($14::text, '')
+        END,
+    category = CASE
+               WHEN $15::text IS NULL THEN category
+               ELSE NULLIF($15::text, '')
+        END,
+    tags = COALESCE($16::text[], tags),
+    properties = COALESCE(($17::text)::jsonb, properties),
+    updated_by = $18
+WHERE id = $19 AND deleted_at IS NULL
+    RETURNING id, name, ST_AsGeoJSON(area)::text as geojson, COALESCE(dwell_seconds, 0)::int as dwell_seconds,
+              min_fixes, min_duration_seconds, exit_buffer_meters,
+              shape,
+              COALESCE(ST_Y(center::geometry), 0)::float8 as center_latitude,
+              COALESCE(ST_X(center::geometry), 0)::float8 as center_longitude,
+              COALESCE(radius_meters, 0)::float8 as radius_meters,
+              COALESCE(ST_AsGeoJSON(path), '')::text as path_geojson,
+              COALESCE(width_meters, 0)::float8 as width_meters,
+              COALESCE(speed_limit_kmh, 0)::float8 as speed_limit_kmh,
+              COALESCE(description, '')::text as description,
+              COALESCE(color, '')::text as color,
+              COALESCE(category, '')::text as category,
+              COALESCE(tags, '{}')::text[] as tags,
+              COALESCE(properties, '{}')::jsonb as properties
 `
 
 type UpdateGeofenceParams struct {
-	ID      uuid.UUID `json:"id"`
-	Name    string    `json:"name"`
-	Column3 string    `json:"column_3"`
+	Name               string          `json:"name"`
+	Shape              sql.NullString  `json:"shape"`
+	Geojson            string          `json:"geojson"`
+	Lng                float64         `json:"lng"`
+	Lat                float64         `json:"lat"`
+	RadiusMeters       float64         `json:"radius_meters"`
+	WidthMeters        float64         `json:"width_meters"`
+	DwellSeconds       sql.NullInt32   `json:"dwell_seconds"`
+	MinFixes           sql.NullInt32   `json:"min_fixes"`
+	MinDurationSeconds sql.NullInt32   `json:"min_duration_seconds"`
+	ExitBufferMeters   sql.NullFloat64 `json:"exit_buffer_meters"`
+	SpeedLimitKmh      sql.NullFloat64 `json:"speed_limit_kmh"`
+	Description        sql.NullString  `json:"description"`
+	Color              sql.NullString  `json:"color"`
+	Category           sql.NullString  `json:"category"`
+	Tags               []string        `json:"tags"`
+	Properties         sql.NullString  `json:"properties"`
+	UpdatedBy          sql.NullString  `json:"updated_by"`
+	ID                 uuid.UUID       `json:"id"`
 }
 
 type UpdateGeofenceRow struct {
-	ID      uuid.UUID `json:"id"`
-	Name    string    `json:"name"`
-	Geojson string    `json:"geojson"`
+	ID                 uuid.UUID       `json:"id"`
+	Name               string          `json:"name"`
+	Geojson            string          `json:"geojson"`
+	DwellSeconds       int32           `json:"dwell_seconds"`
+	MinFixes           int32           `json:"min_fixes"`
+	MinDurationSeconds int32           `json:"min_duration_seconds"`
+	ExitBufferMeters   float64         `json:"exit_buffer_meters"`
+	Shape              string          `json:"shape"`
+	CenterLatitude     float64         `json:"center_latitude"`
+	CenterLongitude    float64         `json:"center_longitude"`
+	RadiusMeters       float64         `json:"radius_meters"`
+	PathGeojson        string          `json:"path_geojson"`
+	WidthMeters        float64         `json:"width_meters"`
+	SpeedLimitKmh      float64         `json:"speed_limit_kmh"`
+	Description        string          `json:"description"`
+	Color              string          `json:"color"`
+	Category           string          `json:"category"`
+	Tags               []string        `json:"tags"`
+	Properties         json.RawMessage `json:"properties"`
 }
 
+// shape NULL conserva la geometría actual; si no, la reemplaza con geojson
+// (polygon/corridor), lng/lat/radius_meters (circle) o width_meters
+// (corridor). dwell_seconds NULL conserva el umbral actual; 0 lo desactiva.
+// Los parámetros de histéresis NULL también conservan el valor actual.
+// speed_limit_kmh sigue la regla de dwell_seconds: 0 vuelve al límite global.
+// Los metadatos NULL también se conservan; description, color y category
+// vacíos los borran.
 func (q *Queries) UpdateGeofence(ctx context.Context, arg UpdateGeofenceParams) (UpdateGeofenceRow, error) {
-	row := q.db.QueryRowContext(ctx, updateGeofence, arg.ID, arg.Name, arg.Column3)
+	row := q.db.QueryRowContext(ctx, updateGeofence,
+		arg.Name,
+		arg.Shape,
+		arg.Geojson,
+		arg.Lng,
+		arg.Lat,
+		arg.RadiusMeters,
+		arg.WidthMeters,
+		arg.DwellSeconds,
+		arg.MinFixes,
+		arg.MinDurationSeconds,
+		arg.ExitBufferMeters,
+		arg.SpeedLimitKmh,
+		arg.Description,
+		arg.Color,
+		arg.Category,
+		pq.Array(arg.Tags),
+		arg.Properties,
+		arg.UpdatedBy,
+		arg.ID,
+	)
 	var i UpdateGeofenceRow
-	err := row.Scan(&i.ID, &i.Name, &i.Geojson)
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Geojson,
+		&i.DwellSeconds,
+		&i.MinFixes,
+		&i.MinDurationSeconds,
+		&i.ExitBufferMeters,
+		&i.Shape,
+		&i.CenterLatitude,
+		&i.CenterLongitude,
+		&i.RadiusMeters,
+		&i.PathGeojson,
+		&i.WidthMeters,
+		&i.SpeedLimitKmh,
+		&i.Description,
+		&i.Color,
+		&i.Category,
+		pq.Array(&i.Tags),
+		&i.Properties,
+	)
+	return i, err
+}
+
+const upsertDeviceIMEI = `-- name: UpsertDeviceIMEI :one
+INSERT INTO device_imeis (imei, device_id) VALUES ($1, $2)
+ON CONFLICT (imei) DO UPDATE SET device_id = EXCLUDED.device_id
+RETURNING imei, device_id, created_at
+`
+
+type UpsertDeviceIMEIParams struct {
+	Imei     string `json:"imei"`
+	DeviceID string `json:"device_id"`
+}
+
+// Reasigna el IMEI si ya estaba registrado; created_at conserva el alta.
+func (q *Queries) UpsertDeviceIMEI(ctx context.Context, arg UpsertDeviceIMEIParams) (DeviceImei, error) {
+	row := q.db.QueryRowContext(ctx, upsertDeviceIMEI, arg.Imei, arg.DeviceID)
+	var i DeviceImei
+	err := row.Scan(&i.Imei, &i.DeviceID, &i.CreatedAt)
 	return i, err
 }
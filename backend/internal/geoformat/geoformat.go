@@ -0,0 +1,157 @@
+// Package geoformat lee y escribe colecciones de zonas en los formatos que
+// usan las herramientas de dibujo (QGIS, Google Earth): GeoJSON
+// FeatureCollection, KML y Shapefile comprimido en zip. Las geometrías se
+// manejan siempre como GeoJSON en WGS84.
+package geoformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	GeoJSON   = "geojson"
+	KML       = "kml"
+	Shapefile = "shapefile"
+)
+
+// Feature es una zona leída de o a escribir en un archivo.
+type Feature struct {
+	Name string
+	// Properties son los atributos restantes, con claves en minúsculas y los
+	// nombres cortos del DBF ya traducidos (ver dbfNames).
+	Properties map[string]interface{}
+	// Geometry es un objeto geometry de GeoJSON.
+	Geometry json.RawMessage
+	// Err explica por qué no se pudo leer la geometría de esta feature; el
+	// resto del archivo se lee igual.
+	Err error
+}
+
+var errUnknownFormat = errors.New("Formato desconocido: use geojson, kml o shapefile")
+
+// Detect adivina el formato por el contenido: zip es un shapefile, XML es
+// KML y JSON es GeoJSON.
+func Detect(data []byte) string {
+	trimmed := bytes.TrimLeft(data, " \t\r\n\xef\xbb\xbf")
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return Shapefile
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return KML
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return GeoJSON
+	default:
+		return ""
+	}
+}
+
+// Decode lee todas las features del archivo. Un error indica que el archivo
+// entero es ilegible; los problemas de una sola feature van en Feature.Err.
+func Decode(format string, data []byte) ([]Feature, error) {
+	switch format {
+	case GeoJSON:
+		return decodeGeoJSON(data)
+	case KML:
+		return decodeKML(data)
+	case Shapefile:
+		return decodeShapefile(data)
+	default:
+		return nil, errUnknownFormat
+	}
+}
+
+// Encode escribe las features en el formato pedido. Las geometrías deben ser
+// Polygon o MultiPolygon.
+func Encode(w io.Writer, format string, features []Feature) error {
+	switch format {
+	case GeoJSON:
+		return encodeGeoJSON(w, features)
+	case KML:
+		return encodeKML(w, features)
+	case Shapefile:
+		return encodeShapefile(w, features)
+	default:
+		return errUnknownFormat
+	}
+}
+
+// ContentType y Extension describen el archivo que produce Encode.
+func ContentType(format string) string {
+	switch format {
+	case KML:
+		return "application/vnd.google-earth.kml+xml"
+	case Shapefile:
+		return "application/zip"
+	default:
+		return "application/geo+json"
+	}
+}
+
+func Extension(format string) string {
+	switch format {
+	case KML:
+		return ".kml"
+	case Shapefile:
+		return ".zip"
+	default:
+		return ".geojson"
+	}
+}
+
+// newFeature separa el nombre del resto de los atributos.
+func newFeature(props map[string]interface{}) Feature {
+	f := Feature{Properties: make(map[string]interface{}, len(props))}
+	for k, v := range props {
+		f.Properties[strings.ToLower(k)] = v
+	}
+	if name, ok := f.Properties["name"]; ok {
+		if name != nil {
+			f.Name = strings.TrimSpace(fmt.Sprint(name))
+		}
+		delete(f.Properties, "name")
+	}
+	return f
+}
+
+// polygons devuelve los polígonos (anillos de [lng, lat]) de un Polygon o
+// MultiPolygon GeoJSON.
+func polygons(geometry json.RawMessage) ([][][][]float64, error) {
+	var g struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+	if err := json.Unmarshal(geometry, &g); err != nil {
+		return nil, err
+	}
+	switch g.Type {
+	case "Polygon":
+		var rings [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &rings); err != nil {
+			return nil, err
+		}
+		return [][][][]float64{rings}, nil
+	case "MultiPolygon":
+		var polys [][][][]float64
+		err := json.Unmarshal(g.Coordinates, &polys)
+		return polys, err
+	default:
+		return nil, fmt.Errorf("Tipo %s no soportado para exportar", g.Type)
+	}
+}
+
+// polygonGeometry arma un Polygon si hay uno solo y un MultiPolygon si no.
+func polygonGeometry(polys [][][][]float64) json.RawMessage {
+	var g interface{}
+	if len(polys) == 1 {
+		g = map[string]interface{}{"type": "Polygon", "coordinates": polys[0]}
+	} else {
+		g = map[string]interface{}{"type": "MultiPolygon", "coordinates": polys}
+	}
+	raw, _ := json.Marshal(g)
+	return raw
+}
@@ -0,0 +1,122 @@
+package geoformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// holed es un cuadrado en sentido antihorario con un hueco horario (RFC 7946).
+const holed = `{"type":"Polygon","coordinates":[[[0,0],[4,0],[4,4],[0,4],[0,0]],[[1,1],[1,2],[2,2],[2,1],[1,1]]]}`
+
+func sampleFeatures() []Feature {
+	return []Feature{
+		{
+			Name:       "Almacén Norte",
+			Properties: map[string]interface{}{"dwell_seconds": 300.0, "speed_limit_kmh": 20.5, "shape": "polygon"},
+			Geometry:   json.RawMessage(holed),
+		},
+		{
+			Name:       "Dos patios",
+			Properties: map[string]interface{}{"dwell_seconds": 0.0, "speed_limit_kmh": 0.0, "shape": "polygon"},
+			Geometry:   json.RawMessage(`{"type":"MultiPolygon","coordinates":[[[[10,10],[11,10],[11,11],[10,10]]],[[[20,20],[21,20],[21,21],[20,20]]]]}`),
+		},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []string{GeoJSON, KML, Shapefile} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, Encode(&buf, format, sampleFeatures()))
+			assert.Equal(t, format, Detect(buf.Bytes()))
+
+			features, err := Decode(format, buf.Bytes())
+			require.NoError(t, err)
+			require.Len(t, features, 2)
+
+			for i, want := range sampleFeatures() {
+				got := features[i]
+				require.NoError(t, got.Err)
+				assert.Equal(t, want.Name, got.Name)
+				assert.Equal(t, "polygon", got.Properties["shape"])
+
+				wantPolys, err := polygons(want.Geometry)
+				require.NoError(t, err)
+				gotPolys, err := polygons(got.Geometry)
+				require.NoError(t, err)
+				assert.Equal(t, wantPolys, gotPolys)
+			}
+
+			// GeoJSON y DBF conservan los números; KML los devuelve como texto.
+			speed := features[0].Properties["speed_limit_kmh"]
+			if format == KML {
+				assert.Equal(t, "20.5", speed)
+			} else {
+				assert.Equal(t, 20.5, speed)
+			}
+		})
+	}
+}
+
+func TestShapefileOrientation(t *testing.T) {
+	// En el .shp el exterior va en sentido horario y el hueco antihorario.
+	polys, err := polygons(json.RawMessage(holed))
+	require.NoError(t, err)
+	record := shpPolygonRecord(polys, newBBox())
+
+	rings, err := shpParts(record)
+	require.NoError(t, err)
+	require.Len(t, rings, 2)
+	assert.Less(t, signedArea(rings[0]), 0.0)
+	assert.Greater(t, signedArea(rings[1]), 0.0)
+
+	// Al leerlo vuelve a RFC 7946 y el hueco queda dentro de su exterior.
+	assembled := assemblePolygons(rings)
+	require.Len(t, assembled, 1)
+	assert.Equal(t, polys, assembled)
+}
+
+func TestDecodeKMLSchemaData(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2"><Document><Folder>
+  <Placemark>
+    <name>Base</name>
+    <ExtendedData><SchemaData schemaUrl="#zonas">
+      <SimpleData name="DWELL_SECONDS">120</SimpleData>
+    </SchemaData></ExtendedData>
+    <Polygon><outerBoundaryIs><LinearRing>
+      <coordinates>-99.1,19.4,0 -99.0,19.4,0 -99.0,19.5,0 -99.1,19.4,0</coordinates>
+    </LinearRing></outerBoundaryIs></Polygon>
+  </Placemark>
+  <Placemark><name>Sin forma</name></Placemark>
+</Folder></Document></kml>`
+
+	features, err := Decode(KML, []byte(doc))
+	require.NoError(t, err)
+	require.Len(t, features, 2)
+
+	assert.Equal(t, "Base", features[0].Name)
+	assert.Equal(t, "120", features[0].Properties["dwell_seconds"])
+	assert.JSONEq(t, `{"type":"Polygon","coordinates":[[[-99.1,19.4],[-99,19.4],[-99,19.5],[-99.1,19.4]]]}`, string(features[0].Geometry))
+
+	// Una Placemark sin geometría no invalida el archivo.
+	assert.Equal(t, "Sin forma", features[1].Name)
+	assert.Error(t, features[1].Err)
+}
+
+func TestDecodeRejectsWholeFile(t *testing.T) {
+	_, err := Decode(GeoJSON, []byte(`{"type":"Feature","geometry":null}`))
+	assert.EqualError(t, err, "Se esperaba un GeoJSON FeatureCollection")
+
+	_, err = Decode(Shapefile, []byte("PK\x03\x04 roto"))
+	assert.Error(t, err)
+
+	_, err = Decode("gpx", nil)
+	assert.Equal(t, errUnknownFormat, err)
+
+	assert.Equal(t, "", Detect([]byte("nombre,lat,lng")))
+}
@@ -0,0 +1,59 @@
+package geoformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+func decodeGeoJSON(data []byte) ([]Feature, error) {
+	var fc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Properties map[string]interface{} `json:"properties"`
+			Geometry   json.RawMessage        `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("El GeoJSON no es válido: %v", err)
+	}
+	if fc.Type != "FeatureCollection" {
+		return nil, errors.New("Se esperaba un GeoJSON FeatureCollection")
+	}
+
+	features := make([]Feature, 0, len(fc.Features))
+	for _, in := range fc.Features {
+		f := newFeature(in.Properties)
+		if len(in.Geometry) == 0 || bytes.Equal(in.Geometry, []byte("null")) {
+			f.Err = errors.New("La feature no tiene geometría")
+		} else {
+			f.Geometry = in.Geometry
+		}
+		features = append(features, f)
+	}
+	return features, nil
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Properties map[string]interface{} `json:"properties"`
+	Geometry   json.RawMessage        `json:"geometry"`
+}
+
+func encodeGeoJSON(w io.Writer, features []Feature) error {
+	out := struct {
+		Type     string           `json:"type"`
+		Features []geoJSONFeature `json:"features"`
+	}{Type: "FeatureCollection", Features: make([]geoJSONFeature, 0, len(features))}
+
+	for _, f := range features {
+		props := map[string]interface{}{"name": f.Name}
+		for k, v := range f.Properties {
+			props[k] = v
+		}
+		out.Features = append(out.Features, geoJSONFeature{Type: "Feature", Properties: props, Geometry: f.Geometry})
+	}
+	return json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,290 @@
+package geoformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const kmlNamespace = "http://www.opengis.net/kml/2.2"
+
+type kmlPlacemark struct {
+	Name          string            `xml:"name"`
+	ExtendedData  *kmlExtendedData  `xml:"ExtendedData"`
+	Polygon       *kmlPolygon       `xml:"Polygon"`
+	MultiGeometry *kmlMultiGeometry `xml:"MultiGeometry"`
+	Point         *kmlCoordinates   `xml:"Point"`
+	LineString    *kmlCoordinates   `xml:"LineString"`
+}
+
+// kmlExtendedData acepta los atributos como los escribe Google Earth (Data)
+// y como los exporta QGIS (SchemaData/SimpleData).
+type kmlExtendedData struct {
+	Data       []kmlData       `xml:"Data"`
+	SchemaData []kmlSchemaData `xml:"SchemaData"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlSchemaData struct {
+	SimpleData []kmlSimpleData `xml:"SimpleData"`
+}
+
+type kmlSimpleData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+type kmlPolygon struct {
+	Outer kmlBoundary   `xml:"outerBoundaryIs"`
+	Inner []kmlBoundary `xml:"innerBoundaryIs"`
+}
+
+type kmlBoundary struct {
+	Ring kmlCoordinates `xml:"LinearRing"`
+}
+
+type kmlCoordinates struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlMultiGeometry struct {
+	Polygons []kmlPolygon `xml:"Polygon"`
+	// Points y Lines solo se leen para rechazarlos: una zona no mezcla tipos.
+	Points []kmlCoordinates `xml:"Point"`
+	Lines  []kmlCoordinates `xml:"LineString"`
+}
+
+type kmlDocument struct {
+	XMLName  xml.Name `xml:"kml"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Document struct {
+		Name       string         `xml:"name"`
+		Placemarks []kmlPlacemark `xml:"Placemark"`
+	} `xml:"Document"`
+}
+
+// decodeKML recorre el documento buscando Placemarks a cualquier
+// profundidad (Document, Folder...).
+func decodeKML(data []byte) ([]Feature, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	var features []Feature
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("El KML no es válido: %v", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "Placemark" {
+			continue
+		}
+
+		var p kmlPlacemark
+		if err := dec.DecodeElement(&p, &start); err != nil {
+			return nil, fmt.Errorf("El KML no es válido: %v", err)
+		}
+		features = append(features, p.feature())
+	}
+	if features == nil {
+		return nil, errors.New("El KML no tiene Placemarks")
+	}
+	return features, nil
+}
+
+func (p kmlPlacemark) feature() Feature {
+	props := map[string]interface{}{}
+	if p.ExtendedData != nil {
+		for _, d := range p.ExtendedData.Data {
+			props[d.Name] = strings.TrimSpace(d.Value)
+		}
+		for _, schema := range p.ExtendedData.SchemaData {
+			for _, d := range schema.SimpleData {
+				props[d.Name] = strings.TrimSpace(d.Value)
+			}
+		}
+	}
+
+	f := newFeature(props)
+	if name := strings.TrimSpace(p.Name); name != "" {
+		f.Name = name
+	}
+	f.Geometry, f.Err = p.geometry()
+	return f
+}
+
+func (p kmlPlacemark) geometry() (json.RawMessage, error) {
+	switch {
+	case p.Polygon != nil:
+		rings, err := p.Polygon.rings()
+		if err != nil {
+			return nil, err
+		}
+		return polygonGeometry([][][][]float64{rings}), nil
+
+	case p.MultiGeometry != nil:
+		m := p.MultiGeometry
+		if len(m.Points) > 0 || len(m.Lines) > 0 {
+			return nil, errors.New("MultiGeometry solo puede contener Polygons")
+		}
+		if len(m.Polygons) == 0 {
+			return nil, errors.New("MultiGeometry sin Polygons")
+		}
+		polys := make([][][][]float64, 0, len(m.Polygons))
+		for i, polygon := range m.Polygons {
+			rings, err := polygon.rings()
+			if err != nil {
+				return nil, fmt.Errorf("polígono %d: %v", i+1, err)
+			}
+			polys = append(polys, rings)
+		}
+		return polygonGeometry(polys), nil
+
+	case p.Point != nil:
+		coords, err := parseKMLCoordinates(p.Point.Coordinates)
+		if err != nil {
+			return nil, err
+		}
+		if len(coords) != 1 {
+			return nil, errors.New("Un Point debe tener una sola coordenada")
+		}
+		return json.Marshal(map[string]interface{}{"type": "Point", "coordinates": coords[0]})
+
+	case p.LineString != nil:
+		coords, err := parseKMLCoordinates(p.LineString.Coordinates)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]interface{}{"type": "LineString", "coordinates": coords})
+
+	default:
+		return nil, errors.New("La Placemark no tiene geometría soportada (Polygon, MultiGeometry, Point o LineString)")
+	}
+}
+
+func (p kmlPolygon) rings() ([][][]float64, error) {
+	outer, err := parseKMLCoordinates(p.Outer.Ring.Coordinates)
+	if err != nil {
+		return nil, fmt.Errorf("anillo exterior: %v", err)
+	}
+	rings := [][][]float64{outer}
+	for i, inner := range p.Inner {
+		hole, err := parseKMLCoordinates(inner.Ring.Coordinates)
+		if err != nil {
+			return nil, fmt.Errorf("hueco %d: %v", i+1, err)
+		}
+		rings = append(rings, hole)
+	}
+	return rings, nil
+}
+
+// parseKMLCoordinates lee tuplas "lng,lat[,alt]" separadas por espacios; la
+// altitud se descarta.
+func parseKMLCoordinates(s string) ([][]float64, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, errors.New("sin coordenadas")
+	}
+	coords := make([][]float64, 0, len(fields))
+	for _, tuple := range fields {
+		parts := strings.Split(tuple, ",")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("coordenada inválida %q", tuple)
+		}
+		lng, err1 := strconv.ParseFloat(parts[0], 64)
+		lat, err2 := strconv.ParseFloat(parts[1], 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("coordenada inválida %q", tuple)
+		}
+		coords = append(coords, []float64{lng, lat})
+	}
+	return coords, nil
+}
+
+func encodeKML(w io.Writer, features []Feature) error {
+	doc := kmlDocument{Xmlns: kmlNamespace}
+	doc.Document.Name = "Geocercas"
+
+	for _, f := range features {
+		polys, err := polygons(f.Geometry)
+		if err != nil {
+			return fmt.Errorf("%s: %v", f.Name, err)
+		}
+
+		p := kmlPlacemark{Name: f.Name}
+		if len(f.Properties) > 0 {
+			p.ExtendedData = &kmlExtendedData{}
+			for _, k := range sortedKeys(f.Properties) {
+				p.ExtendedData.Data = append(p.ExtendedData.Data, kmlData{Name: k, Value: formatValue(f.Properties[k])})
+			}
+		}
+		if len(polys) == 1 {
+			polygon := kmlPolygonOf(polys[0])
+			p.Polygon = &polygon
+		} else {
+			p.MultiGeometry = &kmlMultiGeometry{}
+			for _, rings := range polys {
+				p.MultiGeometry.Polygons = append(p.MultiGeometry.Polygons, kmlPolygonOf(rings))
+			}
+		}
+		doc.Document.Placemarks = append(doc.Document.Placemarks, p)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(doc)
+}
+
+func kmlPolygonOf(rings [][][]float64) kmlPolygon {
+	p := kmlPolygon{Outer: kmlBoundary{Ring: kmlCoordinates{formatKMLCoordinates(rings[0])}}}
+	for _, hole := range rings[1:] {
+		p.Inner = append(p.Inner, kmlBoundary{Ring: kmlCoordinates{formatKMLCoordinates(hole)}})
+	}
+	return p
+}
+
+func formatKMLCoordinates(ring [][]float64) string {
+	tuples := make([]string, len(ring))
+	for i, c := range ring {
+		tuples[i] = strconv.FormatFloat(c[0], 'f', -1, 64) + "," + strconv.FormatFloat(c[1], 'f', -1, 64)
+	}
+	return strings.Join(tuples, " ")
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatValue escribe un atributo como texto, sin notación científica.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	default:
+		return fmt.Sprint(v)
+	}
+}
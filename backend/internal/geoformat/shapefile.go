@@ -0,0 +1,655 @@
+package geoformat
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Formato ESRI Shapefile: .shp (geometrías), .shx (índice), .dbf (atributos)
+// y .prj (proyección), comprimidos juntos en un zip. Solo se leen tipos 2D;
+// en los Z y M se ignoran las medidas extra.
+const (
+	shpFileCode = 9994
+	shpVersion  = 1000
+
+	shpNull     = 0
+	shpPoint    = 1
+	shpPolyLine = 3
+	shpPolygon  = 5
+
+	shpHeaderSize = 100
+	// maxShapefilePart acota lo que se descomprime de cada archivo del zip.
+	maxShapefilePart = 64 << 20
+
+	wgs84WKT = `GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]]`
+)
+
+// dbfNames traduce los atributos de una zona a nombres de columna DBF, que
+// tienen como máximo 10 caracteres.
+var dbfNames = map[string]string{
+	"name":                 "NAME",
+	"id":                   "ID",
+	"shape":                "SHAPE",
+	"dwell_seconds":        "DWELL_SEC",
+	"min_fixes":            "MIN_FIXES",
+	"min_duration_seconds": "MIN_DUR_S",
+	"exit_buffer_meters":   "EXIT_BUF_M",
+	"speed_limit_kmh":      "SPEED_KMH",
+	"radius_meters":        "RADIUS_M",
+	"width_meters":         "WIDTH_M",
+	"description":          "DESCRIPT",
+	"color":                "COLOR",
+	"category":             "CATEGORY",
+	"tags":                 "TAGS",
+	"properties":           "PROPS",
+}
+
+func propertyName(column string) string {
+	for prop, col := range dbfNames {
+		if strings.EqualFold(col, column) {
+			return prop
+		}
+	}
+	return strings.ToLower(column)
+}
+
+func decodeShapefile(data []byte) ([]Feature, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("El zip no es válido: %v", err)
+	}
+
+	files := map[string]*zip.File{}
+	var base string
+	for _, f := range zr.File {
+		ext := strings.ToLower(path.Ext(f.Name))
+		stem := strings.ToLower(strings.TrimSuffix(f.Name, path.Ext(f.Name)))
+		files[stem+ext] = f
+		if ext == ".shp" && base == "" {
+			base = stem
+		}
+	}
+	if base == "" {
+		return nil, errors.New("El zip no contiene un archivo .shp")
+	}
+	if files[base+".dbf"] == nil {
+		return nil, fmt.Errorf("Falta %s.dbf con los atributos", path.Base(base))
+	}
+
+	if prj := files[base+".prj"]; prj != nil {
+		wkt, err := readZipFile(prj)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Contains(bytes.ToUpper(wkt), []byte("PROJCS")) {
+			return nil, errors.New("El shapefile está proyectado: expórtelo en WGS84 (EPSG:4326)")
+		}
+	}
+
+	shp, err := readZipFile(files[base+".shp"])
+	if err != nil {
+		return nil, err
+	}
+	dbf, err := readZipFile(files[base+".dbf"])
+	if err != nil {
+		return nil, err
+	}
+
+	geometries, err := parseShp(shp)
+	if err != nil {
+		return nil, err
+	}
+	rows, deleted, err := parseDBF(dbf)
+	if err != nil {
+		return nil, err
+	}
+
+	features := make([]Feature, 0, len(geometries))
+	for i, g := range geometries {
+		var props map[string]interface{}
+		if i < len(rows) {
+			if deleted[i] {
+				continue
+			}
+			props = rows[i]
+		}
+		f := newFeature(props)
+		f.Geometry, f.Err = g.geometry, g.err
+		features = append(features, f)
+	}
+	return features, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("No se pudo leer %s: %v", f.Name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxShapefilePart+1))
+	if err != nil {
+		return nil, fmt.Errorf("No se pudo leer %s: %v", f.Name, err)
+	}
+	if len(data) > maxShapefilePart {
+		return nil, fmt.Errorf("%s es demasiado grande", f.Name)
+	}
+	return data, nil
+}
+
+type shpRecord struct {
+	geometry json.RawMessage
+	err      error
+}
+
+func parseShp(data []byte) ([]shpRecord, error) {
+	if len(data) < shpHeaderSize || binary.BigEndian.Uint32(data[0:4]) != shpFileCode {
+		return nil, errors.New("El .shp no es válido")
+	}
+
+	var records []shpRecord
+	for off := shpHeaderSize; off+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[off+4:off+8])) * 2
+		off += 8
+		if off+length > len(data) {
+			return nil, errors.New("El .shp está truncado")
+		}
+		g, err := shpGeometry(data[off : off+length])
+		records = append(records, shpRecord{geometry: g, err: err})
+		off += length
+	}
+	return records, nil
+}
+
+func shpGeometry(content []byte) (json.RawMessage, error) {
+	if len(content) < 4 {
+		return nil, errors.New("Registro vacío")
+	}
+	shapeType := int(binary.LittleEndian.Uint32(content[0:4]))
+
+	// Z (1x) y M (2x) comparten el prefijo 2D del tipo base.
+	switch shapeType % 10 {
+	case shpNull:
+		if shapeType == shpNull {
+			return nil, errors.New("Registro sin geometría")
+		}
+	case shpPoint:
+		if len(content) < 20 {
+			return nil, errors.New("Point truncado")
+		}
+		return json.Marshal(map[string]interface{}{"type": "Point", "coordinates": []float64{le64(content[4:]), le64(content[12:])}})
+	case shpPolyLine, shpPolygon:
+		rings, err := shpParts(content)
+		if err != nil {
+			return nil, err
+		}
+		if shapeType%10 == shpPolyLine {
+			if len(rings) != 1 {
+				return nil, errors.New("Solo se admiten líneas de una parte")
+			}
+			return json.Marshal(map[string]interface{}{"type": "LineString", "coordinates": rings[0]})
+		}
+		return polygonGeometry(assemblePolygons(rings)), nil
+	}
+	return nil, fmt.Errorf("Tipo de shapefile %d no soportado: use polígonos, puntos o líneas", shapeType)
+}
+
+// shpParts lee las partes (anillos o líneas) de un PolyLine o Polygon.
+func shpParts(content []byte) ([][][]float64, error) {
+	if len(content) < 44 {
+		return nil, errors.New("Registro truncado")
+	}
+	numParts := int(int32(binary.LittleEndian.Uint32(content[36:40])))
+	numPoints := int(int32(binary.LittleEndian.Uint32(content[40:44])))
+	pointsOff := 44 + 4*numParts
+	if numParts <= 0 || numPoints <= 0 || pointsOff+16*numPoints > len(content) {
+		return nil, errors.New("Registro truncado")
+	}
+
+	parts := make([][][]float64, numParts)
+	for i := range parts {
+		start := int(int32(binary.LittleEndian.Uint32(content[44+4*i:])))
+		end := numPoints
+		if i+1 < numParts {
+			end = int(int32(binary.LittleEndian.Uint32(content[44+4*(i+1):])))
+		}
+		if start < 0 || end > numPoints || start >= end {
+			return nil, errors.New("Partes inválidas en el registro")
+		}
+		for p := start; p < end; p++ {
+			at := pointsOff + 16*p
+			parts[i] = append(parts[i], []float64{le64(content[at:]), le64(content[at+8:])})
+		}
+	}
+	return parts, nil
+}
+
+// assemblePolygons agrupa anillos de shapefile (exteriores en sentido
+// horario, huecos antihorario) en polígonos GeoJSON con la orientación de
+// RFC 7946. Un hueco que no cae en ningún exterior se toma como exterior.
+func assemblePolygons(rings [][][]float64) [][][][]float64 {
+	var polys [][][][]float64
+	var holes [][][]float64
+	for _, ring := range rings {
+		if signedArea(ring) < 0 {
+			polys = append(polys, [][][]float64{reversed(ring)})
+		} else {
+			holes = append(holes, ring)
+		}
+	}
+
+	for _, hole := range holes {
+		placed := false
+		for i := range polys {
+			if pointInRing(hole[0], polys[i][0]) {
+				polys[i] = append(polys[i], reversed(hole))
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			polys = append(polys, [][][]float64{hole})
+		}
+	}
+	return polys
+}
+
+// signedArea es positiva si el anillo va en sentido antihorario.
+func signedArea(ring [][]float64) float64 {
+	var sum float64
+	for i := 0; i+1 < len(ring); i++ {
+		sum += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	return sum / 2
+}
+
+func pointInRing(p []float64, ring [][]float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > p[1]) != (b[1] > p[1]) && p[0] < (b[0]-a[0])*(p[1]-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+func reversed(ring [][]float64) [][]float64 {
+	out := make([][]float64, len(ring))
+	for i, c := range ring {
+		out[len(ring)-1-i] = c
+	}
+	return out
+}
+
+func le64(b []byte) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(b))
+}
+
+type dbfField struct {
+	name     string
+	kind     byte
+	length   int
+	decimals int
+}
+
+// parseDBF devuelve una fila de atributos por registro y cuáles están
+// marcados como borrados.
+func parseDBF(data []byte) ([]map[string]interface{}, []bool, error) {
+	if len(data) < 32 {
+		return nil, nil, errors.New("El .dbf no es válido")
+	}
+	numRecords := int(binary.LittleEndian.Uint32(data[4:8]))
+	headerLen := int(binary.LittleEndian.Uint16(data[8:10]))
+	recordLen := int(binary.LittleEndian.Uint16(data[10:12]))
+	if headerLen > len(data) {
+		return nil, nil, errors.New("El .dbf no es válido")
+	}
+
+	var fields []dbfField
+	for off := 32; off+32 <= headerLen && data[off] != 0x0D; off += 32 {
+		name := data[off : off+11]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		fields = append(fields, dbfField{
+			name:   strings.TrimSpace(string(name)),
+			kind:   data[off+11],
+			length: int(data[off+16]),
+		})
+	}
+
+	rows := make([]map[string]interface{}, 0, numRecords)
+	deleted := make([]bool, 0, numRecords)
+	for i := 0; i < numRecords; i++ {
+		start := headerLen + i*recordLen
+		if start+recordLen > len(data) {
+			return nil, nil, errors.New("El .dbf está truncado")
+		}
+		rec := data[start : start+recordLen]
+
+		row := make(map[string]interface{}, len(fields))
+		pos := 1
+		for _, f := range fields {
+			if pos+f.length > len(rec) {
+				break
+			}
+			row[propertyName(f.name)] = dbfValue(f.kind, rec[pos:pos+f.length])
+			pos += f.length
+		}
+		rows = append(rows, row)
+		deleted = append(deleted, rec[0] == '*')
+	}
+	return rows, deleted, nil
+}
+
+func dbfValue(kind byte, raw []byte) interface{} {
+	s := strings.TrimSpace(dbfString(raw))
+	switch kind {
+	case 'N', 'F':
+		if s == "" {
+			return nil
+		}
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			return v
+		}
+	case 'L':
+		switch s {
+		case "T", "t", "Y", "y":
+			return true
+		case "F", "f", "N", "n":
+			return false
+		}
+		return nil
+	}
+	return s
+}
+
+// dbfString lee texto UTF-8; si no lo es, lo toma como Latin-1, que es lo
+// que escriben muchas herramientas sin .cpg.
+func dbfString(raw []byte) string {
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+	runes := make([]rune, len(raw))
+	for i, b := range raw {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+func encodeShapefile(w io.Writer, features []Feature) error {
+	var records [][]byte
+	box := newBBox()
+	for _, f := range features {
+		polys, err := polygons(f.Geometry)
+		if err != nil {
+			return fmt.Errorf("%s: %v", f.Name, err)
+		}
+		records = append(records, shpPolygonRecord(polys, box))
+	}
+
+	shp, shx := shpFiles(records, box)
+	dbf := dbfFile(features)
+
+	zw := zip.NewWriter(w)
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{"geofences.shp", shp},
+		{"geofences.shx", shx},
+		{"geofences.dbf", dbf},
+		{"geofences.prj", []byte(wgs84WKT)},
+		{"geofences.cpg", []byte("UTF-8")},
+	} {
+		fw, err := zw.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(file.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+type bbox struct{ minX, minY, maxX, maxY float64 }
+
+func newBBox() *bbox {
+	return &bbox{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+}
+
+func (b *bbox) add(c []float64) {
+	b.minX, b.maxX = math.Min(b.minX, c[0]), math.Max(b.maxX, c[0])
+	b.minY, b.maxY = math.Min(b.minY, c[1]), math.Max(b.maxY, c[1])
+}
+
+func (b *bbox) put(buf []byte) {
+	if math.IsInf(b.minX, 0) {
+		return
+	}
+	for i, v := range []float64{b.minX, b.minY, b.maxX, b.maxY} {
+		binary.LittleEndian.PutUint64(buf[8*i:], math.Float64bits(v))
+	}
+}
+
+// shpPolygonRecord arma el contenido de un registro Polygon con los
+// exteriores en sentido horario y los huecos antihorario.
+func shpPolygonRecord(polys [][][][]float64, total *bbox) []byte {
+	var rings [][][]float64
+	for _, poly := range polys {
+		for i, ring := range poly {
+			clockwise := signedArea(ring) < 0
+			if (i == 0) != clockwise {
+				ring = reversed(ring)
+			}
+			rings = append(rings, ring)
+		}
+	}
+
+	numPoints := 0
+	for _, ring := range rings {
+		numPoints += len(ring)
+	}
+	buf := make([]byte, 44+4*len(rings)+16*numPoints)
+	binary.LittleEndian.PutUint32(buf[0:], shpPolygon)
+	binary.LittleEndian.PutUint32(buf[36:], uint32(len(rings)))
+	binary.LittleEndian.PutUint32(buf[40:], uint32(numPoints))
+
+	box := newBBox()
+	at, index := 44+4*len(rings), 0
+	for i, ring := range rings {
+		binary.LittleEndian.PutUint32(buf[44+4*i:], uint32(index))
+		for _, c := range ring {
+			binary.LittleEndian.PutUint64(buf[at:], math.Float64bits(c[0]))
+			binary.LittleEndian.PutUint64(buf[at+8:], math.Float64bits(c[1]))
+			box.add(c)
+			total.add(c)
+			at += 16
+		}
+		index += len(ring)
+	}
+	box.put(buf[4:36])
+	return buf
+}
+
+func shpFiles(records [][]byte, box *bbox) (shp, shx []byte) {
+	shpWords := shpHeaderSize / 2
+	for _, r := range records {
+		shpWords += 4 + len(r)/2
+	}
+	shp = shpHeader(shpWords, box)
+	shx = shpHeader(shpHeaderSize/2+4*len(records), box)
+
+	offset := shpHeaderSize / 2
+	for i, r := range records {
+		var head [8]byte
+		binary.BigEndian.PutUint32(head[0:], uint32(i+1))
+		binary.BigEndian.PutUint32(head[4:], uint32(len(r)/2))
+		shp = append(append(shp, head[:]...), r...)
+
+		var index [8]byte
+		binary.BigEndian.PutUint32(index[0:], uint32(offset))
+		binary.BigEndian.PutUint32(index[4:], uint32(len(r)/2))
+		shx = append(shx, index[:]...)
+		offset += 4 + len(r)/2
+	}
+	return shp, shx
+}
+
+func shpHeader(words int, box *bbox) []byte {
+	h := make([]byte, shpHeaderSize)
+	binary.BigEndian.PutUint32(h[0:], shpFileCode)
+	binary.BigEndian.PutUint32(h[24:], uint32(words))
+	binary.LittleEndian.PutUint32(h[28:], shpVersion)
+	binary.LittleEndian.PutUint32(h[32:], shpPolygon)
+	box.put(h[36:68])
+	return h
+}
+
+// dbfFile escribe NAME y luego un campo por atributo: numérico si todos los
+// valores lo son, texto si no.
+func dbfFile(features []Feature) []byte {
+	keys := map[string]bool{}
+	for _, f := range features {
+		for k := range f.Properties {
+			keys[k] = true
+		}
+	}
+	props := []string{"name"}
+	for _, k := range sortedKeys(toSet(keys)) {
+		if k != "name" {
+			props = append(props, k)
+		}
+	}
+
+	value := func(f Feature, prop string) interface{} {
+		if prop == "name" {
+			return f.Name
+		}
+		return f.Properties[prop]
+	}
+
+	used := map[string]bool{}
+	fields := make([]dbfField, len(props))
+	for i, prop := range props {
+		field := dbfField{name: dbfColumn(prop, used), kind: 'N', length: 19}
+		for _, f := range features {
+			switch v := value(f, prop).(type) {
+			case nil:
+			case float64:
+				field.decimals = max(field.decimals, decimals(v))
+			case int, int32, int64:
+			default:
+				field.kind = 'C'
+			}
+		}
+		if field.kind == 'C' {
+			field.length, field.decimals = 1, 0
+			for _, f := range features {
+				field.length = max(field.length, min(len(formatValue(value(f, prop))), 254))
+			}
+		}
+		fields[i] = field
+	}
+
+	recordLen := 1
+	for _, f := range fields {
+		recordLen += f.length
+	}
+	headerLen := 32 + 32*len(fields) + 1
+
+	now := time.Now()
+	buf := make([]byte, headerLen, headerLen+recordLen*len(features)+1)
+	buf[0] = 0x03
+	buf[1], buf[2], buf[3] = byte(now.Year()-1900), byte(now.Month()), byte(now.Day())
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(features)))
+	binary.LittleEndian.PutUint16(buf[8:], uint16(headerLen))
+	binary.LittleEndian.PutUint16(buf[10:], uint16(recordLen))
+	for i, f := range fields {
+		d := buf[32+32*i:]
+		copy(d[0:11], f.name)
+		d[11] = f.kind
+		d[16] = byte(f.length)
+		d[17] = byte(f.decimals)
+	}
+	buf[headerLen-1] = 0x0D
+
+	for _, f := range features {
+		buf = append(buf, ' ')
+		for i, field := range fields {
+			buf = append(buf, dbfCell(field, value(f, props[i]))...)
+		}
+	}
+	return append(buf, 0x1A)
+}
+
+func dbfCell(field dbfField, v interface{}) []byte {
+	var s string
+	if v != nil {
+		if n, ok := v.(float64); ok && field.kind == 'N' {
+			s = strconv.FormatFloat(n, 'f', field.decimals, 64)
+		} else {
+			s = formatValue(v)
+		}
+	}
+
+	if field.kind == 'N' {
+		if len(s) > field.length {
+			return bytes.Repeat([]byte("*"), field.length)
+		}
+		return []byte(strings.Repeat(" ", field.length-len(s)) + s)
+	}
+	// Se corta en un límite de runa para no dejar UTF-8 inválido.
+	for len(s) > field.length {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	return []byte(s + strings.Repeat(" ", field.length-len(s)))
+}
+
+// dbfColumn devuelve un nombre de columna de hasta 10 caracteres que no se
+// repita.
+func dbfColumn(prop string, used map[string]bool) string {
+	name, ok := dbfNames[prop]
+	if !ok {
+		name = strings.ToUpper(prop)
+		if len(name) > 10 {
+			name = name[:10]
+		}
+	}
+	for n := 1; used[name]; n++ {
+		suffix := strconv.Itoa(n)
+		name = name[:min(len(name), 10-len(suffix))] + suffix
+	}
+	used[name] = true
+	return name
+}
+
+func decimals(v float64) int {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return min(len(s)-i-1, 8)
+	}
+	return 0
+}
+
+func toSet(m map[string]bool) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k := range m {
+		out[k] = nil
+	}
+	return out
+}
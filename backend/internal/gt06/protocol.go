@@ -0,0 +1,192 @@
+package gt06
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Estructura de un paquete GT06:
+//
+//	0x78 0x78 | len(1) | protocolo(1) | contenido | serial(2) | crc(2) | 0x0D 0x0A
+//
+// Los paquetes extendidos empiezan con 0x79 0x79 y usan len de 2 bytes. len
+// cuenta desde el protocolo hasta el CRC inclusive, y el CRC-ITU se calcula
+// desde len hasta el serial.
+const (
+	ProtocolLogin     byte = 0x01
+	ProtocolGPS       byte = 0x10
+	ProtocolGPSLBS    byte = 0x12
+	ProtocolHeartbeat byte = 0x13
+	ProtocolAlarm     byte = 0x16
+	ProtocolGPSLBS2   byte = 0x22
+)
+
+var (
+	ErrBadStart    = errors.New("gt06: bits de inicio inválidos")
+	ErrBadStop     = errors.New("gt06: bits de fin inválidos")
+	ErrBadCRC      = errors.New("gt06: CRC inválido")
+	ErrShortPacket = errors.New("gt06: paquete incompleto")
+)
+
+type Packet struct {
+	Protocol byte
+	Content  []byte
+	Serial   uint16
+	// Extended indica que llegó con el encabezado 0x79 0x79.
+	Extended bool
+}
+
+// Position es la parte GPS compartida por los paquetes de ubicación y alarma.
+type Position struct {
+	Time       time.Time
+	Satellites int
+	Latitude   float64
+	Longitude  float64
+	Speed      float64
+	Course     float64
+	Valid      bool
+}
+
+// ParseFrame extrae un paquete del inicio de buf y devuelve cuántos bytes
+// consumió. Si el frame aún no está completo devuelve ErrShortPacket.
+func ParseFrame(buf []byte) (Packet, int, error) {
+	if len(buf) < 2 {
+		return Packet{}, 0, ErrShortPacket
+	}
+
+	var lenSize int
+	switch {
+	case buf[0] == 0x78 && buf[1] == 0x78:
+		lenSize = 1
+	case buf[0] == 0x79 && buf[1] == 0x79:
+		lenSize = 2
+	default:
+		return Packet{}, 0, ErrBadStart
+	}
+
+	if len(buf) < 2+lenSize {
+		return Packet{}, 0, ErrShortPacket
+	}
+
+	var length int
+	if lenSize == 1 {
+		length = int(buf[2])
+	} else {
+		length = int(binary.BigEndian.Uint16(buf[2:4]))
+	}
+
+	// protocolo + serial + crc como mínimo
+	if length < 5 {
+		return Packet{}, 0, ErrBadStart
+	}
+
+	total := 2 + lenSize + length + 2
+	if len(buf) < total {
+		return Packet{}, 0, ErrShortPacket
+	}
+
+	if buf[total-2] != 0x0D || buf[total-1] != 0x0A {
+		return Packet{}, total, ErrBadStop
+	}
+
+	crcEnd := total - 4
+	want := binary.BigEndian.Uint16(buf[crcEnd : crcEnd+2])
+	if CRCITU(buf[2:crcEnd]) != want {
+		return Packet{}, total, ErrBadCRC
+	}
+
+	body := buf[2+lenSize : crcEnd]
+	return Packet{
+		Protocol: body[0],
+		Content:  body[1 : len(body)-2],
+		Serial:   binary.BigEndian.Uint16(body[len(body)-2:]),
+		Extended: lenSize == 2,
+	}, total, nil
+}
+
+// Response arma el ACK estándar (protocolo + serial) que esperan los
+// terminales para login, heartbeat y alarmas. Se responde con el mismo
+// encabezado del paquete: algunos terminales descartan un ACK 0x78 a un
+// paquete 0x79.
+func Response(protocol byte, serial uint16, extended bool) []byte {
+	start := []byte{0x78, 0x78}
+	body := []byte{0x05}
+	if extended {
+		start = []byte{0x79, 0x79}
+		body = []byte{0x00, 0x05}
+	}
+	body = append(body, protocol, byte(serial>>8), byte(serial))
+	crc := CRCITU(body)
+
+	out := start
+	out = append(out, body...)
+	out = append(out, byte(crc>>8), byte(crc), 0x0D, 0x0A)
+	return out
+}
+
+// ParseLogin devuelve el IMEI del contenido de un paquete de login (8 bytes
+// BCD, con un cero a la izquierda).
+func ParseLogin(content []byte) (string, error) {
+	if len(content) < 8 {
+		return "", ErrShortPacket
+	}
+	imei := strings.TrimLeft(hex.EncodeToString(content[:8]), "0")
+	if imei == "" {
+		return "", errors.New("gt06: IMEI vacío")
+	}
+	return imei, nil
+}
+
+// ParsePosition decodifica el bloque GPS al inicio de los paquetes 0x10,
+// 0x12, 0x16 y 0x22.
+func ParsePosition(content []byte) (Position, error) {
+	if len(content) < 18 {
+		return Position{}, ErrShortPacket
+	}
+
+	ts := time.Date(
+		2000+int(content[0]), time.Month(content[1]), int(content[2]),
+		int(content[3]), int(content[4]), int(content[5]), 0, time.UTC,
+	)
+
+	lat := float64(binary.BigEndian.Uint32(content[7:11])) / 1800000
+	lng := float64(binary.BigEndian.Uint32(content[11:15])) / 1800000
+	courseStatus := binary.BigEndian.Uint16(content[16:18])
+
+	// bit 10: latitud norte; bit 11: longitud oeste
+	if courseStatus&(1<<10) == 0 {
+		lat = -lat
+	}
+	if courseStatus&(1<<11) != 0 {
+		lng = -lng
+	}
+
+	return Position{
+		Time:       ts,
+		Satellites: int(content[6] & 0x0F),
+		Latitude:   lat,
+		Longitude:  lng,
+		Speed:      float64(content[15]),
+		Course:     float64(courseStatus & 0x03FF),
+		Valid:      courseStatus&(1<<12) != 0,
+	}, nil
+}
+
+// CRCITU implementa CRC-16/X-25, el "CRC-ITU" del protocolo GT06.
+func CRCITU(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = (crc >> 1) ^ 0x8408
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return ^crc
+}
@@ -0,0 +1,98 @@
+package gt06_test
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AlexG695/geo-engine-core/internal/gt06"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestCRCITU(t *testing.T) {
+	assert.Equal(t, uint16(0x906E), gt06.CRCITU([]byte("123456789")))
+}
+
+func TestParseLoginPacket(t *testing.T) {
+	raw := mustHex(t, "78780D01012345678901234500018CDD0D0A")
+
+	packet, n, err := gt06.ParseFrame(raw)
+	require.NoError(t, err)
+	assert.Equal(t, len(raw), n)
+	assert.Equal(t, gt06.ProtocolLogin, packet.Protocol)
+	assert.Equal(t, uint16(1), packet.Serial)
+	assert.False(t, packet.Extended)
+
+	imei, err := gt06.ParseLogin(packet.Content)
+	require.NoError(t, err)
+	assert.Equal(t, "123456789012345", imei)
+
+	assert.Equal(t, mustHex(t, "787805010001D9DC0D0A"), gt06.Response(gt06.ProtocolLogin, packet.Serial, packet.Extended))
+}
+
+func TestExtendedFrameResponse(t *testing.T) {
+	ack := gt06.Response(gt06.ProtocolHeartbeat, 0x0102, true)
+	assert.Equal(t, mustHex(t, "79790005130102"), ack[:7])
+
+	packet, n, err := gt06.ParseFrame(ack)
+	require.NoError(t, err)
+	assert.Equal(t, len(ack), n)
+	assert.True(t, packet.Extended)
+	assert.Equal(t, gt06.ProtocolHeartbeat, packet.Protocol)
+	assert.Equal(t, uint16(0x0102), packet.Serial)
+}
+
+func TestParseLocationPacket(t *testing.T) {
+	raw := mustHex(t, "78781F120B081D112E10CC027AC7EB0C46584900148F01CC00287D001FB8000373770D0A")
+
+	packet, _, err := gt06.ParseFrame(raw)
+	require.NoError(t, err)
+	assert.Equal(t, gt06.ProtocolGPSLBS, packet.Protocol)
+	assert.Equal(t, uint16(3), packet.Serial)
+
+	pos, err := gt06.ParsePosition(packet.Content)
+	require.NoError(t, err)
+	assert.True(t, pos.Valid)
+	assert.Equal(t, 12, pos.Satellites)
+	assert.Equal(t, time.Date(2011, 8, 29, 17, 46, 16, 0, time.UTC), pos.Time)
+	assert.InDelta(t, 23.1116683, pos.Latitude, 1e-6)
+	assert.InDelta(t, 114.4092850, pos.Longitude, 1e-6)
+	assert.Equal(t, 0.0, pos.Speed)
+	assert.Equal(t, 143.0, pos.Course)
+}
+
+func TestParseFrameErrors(t *testing.T) {
+	login := mustHex(t, "78780D01012345678901234500018CDD0D0A")
+
+	_, _, err := gt06.ParseFrame(login[:10])
+	assert.ErrorIs(t, err, gt06.ErrShortPacket)
+
+	corrupted := append([]byte(nil), login...)
+	corrupted[5] ^= 0xFF
+	_, n, err := gt06.ParseFrame(corrupted)
+	assert.ErrorIs(t, err, gt06.ErrBadCRC)
+	assert.Equal(t, len(login), n)
+
+	_, _, err = gt06.ParseFrame(mustHex(t, "0102030405"))
+	assert.ErrorIs(t, err, gt06.ErrBadStart)
+}
+
+func TestParsePositionHemispheres(t *testing.T) {
+	// Chihuahua: latitud norte, longitud oeste.
+	content := mustHex(t, "1A010F0C1E00C9"+"03127DF4"+"0B61D194"+"3C"+"1C5A")
+
+	pos, err := gt06.ParsePosition(content)
+	require.NoError(t, err)
+	assert.Greater(t, pos.Latitude, 0.0)
+	assert.Less(t, pos.Longitude, 0.0)
+	assert.Equal(t, 60.0, pos.Speed)
+	assert.Equal(t, 90.0, pos.Course)
+}
@@ -0,0 +1,243 @@
+package gt06
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+	"go.uber.org/zap"
+)
+
+const (
+	// Los terminales mandan heartbeat cada pocos minutos; si no llega nada en
+	// este tiempo se asume la conexión muerta.
+	idleTimeout  = 10 * time.Minute
+	writeTimeout = 10 * time.Second
+	maxFrameSize = 1024
+)
+
+// Ingester es el camino de ingesta compartido con el endpoint HTTP.
+type Ingester interface {
+	Ingest(ctx context.Context, fix ingest.Fix) (ingest.Result, error)
+}
+
+// DeviceResolver traduce el IMEI del terminal al device_id de la plataforma.
+type DeviceResolver interface {
+	GetDeviceIDByIMEI(ctx context.Context, imei string) (string, error)
+}
+
+type Server struct {
+	addr         string
+	ingester     Ingester
+	devices      DeviceResolver
+	allowUnknown bool
+	logger       *zap.SugaredLogger
+
+	wg sync.WaitGroup
+}
+
+// NewServer crea el gateway TCP. Con allowUnknown los IMEI sin registro en
+// device_imeis se aceptan usando el propio IMEI como device_id.
+func NewServer(addr string, i Ingester, d DeviceResolver, allowUnknown bool, l *zap.SugaredLogger) *Server {
+	return &Server{
+		addr:         addr,
+		ingester:     i,
+		devices:      d,
+		allowUnknown: allowUnknown,
+		logger:       l,
+	}
+}
+
+// ListenAndServe acepta conexiones hasta que ctx se cancela y espera a que
+// terminen las sesiones abiertas.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	s.logger.Infow("Gateway GT06 iniciado", "addr", ln.Addr().String())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			s.logger.Warnw("Error aceptando conexión GT06", "error", err)
+			continue
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(ctx, conn)
+		}()
+	}
+
+	s.wg.Wait()
+	return nil
+}
+
+type session struct {
+	conn     net.Conn
+	imei     string
+	deviceID string
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	// Cerrar la conexión al cancelar desbloquea tanto la lectura como una
+	// escritura en curso; un deadline se perdería con el que se renueva en
+	// cada vuelta del loop.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	sess := &session{conn: conn}
+	chunk := make([]byte, maxFrameSize)
+	var buf []byte
+
+	for ctx.Err() == nil {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+
+		n, err := conn.Read(chunk)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				s.logger.Debugw("Conexión GT06 cerrada", "imei", sess.imei, "error", err)
+			}
+			return
+		}
+		buf = append(buf, chunk[:n]...)
+
+		for len(buf) > 0 {
+			packet, consumed, err := ParseFrame(buf)
+			if errors.Is(err, ErrShortPacket) {
+				break
+			}
+			if errors.Is(err, ErrBadStart) {
+				// Basura en el stream: resincronizar en el siguiente byte.
+				buf = buf[1:]
+				continue
+			}
+			buf = buf[consumed:]
+			if err != nil {
+				s.logger.Warnw("Paquete GT06 descartado", "imei", sess.imei, "error", err)
+				continue
+			}
+
+			if !s.handlePacket(ctx, sess, packet) {
+				return
+			}
+		}
+
+		if len(buf) > maxFrameSize {
+			s.logger.Warnw("Buffer GT06 excedido, cerrando conexión", "imei", sess.imei)
+			return
+		}
+	}
+}
+
+// handlePacket procesa un paquete y devuelve false si hay que cerrar la
+// conexión.
+func (s *Server) handlePacket(ctx context.Context, sess *session, p Packet) bool {
+	if p.Protocol != ProtocolLogin && sess.deviceID == "" {
+		s.logger.Warnw("Paquete GT06 antes del login", "protocol", p.Protocol, "remote", sess.conn.RemoteAddr().String())
+		return false
+	}
+
+	switch p.Protocol {
+	case ProtocolLogin:
+		imei, err := ParseLogin(p.Content)
+		if err != nil {
+			s.logger.Warnw("Login GT06 inválido", "error", err)
+			return false
+		}
+
+		deviceID, err := s.resolve(ctx, imei)
+		if err != nil {
+			s.logger.Warnw("IMEI rechazado", "imei", imei, "error", err)
+			return false
+		}
+
+		sess.imei = imei
+		sess.deviceID = deviceID
+		s.logger.Infow("Terminal GT06 conectado", "imei", imei, "device", deviceID)
+		return s.write(sess, Response(ProtocolLogin, p.Serial, p.Extended))
+
+	case ProtocolHeartbeat:
+		return s.write(sess, Response(ProtocolHeartbeat, p.Serial, p.Extended))
+
+	case ProtocolGPS, ProtocolGPSLBS, ProtocolGPSLBS2:
+		s.ingestPosition(ctx, sess, p)
+		return true
+
+	case ProtocolAlarm:
+		s.ingestPosition(ctx, sess, p)
+		return s.write(sess, Response(ProtocolAlarm, p.Serial, p.Extended))
+
+	default:
+		s.logger.Debugw("Protocolo GT06 no soportado", "protocol", p.Protocol, "imei", sess.imei)
+		return true
+	}
+}
+
+func (s *Server) ingestPosition(ctx context.Context, sess *session, p Packet) {
+	pos, err := ParsePosition(p.Content)
+	if err != nil {
+		s.logger.Warnw("Posición GT06 inválida", "imei", sess.imei, "error", err)
+		return
+	}
+
+	if !pos.Valid {
+		// Sin fix GPS el terminal reporta la última posición conocida.
+		return
+	}
+
+	recordedAt := pos.Time
+	_, err = s.ingester.Ingest(context.WithoutCancel(ctx), ingest.Fix{
+		DeviceID:   sess.deviceID,
+		Latitude:   pos.Latitude,
+		Longitude:  pos.Longitude,
+		Speed:      pos.Speed, // GT06 ya reporta km/h
+		Heading:    pos.Course,
+		RecordedAt: &recordedAt,
+	})
+	if err != nil {
+		s.logger.Warnw("Falló ingesta GT06", "imei", sess.imei, "device", sess.deviceID, "error", err)
+	}
+}
+
+func (s *Server) resolve(ctx context.Context, imei string) (string, error) {
+	deviceID, err := s.devices.GetDeviceIDByIMEI(ctx, imei)
+	if errors.Is(err, sql.ErrNoRows) && s.allowUnknown {
+		return imei, nil
+	}
+	return deviceID, err
+}
+
+func (s *Server) write(sess *session, msg []byte) bool {
+	sess.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := sess.conn.Write(msg); err != nil {
+		s.logger.Debugw("No se pudo responder al terminal GT06", "imei", sess.imei, "error", err)
+		return false
+	}
+	return true
+}
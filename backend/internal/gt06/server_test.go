@@ -0,0 +1,146 @@
+package gt06
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+)
+
+type fakeIngester struct {
+	mu    sync.Mutex
+	fixes []ingest.Fix
+}
+
+func (f *fakeIngester) Ingest(_ context.Context, fix ingest.Fix) (ingest.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fixes = append(f.fixes, fix)
+	return ingest.Result{ID: uuid.New(), DeviceID: fix.DeviceID}, nil
+}
+
+type fakeDevices map[string]string
+
+func (f fakeDevices) GetDeviceIDByIMEI(_ context.Context, imei string) (string, error) {
+	if id, ok := f[imei]; ok {
+		return id, nil
+	}
+	return "", sql.ErrNoRows
+}
+
+func replay(t *testing.T, conn net.Conn, dump string, expectReply bool) []byte {
+	raw, err := hex.DecodeString(dump)
+	require.NoError(t, err)
+
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Write(raw)
+	require.NoError(t, err)
+
+	if !expectReply {
+		return nil
+	}
+	reply := make([]byte, 64)
+	n, err := conn.Read(reply)
+	require.NoError(t, err)
+	return reply[:n]
+}
+
+func TestSessionReplay(t *testing.T) {
+	ingester := &fakeIngester{}
+	srv := NewServer("", ingester, fakeDevices{"123456789012345": "camion-07"}, false, zap.NewNop().Sugar())
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+	go func() {
+		srv.serveConn(context.Background(), server)
+		close(done)
+	}()
+
+	reply := replay(t, client, "78780D01012345678901234500018CDD0D0A", true)
+	assert.Equal(t, "787805010001d9dc0d0a", hex.EncodeToString(reply))
+
+	reply = replay(t, client, "78780A134004040001001125110D0A", true)
+	assert.Equal(t, Response(ProtocolHeartbeat, 0x0011, false), reply)
+
+	replay(t, client, "78781F120B081D112E10CC027AC7EB0C46584900148F01CC00287D001FB8000373770D0A", false)
+
+	client.Close()
+	<-done
+
+	require.Len(t, ingester.fixes, 1)
+	fix := ingester.fixes[0]
+	assert.Equal(t, "camion-07", fix.DeviceID)
+	assert.InDelta(t, 23.1116683, fix.Latitude, 1e-6)
+	require.NotNil(t, fix.RecordedAt)
+	assert.Equal(t, time.Date(2011, 8, 29, 17, 46, 16, 0, time.UTC), *fix.RecordedAt)
+}
+
+func TestSessionRejectsUnknownIMEI(t *testing.T) {
+	srv := NewServer("", &fakeIngester{}, fakeDevices{}, false, zap.NewNop().Sugar())
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	done := make(chan struct{})
+	go func() {
+		srv.serveConn(context.Background(), server)
+		close(done)
+	}()
+
+	replay(t, client, "78780D01012345678901234500018CDD0D0A", false)
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("la conexión debería cerrarse para un IMEI desconocido")
+	}
+}
+
+func TestSessionAnswersWithPacketFraming(t *testing.T) {
+	srv := NewServer("", &fakeIngester{}, fakeDevices{"123456789012345": "camion-07"}, false, zap.NewNop().Sugar())
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go srv.serveConn(context.Background(), server)
+
+	replay(t, client, "78780D01012345678901234500018CDD0D0A", true)
+
+	reply := replay(t, client, hex.EncodeToString(Response(ProtocolHeartbeat, 0x0022, true)), true)
+	assert.Equal(t, Response(ProtocolHeartbeat, 0x0022, true), reply)
+}
+
+func TestSessionClosesOnShutdown(t *testing.T) {
+	srv := NewServer("", &fakeIngester{}, fakeDevices{"123456789012345": "camion-07"}, false, zap.NewNop().Sugar())
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		srv.serveConn(ctx, server)
+		close(done)
+	}()
+
+	// Un terminal conectado pero callado no debe retener el apagado.
+	replay(t, client, "78780D01012345678901234500018CDD0D0A", true)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("la conexión debería cerrarse al cancelar el contexto")
+	}
+}
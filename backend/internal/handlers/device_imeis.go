@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+// maxIMEIDigits es el máximo que cabe en los 8 bytes BCD del login GT06.
+const maxIMEIDigits = 16
+
+type DeviceIMEIRequest struct {
+	DeviceID string `json:"device_id" binding:"required,max=255"`
+}
+
+// normalizeIMEI deja el IMEI como lo lee el gateway GT06 del paquete de
+// login: solo dígitos y sin ceros a la izquierda.
+func normalizeIMEI(s string) (string, error) {
+	imei := strings.TrimLeft(strings.TrimSpace(s), "0")
+	if imei == "" || len(imei) > maxIMEIDigits {
+		return "", errors.New("IMEI inválido: debe tener entre 1 y 16 dígitos")
+	}
+	for _, r := range imei {
+		if r < '0' || r > '9' {
+			return "", errors.New("IMEI inválido: solo se admiten dígitos")
+		}
+	}
+	return imei, nil
+}
+
+// ListDeviceIMEIs devuelve los IMEI registrados, opcionalmente de un solo
+// device_id.
+func (h *LocationHandler) ListDeviceIMEIs(c *gin.Context) {
+	deviceID := c.Query("device_id")
+	imeis, err := h.queries.ListDeviceIMEIs(c, sql.NullString{String: deviceID, Valid: deviceID != ""})
+	if err != nil {
+		h.logger.Errorw("Error listando IMEIs", "error", err)
+		c.JSON(500, gin.H{"error": "Error cargando IMEIs"})
+		return
+	}
+	if imeis == nil {
+		imeis = []database.DeviceImei{}
+	}
+	c.JSON(200, imeis)
+}
+
+// PutDeviceIMEI registra el IMEI de un terminal GT06 para el device_id del
+// body, o lo reasigna si ya existía. Sin este registro el gateway rechaza el
+// login del terminal (salvo GT06_ALLOW_UNKNOWN_IMEI).
+func (h *LocationHandler) PutDeviceIMEI(c *gin.Context) {
+	imei, err := normalizeIMEI(c.Param("imei"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	var req DeviceIMEIRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	mapping, err := h.queries.UpsertDeviceIMEI(c, database.UpsertDeviceIMEIParams{Imei: imei, DeviceID: req.DeviceID})
+	if err != nil {
+		h.logger.Errorw("Error registrando IMEI", "error", err)
+		c.JSON(500, gin.H{"error": "No se pudo registrar el IMEI"})
+		return
+	}
+	c.JSON(200, mapping)
+}
+
+func (h *LocationHandler) DeleteDeviceIMEI(c *gin.Context) {
+	imei, err := normalizeIMEI(c.Param("imei"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	deleted, err := h.queries.DeleteDeviceIMEI(c, imei)
+	if err != nil {
+		h.logger.Errorw("Error borrando IMEI", "error", err)
+		c.JSON(500, gin.H{"error": "No se pudo eliminar"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(404, gin.H{"error": "IMEI no registrado"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Eliminado"})
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeIMEI(t *testing.T) {
+	imei, err := normalizeIMEI(" 0123456789012345 ")
+	require.NoError(t, err)
+	assert.Equal(t, "123456789012345", imei, "igual que el login GT06, sin ceros a la izquierda")
+
+	for _, bad := range []string{"", "0000", "12345678901234567", "35-1234", "abc"} {
+		_, err := normalizeIMEI(bad)
+		assert.Error(t, err, bad)
+	}
+}
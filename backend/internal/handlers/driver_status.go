@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+	"github.com/gin-gonic/gin"
+)
+
+// GetDriverStatus devuelve el estado de disponibilidad del conductor;
+// offline si nunca tuvo uno.
+func (h *LocationHandler) GetDriverStatus(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	status, err := h.ingest.DriverStatus(c, deviceID)
+	if err != nil {
+		h.logger.Errorw("Error leyendo estado", "device", deviceID, "error", err)
+		c.JSON(500, gin.H{"error": "No se pudo leer el estado"})
+		return
+	}
+	c.JSON(200, gin.H{"device_id": deviceID, "status": status.Status, "since": status.Since})
+}
+
+// PutDriverStatus cambia el estado del conductor. Las transiciones no
+// permitidas (p. ej. de offline a busy) responden 409.
+func (h *LocationHandler) PutDriverStatus(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	var req struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateStatuses([]string{req.Status}); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := h.ingest.SetDriverStatus(c, deviceID, req.Status)
+	var transition *ingest.TransitionError
+	switch {
+	case errors.As(err, &transition), errors.Is(err, ingest.ErrStatusConflict):
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		h.logger.Errorw("Error cambiando estado", "device", deviceID, "error", err)
+		c.JSON(500, gin.H{"error": "No se pudo cambiar el estado"})
+		return
+	}
+	c.JSON(200, gin.H{"device_id": deviceID, "status": status.Status, "since": status.Since})
+}
@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultDriverLimit es cuántos conductores devuelve una búsqueda sin
+	// limit.
+	defaultDriverLimit = 100
+	// defaultNearestK es cuántos devuelve /drivers/nearest sin k.
+	defaultNearestK = 5
+	// maxWithinBody limita el GeoJSON de POST /drivers/within.
+	maxWithinBody = 1 << 20
+)
+
+// driverSearch son las opciones comunes de las búsquedas de conductores.
+type driverSearch struct {
+	Limit int `form:"limit" binding:"omitempty,min=1,max=1000"`
+	// Sort es "distance" (por defecto) o "last_seen", del más reciente al más
+	// viejo.
+	Sort string `form:"sort" binding:"omitempty,oneof=distance last_seen"`
+	// MaxAge (p. ej. "30s") acota la ventana DRIVER_FRESHNESS; no la amplía.
+	MaxAge time.Duration `form:"max_age"`
+	// Statuses se puede repetir: el conductor debe estar en alguno.
+	Statuses []string `form:"status"`
+}
+
+func (s driverSearch) validate() error {
+	if s.MaxAge < 0 {
+		return errors.New("max_age no puede ser negativo")
+	}
+	return validateStatuses(s.Statuses)
+}
+
+func validateStatuses(statuses []string) error {
+	for _, status := range statuses {
+		if !ingest.ValidStatus(status) {
+			return fmt.Errorf("Estado desconocido %q", status)
+		}
+	}
+	return nil
+}
+
+func (s driverSearch) limit() int {
+	if s.Limit == 0 {
+		return defaultDriverLimit
+	}
+	return s.Limit
+}
+
+func (s driverSearch) byLastSeen() bool {
+	return s.Sort == "last_seen"
+}
+
+func (s driverSearch) since(fresh time.Time, now time.Time) time.Time {
+	return freshSince(fresh, s.MaxAge, now)
+}
+
+// freshSince es la hora del fix más viejo que cuenta: la ventana de actividad
+// del servicio (fresh), acotada por maxAge. Cero no filtra.
+func freshSince(fresh time.Time, maxAge time.Duration, now time.Time) time.Time {
+	if maxAge > 0 {
+		if limit := now.Add(-maxAge); limit.After(fresh) {
+			return limit
+		}
+	}
+	return fresh
+}
+
+// nearbyQuery son los parámetros de /drivers/nearby. Como en nearestQuery,
+// Lat y Lng son punteros para aceptar el 0.
+type nearbyQuery struct {
+	Lat    *float64 `form:"lat" binding:"required,min=-90,max=90"`
+	Lng    *float64 `form:"lng" binding:"required,min=-180,max=180"`
+	Radius float64  `form:"radius" binding:"required,gt=0"`
+	driverSearch
+}
+
+// GetNearbyDrivers busca conductores en un radio (metros) alrededor de
+// lat/lng: uno por dispositivo, con su último fix, ordenados por distancia.
+// Responde desde Redis y, solo si Redis falla, desde Postgres.
+func (h *LocationHandler) GetNearbyDrivers(c *gin.Context) {
+	var params nearbyQuery
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Faltan coordenadas o radio, o están fuera de rango: " + err.Error()})
+		return
+	}
+	if err := params.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lat, lng := *params.Lat, *params.Lng
+
+	devices, ok := h.statusDevices(c, params.Statuses)
+	if !ok {
+		return
+	}
+	// La misma ventana de actividad para Redis y para Postgres.
+	since := params.since(h.ingest.FreshSince(), time.Now())
+
+	drivers, err := h.cache.NearbyDrivers(c, ingest.NearbyQuery{
+		Latitude:     lat,
+		Longitude:    lng,
+		RadiusMeters: params.Radius,
+		Since:        since,
+		ByLastSeen:   params.byLastSeen(),
+		Limit:        params.limit(),
+		DeviceIDs:    devices,
+	})
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"source": "redis-cache", "count": len(drivers), "data": drivers})
+		return
+	}
+	h.logger.Warnw("Error buscando cercanos en Redis", "error", err)
+
+	rows, err := h.queries.GetNearbyDrivers(c, database.GetNearbyDriversParams{
+		Since:        since,
+		DeviceIds:    devices,
+		Lng:          lng,
+		Lat:          lat,
+		RadiusMeters: params.Radius,
+		ByLastSeen:   params.byLastSeen(),
+		MaxResults:   int32(params.limit()),
+	})
+	if err != nil {
+		h.logger.Errorw("Error buscando cercanos", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error en el radar"})
+		return
+	}
+
+	drivers = make([]ingest.NearbyDriver, len(rows))
+	for i, row := range rows {
+		drivers[i] = driverFromRow(row)
+	}
+	h.fillStatuses(c, drivers)
+	c.JSON(http.StatusOK, gin.H{"source": "database", "count": len(drivers), "data": drivers})
+}
+
+// nearestQuery son los parámetros de /drivers/nearest. Lat y Lng son
+// punteros para distinguir 0 de un valor omitido.
+type nearestQuery struct {
+	Lat *float64 `form:"lat" binding:"required,min=-90,max=90"`
+	Lng *float64 `form:"lng" binding:"required,min=-180,max=180"`
+	// K es 5 si se omite.
+	K           int           `form:"k" binding:"omitempty,min=1,max=100"`
+	GroupID     string        `form:"group_id"`
+	MaxDistance float64       `form:"max_distance" binding:"omitempty,gt=0"`
+	MaxAge      time.Duration `form:"max_age"`
+	Statuses    []string      `form:"status"`
+}
+
+// GetNearestDrivers devuelve los k conductores más cercanos a lat/lng,
+// opcionalmente de un grupo, a no más de max_distance metros y vistos dentro
+// de max_age. Responde desde Redis y, solo si Redis falla, con un KNN en
+// Postgres.
+func (h *LocationHandler) GetNearestDrivers(c *gin.Context) {
+	var params nearestQuery
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Faltan coordenadas o están fuera de rango: " + err.Error()})
+		return
+	}
+	if params.MaxAge < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_age no puede ser negativo"})
+		return
+	}
+	if err := validateStatuses(params.Statuses); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if params.K == 0 {
+		params.K = defaultNearestK
+	}
+	lat, lng := *params.Lat, *params.Lng
+
+	devices, ok := h.groupDevices(c, params.GroupID)
+	if !ok {
+		return
+	}
+	withStatus, ok := h.statusDevices(c, params.Statuses)
+	if !ok {
+		return
+	}
+	devices = intersect(devices, withStatus)
+	since := freshSince(h.ingest.FreshSince(), params.MaxAge, time.Now())
+
+	drivers, err := h.cache.NearestDrivers(c, ingest.NearbyQuery{
+		Latitude:     lat,
+		Longitude:    lng,
+		RadiusMeters: params.MaxDistance,
+		Since:        since,
+		Limit:        params.K,
+		DeviceIDs:    devices,
+	})
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"source": "redis-cache", "count": len(drivers), "data": drivers})
+		return
+	}
+	h.logger.Warnw("Error buscando los más cercanos en Redis", "error", err)
+
+	rows, err := h.queries.GetNearestDrivers(c, database.GetNearestDriversParams{
+		Since:       since,
+		DeviceIds:   devices,
+		Lng:         lng,
+		Lat:         lat,
+		MaxDistance: sql.NullFloat64{Float64: params.MaxDistance, Valid: params.MaxDistance > 0},
+		MaxResults:  int32(params.K),
+	})
+	if err != nil {
+		h.logger.Errorw("Error buscando los más cercanos", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error en el radar"})
+		return
+	}
+
+	drivers = make([]ingest.NearbyDriver, len(rows))
+	for i, row := range rows {
+		drivers[i] = driverFromRow(database.GetNearbyDriversRow(row))
+	}
+	h.fillStatuses(c, drivers)
+	c.JSON(http.StatusOK, gin.H{"source": "database", "count": len(drivers), "data": drivers})
+}
+
+// GetDriversWithin busca los conductores dentro de bbox
+// ("min_lng,min_lat,max_lng,max_lat"), p. ej. la vista actual del mapa.
+// Acepta limit, sort y max_age como /drivers/nearby; la distancia es al
+// centro del rectángulo.
+func (h *LocationHandler) GetDriversWithin(c *gin.Context) {
+	var params struct {
+		BBox string `form:"bbox" binding:"required"`
+		driverSearch
+	}
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := params.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	box, err := parseBBox(params.BBox)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.driversWithin(c, box, nil, box.GeoJSON(), params.driverSearch)
+}
+
+// PostDriversWithin busca los conductores dentro del Polygon o MultiPolygon
+// GeoJSON del body, p. ej. uno dibujado en el mapa. Las opciones van en la
+// query como en GET; la distancia es al centro del rectángulo que contiene
+// al área.
+func (h *LocationHandler) PostDriversWithin(c *gin.Context) {
+	var search driverSearch
+	if err := c.ShouldBindQuery(&search); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := search.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWithinBody+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No se pudo leer el body"})
+		return
+	}
+	if len(body) > maxWithinBody {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "El polígono es demasiado grande"})
+		return
+	}
+	geojson := string(body)
+	if err := validatePolygonGeoJSON(geojson); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	area, err := parseArea(geojson)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.driversWithin(c, area.Bounds(), area, geojson, search)
+}
+
+// driversWithin responde la búsqueda por área: Redis con GEOSEARCH BYBOX y
+// recorte exacto, o Postgres si Redis falla.
+func (h *LocationHandler) driversWithin(c *gin.Context, box ingest.Box, area ingest.Area, geojson string, search driverSearch) {
+	devices, ok := h.statusDevices(c, search.Statuses)
+	if !ok {
+		return
+	}
+	since := search.since(h.ingest.FreshSince(), time.Now())
+
+	drivers, err := h.cache.DriversWithin(c, box, area, ingest.NearbyQuery{
+		Since:      since,
+		ByLastSeen: search.byLastSeen(),
+		Limit:      search.limit(),
+		DeviceIDs:  devices,
+	})
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"source": "redis-cache", "count": len(drivers), "data": drivers})
+		return
+	}
+	h.logger.Warnw("Error buscando conductores por área en Redis", "error", err)
+
+	rows, err := h.queries.GetDriversWithin(c, database.GetDriversWithinParams{
+		Geojson:    geojson,
+		Since:      since,
+		DeviceIds:  devices,
+		ByLastSeen: search.byLastSeen(),
+		MaxResults: int32(search.limit()),
+	})
+	if err != nil {
+		h.logger.Errorw("Error buscando conductores por área", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error en el radar"})
+		return
+	}
+
+	drivers = make([]ingest.NearbyDriver, len(rows))
+	for i, row := range rows {
+		drivers[i] = driverFromRow(database.GetNearbyDriversRow(row))
+	}
+	h.fillStatuses(c, drivers)
+	c.JSON(http.StatusOK, gin.H{"source": "database", "count": len(drivers), "data": drivers})
+}
+
+// parseArea lee los polígonos de un Polygon o MultiPolygon GeoJSON ya
+// validado.
+func parseArea(geojson string) (ingest.Area, error) {
+	var g struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+	if err := json.Unmarshal([]byte(geojson), &g); err != nil {
+		return nil, err
+	}
+	if g.Type == "Polygon" {
+		var rings [][][]float64
+		err := json.Unmarshal(g.Coordinates, &rings)
+		return ingest.Area{rings}, err
+	}
+	var area ingest.Area
+	err := json.Unmarshal(g.Coordinates, &area)
+	return area, err
+}
+
+// groupDevices devuelve los dispositivos del grupo group_id, o nil si no se
+// pidió grupo. Si el grupo es inválido o no existe ya respondió y ok es
+// false.
+func (h *LocationHandler) groupDevices(c *gin.Context, groupID string) ([]string, bool) {
+	if groupID == "" {
+		return nil, true
+	}
+	id, err := uuid.Parse(groupID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_id inválido"})
+		return nil, false
+	}
+	if _, err := h.queries.GetDeviceGroup(c, id); errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Grupo no encontrado"})
+		return nil, false
+	}
+	devices, err := h.queries.ListDeviceGroupMembers(c, id)
+	if err != nil {
+		h.logger.Errorw("Error listando miembros", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cargando dispositivos"})
+		return nil, false
+	}
+	if devices == nil {
+		// Un grupo vacío no encuentra a nadie; nil sería "sin filtro".
+		devices = []string{}
+	}
+	return devices, true
+}
+
+// statusDevices devuelve los dispositivos en alguno de los estados, o nil si
+// no se filtró por estado. Si falla ya respondió y ok es false.
+func (h *LocationHandler) statusDevices(c *gin.Context, statuses []string) ([]string, bool) {
+	if len(statuses) == 0 {
+		return nil, true
+	}
+	devices, err := h.cache.DevicesWithStatus(c, statuses...)
+	if err != nil {
+		h.logger.Errorw("Error leyendo estados de conductores", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "No se pudieron leer los estados"})
+		return nil, false
+	}
+	return devices, true
+}
+
+// intersect combina dos filtros de dispositivos; nil no filtra.
+func intersect(a, b []string) []string {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	in := make(map[string]bool, len(b))
+	for _, deviceID := range b {
+		in[deviceID] = true
+	}
+	out := []string{}
+	for _, deviceID := range a {
+		if in[deviceID] {
+			out = append(out, deviceID)
+		}
+	}
+	return out
+}
+
+// fillStatuses completa el estado de los conductores que vienen de Postgres.
+// Sin Redis quedan sin estado.
+func (h *LocationHandler) fillStatuses(ctx context.Context, drivers []ingest.NearbyDriver) {
+	deviceIDs := make([]string, len(drivers))
+	for i, driver := range drivers {
+		deviceIDs[i] = driver.DeviceID
+	}
+	statuses, err := h.cache.DriverStatuses(ctx, deviceIDs...)
+	if err != nil {
+		h.logger.Warnw("Error leyendo estados de conductores", "error", err)
+		return
+	}
+	for i, status := range statuses {
+		drivers[i].Status = status.Status
+	}
+}
+
+// driverFromRow convierte el último fix de Postgres al formato de las
+// búsquedas.
+func driverFromRow(row database.GetNearbyDriversRow) ingest.NearbyDriver {
+	return ingest.NearbyDriver{
+		DeviceID:       row.DeviceID,
+		Latitude:       row.Latitude,
+		Longitude:      row.Longitude,
+		DistanceMeters: row.DistanceMeters,
+		Heading:        row.Heading,
+		Speed:          row.Speed,
+		LastSeen:       row.RecordedAt.UTC(),
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriverSearchBinding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	bind := func(query string) (driverSearch, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/drivers/nearby?"+query, nil)
+		var s driverSearch
+		err := c.ShouldBindQuery(&s)
+		return s, err
+	}
+
+	s, err := bind("limit=5&sort=last_seen&max_age=30s")
+	require.NoError(t, err)
+	assert.Equal(t, 5, s.limit())
+	assert.True(t, s.byLastSeen())
+	assert.Equal(t, 30*time.Second, s.MaxAge)
+
+	s, err = bind("")
+	require.NoError(t, err)
+	assert.Equal(t, defaultDriverLimit, s.limit())
+	assert.False(t, s.byLastSeen())
+
+	_, err = bind("sort=name")
+	assert.Error(t, err)
+	_, err = bind("limit=5000")
+	assert.Error(t, err)
+	_, err = bind("max_age=pronto")
+	assert.Error(t, err)
+	assert.Error(t, driverSearch{MaxAge: -time.Second}.validate())
+
+	s, err = bind("status=available&status=en-route")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"available", "en-route"}, s.Statuses)
+	assert.NoError(t, s.validate())
+	assert.Error(t, driverSearch{Statuses: []string{"durmiendo"}}.validate())
+}
+
+func TestNearestQueryBinding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	bind := func(query string) (nearestQuery, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/drivers/nearest?"+query, nil)
+		var q nearestQuery
+		err := c.ShouldBindQuery(&q)
+		return q, err
+	}
+
+	// El ecuador y el meridiano de Greenwich son coordenadas válidas.
+	q, err := bind("lat=0&lng=0")
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, *q.Lat)
+	assert.Equal(t, 0.0, *q.Lng)
+
+	for _, query := range []string{"lng=0", "lat=0", "lat=91&lng=0", "lat=0&lng=-181"} {
+		_, err := bind(query)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestNearbyQueryBinding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	bind := func(query string) (nearbyQuery, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/drivers/nearby?"+query, nil)
+		var q nearbyQuery
+		err := c.ShouldBindQuery(&q)
+		return q, err
+	}
+
+	q, err := bind("lat=0&lng=0&radius=500")
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, *q.Lat)
+	assert.Equal(t, 0.0, *q.Lng)
+
+	for _, query := range []string{"lng=0&radius=500", "lat=0&radius=500", "lat=0&lng=0", "lat=-91&lng=0&radius=500", "lat=0&lng=181&radius=500"} {
+		_, err := bind(query)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestDriverSearchSince(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fresh := now.Add(-5 * time.Minute)
+
+	assert.Equal(t, fresh, driverSearch{}.since(fresh, now))
+	assert.Equal(t, now.Add(-time.Minute), driverSearch{MaxAge: time.Minute}.since(fresh, now))
+	// max_age no amplía la ventana del servicio.
+	assert.Equal(t, fresh, driverSearch{MaxAge: time.Hour}.since(fresh, now))
+	// Sin ventana configurada, max_age es el único límite.
+	assert.Equal(t, now.Add(-time.Hour), driverSearch{MaxAge: time.Hour}.since(time.Time{}, now))
+}
+
+func TestParseArea(t *testing.T) {
+	area, err := parseArea(`{"type": "Polygon", "coordinates": [[[0, 0], [2, 0], [2, 2], [0, 0]]]}`)
+	require.NoError(t, err)
+	require.Len(t, area, 1)
+	assert.True(t, area.Contains(1.5, 0.5))
+
+	area, err = parseArea(`{"type": "MultiPolygon", "coordinates": [[[[0, 0], [1, 0], [1, 1], [0, 0]]], [[[5, 5], [6, 5], [6, 6], [5, 5]]]]}`)
+	require.NoError(t, err)
+	require.Len(t, area, 2)
+	assert.Equal(t, 6.0, area.Bounds().MaxLongitude)
+}
+
+func TestIntersectDeviceFilters(t *testing.T) {
+	assert.Nil(t, intersect(nil, nil), "sin filtros")
+	assert.Equal(t, []string{"a"}, intersect(nil, []string{"a"}))
+	assert.Equal(t, []string{"b"}, intersect([]string{"a", "b"}, []string{"b", "c"}))
+	// Sin coincidencias queda un filtro vacío, no "sin filtro".
+	assert.Equal(t, []string{}, intersect([]string{"a"}, []string{"b"}))
+}
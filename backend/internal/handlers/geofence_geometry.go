@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	geometryInvalid         = "invalid_geometry"
+	geometryTooManyVertices = "too_many_vertices"
+	geometryAreaTooLarge    = "area_too_large"
+)
+
+// GeometryLimits acota los polígonos que se aceptan; 0 desactiva el límite.
+type GeometryLimits struct {
+	MaxVertices int
+	MaxAreaKm2  float64
+}
+
+// GeometryError es la respuesta 400 cuando PostGIS rechaza un polígono.
+type GeometryError struct {
+	Error string `json:"error"`
+	// Code es invalid_geometry, too_many_vertices o area_too_large.
+	Code string `json:"code"`
+	// Reason y Location vienen de ST_IsValidDetail (p. ej. "Self-intersection"
+	// y el punto donde se cruzan los bordes).
+	Reason       string    `json:"reason,omitempty"`
+	Location     *GeoPoint `json:"location,omitempty"`
+	Vertices     int32     `json:"vertices"`
+	AreaSqMeters float64   `json:"area_sq_meters"`
+}
+
+// geometryProblem decide si el resultado de CheckGeofenceGeometry se puede
+// guardar. Devuelve nil si la geometría es válida (o quedó reparada) y
+// respeta los límites.
+func geometryProblem(check database.CheckGeofenceGeometryRow, limits GeometryLimits, repair bool) *GeometryError {
+	problem := &GeometryError{
+		Vertices:     check.Vertices,
+		AreaSqMeters: check.AreaSqMeters,
+	}
+
+	switch {
+	case !check.Valid && !check.Repaired:
+		problem.Code = geometryInvalid
+		problem.Reason = check.Reason
+		if check.HasLocation {
+			problem.Location = &GeoPoint{Latitude: check.LocationLatitude, Longitude: check.LocationLongitude}
+		}
+		if repair {
+			problem.Error = fmt.Sprintf("La geometría no es válida y no se pudo reparar: %s", check.Reason)
+		} else {
+			problem.Error = fmt.Sprintf("La geometría no es válida: %s (envíe repair=true para intentar repararla)", check.Reason)
+		}
+	case limits.MaxVertices > 0 && int(check.Vertices) > limits.MaxVertices:
+		problem.Code = geometryTooManyVertices
+		problem.Error = fmt.Sprintf("La zona tiene %d vértices; el máximo es %d", check.Vertices, limits.MaxVertices)
+	case limits.MaxAreaKm2 > 0 && check.AreaSqMeters > limits.MaxAreaKm2*1e6:
+		problem.Code = geometryAreaTooLarge
+		problem.Error = fmt.Sprintf("La zona mide %.1f km²; el máximo es %.1f km²", check.AreaSqMeters/1e6, limits.MaxAreaKm2)
+	default:
+		return nil
+	}
+	return problem
+}
+
+// checkShape valida la geometría de una zona en PostGIS y devuelve el
+// geojson a guardar (el reparado si hizo falta). Si la zona se rechaza ya
+// respondió y ok es false.
+func (h *LocationHandler) checkShape(c *gin.Context, shape GeofenceShape) (string, bool) {
+	checked, problem, err := h.inspectShape(c, shape)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "No se pudo validar la geometría"})
+		return "", false
+	}
+	if problem != nil {
+		c.JSON(400, problem)
+		return "", false
+	}
+	return checked, true
+}
+
+// inspectShape es checkShape sin responder: devuelve el geojson a guardar o
+// el motivo del rechazo. Círculos y corredores se miden por el buffer que se
+// guardaría, con los mismos límites de vértices y área que un polígono.
+func (h *LocationHandler) inspectShape(ctx context.Context, shape GeofenceShape) (string, *GeometryError, error) {
+	switch shape.shape() {
+	case shapeCircle:
+		check, err := h.queries.CheckCircleGeometry(ctx, database.CheckCircleGeometryParams{
+			Lng:          shape.Center.Longitude,
+			Lat:          shape.Center.Latitude,
+			RadiusMeters: shape.RadiusMeters,
+		})
+		if err != nil {
+			h.logger.Errorw("Error validando geometría", "error", err)
+			return "", nil, err
+		}
+		return shape.GeoJSON, geometryProblem(database.CheckGeofenceGeometryRow{
+			Valid:        true,
+			Vertices:     check.Vertices,
+			AreaSqMeters: check.AreaSqMeters,
+		}, h.limits, false), nil
+
+	case shapeCorridor:
+		check, err := h.queries.CheckCorridorGeometry(ctx, database.CheckCorridorGeometryParams{
+			Geojson:     shape.GeoJSON,
+			WidthMeters: shape.WidthMeters,
+		})
+		if err != nil {
+			h.logger.Errorw("Error validando geometría", "error", err)
+			return "", nil, err
+		}
+		if !check.Simple {
+			return "", &GeometryError{
+				Error:        "La línea del corredor se cruza consigo misma",
+				Code:         geometryInvalid,
+				Reason:       "Self-intersection",
+				Vertices:     check.Vertices,
+				AreaSqMeters: check.AreaSqMeters,
+			}, nil
+		}
+		return shape.GeoJSON, geometryProblem(database.CheckGeofenceGeometryRow{
+			Valid:        true,
+			Vertices:     check.Vertices,
+			AreaSqMeters: check.AreaSqMeters,
+		}, h.limits, false), nil
+
+	default:
+		return h.inspectPolygon(ctx, shape.GeoJSON, shape.Repair)
+	}
+}
+
+func (h *LocationHandler) inspectPolygon(ctx context.Context, geojson string, repair bool) (string, *GeometryError, error) {
+	check, err := h.queries.CheckGeofenceGeometry(ctx, database.CheckGeofenceGeometryParams{
+		Geojson: geojson,
+		Repair:  repair,
+	})
+	if err != nil {
+		h.logger.Errorw("Error validando geometría", "error", err)
+		return "", nil, err
+	}
+
+	if problem := geometryProblem(check, h.limits, repair); problem != nil {
+		return "", problem, nil
+	}
+
+	if check.Repaired {
+		return check.Geojson, nil, nil
+	}
+	return geojson, nil, nil
+}
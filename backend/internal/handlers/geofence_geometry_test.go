@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeometryProblem(t *testing.T) {
+	limits := GeometryLimits{MaxVertices: 100, MaxAreaKm2: 50}
+	valid := database.CheckGeofenceGeometryRow{Valid: true, Vertices: 5, AreaSqMeters: 1e6}
+	bowtie := database.CheckGeofenceGeometryRow{
+		Reason:            "Self-intersection",
+		HasLocation:       true,
+		LocationLatitude:  0.5,
+		LocationLongitude: 0.5,
+		Vertices:          5,
+	}
+
+	tests := []struct {
+		name   string
+		check  database.CheckGeofenceGeometryRow
+		limits GeometryLimits
+		repair bool
+		code   string
+	}{
+		{"válida", valid, limits, false, ""},
+		{"inválida", bowtie, limits, false, geometryInvalid},
+		{"no se pudo reparar", bowtie, limits, true, geometryInvalid},
+		{"reparada", database.CheckGeofenceGeometryRow{Repaired: true, Vertices: 8, AreaSqMeters: 1e6}, limits, true, ""},
+		{"demasiados vértices", database.CheckGeofenceGeometryRow{Valid: true, Vertices: 101}, limits, false, geometryTooManyVertices},
+		{"área excesiva", database.CheckGeofenceGeometryRow{Valid: true, Vertices: 5, AreaSqMeters: 51e6}, limits, false, geometryAreaTooLarge},
+		{"sin límites", database.CheckGeofenceGeometryRow{Valid: true, Vertices: 1e6, AreaSqMeters: 1e12}, GeometryLimits{}, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem := geometryProblem(tt.check, tt.limits, tt.repair)
+			if tt.code == "" {
+				assert.Nil(t, problem)
+				return
+			}
+			require.NotNil(t, problem)
+			assert.Equal(t, tt.code, problem.Code)
+			assert.NotEmpty(t, problem.Error)
+		})
+	}
+}
+
+func TestGeometryProblemReportsReasonAndLocation(t *testing.T) {
+	problem := geometryProblem(database.CheckGeofenceGeometryRow{
+		Reason:            "Self-intersection",
+		HasLocation:       true,
+		LocationLatitude:  19.45,
+		LocationLongitude: -99.15,
+	}, GeometryLimits{}, false)
+
+	require.NotNil(t, problem)
+	assert.Equal(t, "Self-intersection", problem.Reason)
+	assert.Equal(t, &GeoPoint{Latitude: 19.45, Longitude: -99.15}, problem.Location)
+	assert.Contains(t, problem.Error, "repair=true")
+}
@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/AlexG695/geo-engine-core/internal/geoformat"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+)
+
+// maxImportBytes acota el archivo que acepta POST /geofences/import.
+const maxImportBytes = 20 << 20
+
+// ImportResult es el resultado de validar (y crear) una feature del archivo.
+type ImportResult struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+	// Code viene de la validación en PostGIS (ver GeometryError).
+	Code     string     `json:"code,omitempty"`
+	ID       *uuid.UUID `json:"id,omitempty"`
+	Repaired bool       `json:"repaired,omitempty"`
+}
+
+type importQuery struct {
+	// Format es geojson, kml o shapefile; omitido se deduce del contenido.
+	Format string `form:"format" binding:"omitempty,oneof=geojson kml shapefile"`
+	// DryRun solo valida y devuelve el resultado por feature.
+	DryRun bool `form:"dry_run"`
+	Repair bool `form:"repair"`
+}
+
+// ImportGeofences crea zonas desde un GeoJSON FeatureCollection, un KML o un
+// shapefile en zip, enviado como cuerpo o en el campo "file" de un
+// multipart. Se importa todo o nada: si alguna feature no es válida no se
+// crea ninguna, y las zonas se guardan en una sola transacción.
+func (h *LocationHandler) ImportGeofences(c *gin.Context) {
+	var query importQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := importBody(c)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "El archivo excede el máximo permitido", "max_bytes": maxImportBytes})
+			return
+		}
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := query.Format
+	if format == "" {
+		if format = geoformat.Detect(data); format == "" {
+			c.JSON(400, gin.H{"error": "No se reconoce el formato: indique format=geojson, kml o shapefile"})
+			return
+		}
+	}
+
+	features, err := geoformat.Decode(format, data)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if len(features) == 0 {
+		c.JSON(400, gin.H{"error": "El archivo no tiene zonas"})
+		return
+	}
+
+	results := make([]ImportResult, len(features))
+	reqs := make([]CreateGeofenceRequest, len(features))
+	geojsons := make([]string, len(features))
+	invalid := 0
+	for i, f := range features {
+		results[i] = ImportResult{Index: i, Name: f.Name}
+
+		req, err := importRequest(f, query.Repair)
+		if err == nil {
+			var problem *GeometryError
+			geojsons[i], problem, err = h.inspectShape(c, req.GeofenceShape)
+			if err != nil {
+				c.JSON(500, gin.H{"error": "No se pudo validar la geometría"})
+				return
+			}
+			if problem != nil {
+				results[i].Error, results[i].Code = problem.Error, problem.Code
+				invalid++
+				continue
+			}
+			results[i].Repaired = geojsons[i] != req.GeoJSON
+		}
+		if err != nil {
+			results[i].Error = err.Error()
+			invalid++
+			continue
+		}
+		results[i].Valid = true
+		reqs[i] = req
+	}
+
+	if query.DryRun {
+		c.JSON(200, gin.H{"dry_run": true, "created": 0, "features": results})
+		return
+	}
+	if invalid > 0 {
+		c.JSON(400, gin.H{
+			"error":    fmt.Sprintf("%d de %d zonas no son válidas; no se importó ninguna", invalid, len(features)),
+			"created":  0,
+			"features": results,
+		})
+		return
+	}
+
+	updatedBy := actor(c)
+	ids := make([]uuid.UUID, len(reqs))
+	err = h.tx(c, func(q database.Querier) error {
+		for i, req := range reqs {
+			id, err := createGeofence(c, q, req, geojsons[i], updatedBy)
+			if err != nil {
+				h.logger.Errorw("Error importando zona", "index", i, "error", err)
+				return err
+			}
+			ids[i] = id
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "No se pudieron guardar las zonas; no se importó ninguna", "created": 0, "features": results})
+		return
+	}
+	for i := range ids {
+		results[i].ID = &ids[i]
+	}
+
+	c.JSON(201, gin.H{"dry_run": false, "created": len(reqs), "features": results})
+}
+
+// importBody lee el archivo del campo "file" si el pedido es multipart y el
+// cuerpo entero si no.
+func importBody(c *gin.Context) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return nil, err
+			}
+			return nil, errors.New("Falta el archivo en el campo file")
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return io.ReadAll(file)
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, errors.New("El archivo está vacío")
+	}
+	return data, nil
+}
+
+// importRequest traduce una feature a la misma petición que POST /geofences:
+// un Point con radius_meters es un círculo, una LineString con width_meters
+// un corredor y un Polygon o MultiPolygon un polígono. Los atributos
+// numéricos pueden venir como texto (KML y DBF no tienen tipos).
+func importRequest(f geoformat.Feature, repair bool) (CreateGeofenceRequest, error) {
+	if f.Err != nil {
+		return CreateGeofenceRequest{}, f.Err
+	}
+
+	req := CreateGeofenceRequest{Name: f.Name}
+	req.Repair = repair
+
+	numbers := map[string]*float64{}
+	for _, key := range []string{"radius_meters", "width_meters", "dwell_seconds", "min_fixes", "min_duration_seconds", "exit_buffer_meters", "speed_limit_kmh"} {
+		v, ok, err := numberProperty(f.Properties, key)
+		if err != nil {
+			return req, err
+		}
+		if ok {
+			numbers[key] = &v
+		}
+	}
+
+	switch geoJSONType(string(f.Geometry)) {
+	case "Point":
+		if numbers["radius_meters"] == nil {
+			return req, errors.New("Un Point necesita radius_meters para ser un círculo")
+		}
+		var point struct {
+			Coordinates []float64 `json:"coordinates"`
+		}
+		if err := json.Unmarshal(f.Geometry, &point); err != nil || len(point.Coordinates) < 2 {
+			return req, errors.New("Point inválido")
+		}
+		req.Type = shapeCircle
+		req.Center = &GeoPoint{Latitude: point.Coordinates[1], Longitude: point.Coordinates[0]}
+		req.RadiusMeters = *numbers["radius_meters"]
+	case "LineString":
+		if numbers["width_meters"] == nil {
+			return req, errors.New("Una LineString necesita width_meters para ser un corredor")
+		}
+		req.Type = shapeCorridor
+		req.GeoJSON = string(f.Geometry)
+		req.WidthMeters = *numbers["width_meters"]
+	default:
+		req.Type = shapePolygon
+		req.GeoJSON = string(f.Geometry)
+	}
+
+	if v := numbers["dwell_seconds"]; v != nil {
+		dwell := int32(*v)
+		req.DwellSeconds = &dwell
+	}
+	if v := numbers["min_fixes"]; v != nil {
+		req.MinFixes = int32(*v)
+	}
+	if v := numbers["min_duration_seconds"]; v != nil {
+		req.MinDurationSeconds = int32(*v)
+	}
+	if v := numbers["exit_buffer_meters"]; v != nil {
+		req.ExitBufferMeters = *v
+	}
+	req.SpeedLimitKmh = numbers["speed_limit_kmh"]
+
+	meta, err := importMetadata(f.Properties)
+	if err != nil {
+		return req, err
+	}
+	req.GeofenceMetadata = meta
+
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		return req, err
+	}
+	return req, req.validate()
+}
+
+// numberProperty lee un atributo numérico; vacío u omitido es ok=false.
+func numberProperty(props map[string]interface{}, key string) (float64, bool, error) {
+	switch v := props[key].(type) {
+	case nil:
+		return 0, false, nil
+	case float64:
+		return v, true, nil
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return 0, false, nil
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("%s debe ser un número: %q", key, v)
+		}
+		return n, true, nil
+	default:
+		return 0, false, fmt.Errorf("%s debe ser un número", key)
+	}
+}
+
+// importMetadata lee description, color, category, tags (lista o texto
+// separado por comas) y properties (objeto o su JSON como texto).
+func importMetadata(props map[string]interface{}) (GeofenceMetadata, error) {
+	var meta GeofenceMetadata
+	for key, dst := range map[string]**string{"description": &meta.Description, "color": &meta.Color, "category": &meta.Category} {
+		if v, ok := props[key]; ok && v != nil {
+			text := strings.TrimSpace(fmt.Sprint(v))
+			*dst = &text
+		}
+	}
+
+	switch v := props["tags"].(type) {
+	case nil:
+	case string:
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				meta.Tags = append(meta.Tags, tag)
+			}
+		}
+	case []interface{}:
+		for _, tag := range v {
+			text, ok := tag.(string)
+			if !ok {
+				return meta, errors.New("tags debe ser una lista de textos")
+			}
+			meta.Tags = append(meta.Tags, text)
+		}
+	default:
+		return meta, errors.New("tags debe ser una lista de textos")
+	}
+
+	switch v := props["properties"].(type) {
+	case nil:
+	case map[string]interface{}:
+		meta.Properties = v
+	case string:
+		if strings.TrimSpace(v) != "" {
+			if err := json.Unmarshal([]byte(v), &meta.Properties); err != nil {
+				return meta, errors.New("properties debe ser un objeto JSON")
+			}
+		}
+	default:
+		return meta, errors.New("properties debe ser un objeto JSON")
+	}
+	return meta, nil
+}
+
+// ExportGeofences descarga las zonas vigentes en el formato pedido
+// (geojson por defecto), con los mismos filtros que GET /geofences. Círculos
+// y corredores se exportan como su polígono; shape, radius_meters y
+// width_meters quedan como atributos. Las etiquetas van separadas por comas
+// y properties, salvo en GeoJSON, como texto JSON.
+func (h *LocationHandler) ExportGeofences(c *gin.Context) {
+	var query struct {
+		Format string `form:"format" binding:"omitempty,oneof=geojson kml shapefile"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if query.Format == "" {
+		query.Format = geoformat.GeoJSON
+	}
+	params, ok := bindGeofenceFilter(c)
+	if !ok {
+		return
+	}
+
+	zones, err := h.queries.GetGeofences(c, params)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error cargando zonas"})
+		return
+	}
+
+	features := make([]geoformat.Feature, len(zones))
+	for i, z := range zones {
+		props := map[string]interface{}{
+			"id":                   z.ID.String(),
+			"shape":                z.Shape,
+			"dwell_seconds":        float64(z.DwellSeconds),
+			"min_fixes":            float64(z.MinFixes),
+			"min_duration_seconds": float64(z.MinDurationSeconds),
+			"exit_buffer_meters":   z.ExitBufferMeters,
+			"speed_limit_kmh":      z.SpeedLimitKmh,
+			"description":          z.Description,
+			"color":                z.Color,
+			"category":             z.Category,
+			"tags":                 strings.Join(z.Tags, ","),
+			"properties":           string(z.Properties),
+		}
+		if query.Format == geoformat.GeoJSON {
+			props["properties"] = z.Properties
+		}
+		switch z.Shape {
+		case shapeCircle:
+			props["radius_meters"] = z.RadiusMeters
+		case shapeCorridor:
+			props["width_meters"] = z.WidthMeters
+		}
+		features[i] = geoformat.Feature{Name: z.Name, Properties: props, Geometry: json.RawMessage(z.Geojson)}
+	}
+
+	var buf bytes.Buffer
+	if err := geoformat.Encode(&buf, query.Format, features); err != nil {
+		h.logger.Errorw("Error exportando zonas", "format", query.Format, "error", err)
+		c.JSON(500, gin.H{"error": "No se pudieron exportar las zonas"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="geofences`+geoformat.Extension(query.Format)+`"`)
+	c.Data(200, geoformat.ContentType(query.Format), buf.Bytes())
+}
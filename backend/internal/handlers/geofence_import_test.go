@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AlexG695/geo-engine-core/internal/geoformat"
+)
+
+func TestImportRequest(t *testing.T) {
+	polygon := json.RawMessage(`{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}`)
+	point := json.RawMessage(`{"type": "Point", "coordinates": [-99.1, 19.4]}`)
+	line := json.RawMessage(`{"type": "LineString", "coordinates": [[0, 0], [1, 1]]}`)
+
+	req, err := importRequest(geoformat.Feature{
+		Name:       "Patio",
+		Properties: map[string]interface{}{"dwell_seconds": "300", "min_fixes": 2.0, "speed_limit_kmh": " 30 ", "id": "ignorado"},
+		Geometry:   polygon,
+	}, true)
+	require.NoError(t, err)
+	assert.Equal(t, shapePolygon, req.shape())
+	assert.True(t, req.Repair)
+	assert.Equal(t, int32(300), *req.DwellSeconds)
+	assert.Equal(t, int32(2), req.MinFixes)
+	assert.Equal(t, 30.0, *req.SpeedLimitKmh)
+
+	req, err = importRequest(geoformat.Feature{Name: "Caseta", Properties: map[string]interface{}{"radius_meters": 150.0}, Geometry: point}, false)
+	require.NoError(t, err)
+	assert.Equal(t, shapeCircle, req.shape())
+	assert.Equal(t, &GeoPoint{Latitude: 19.4, Longitude: -99.1}, req.Center)
+	assert.Equal(t, 150.0, req.RadiusMeters)
+
+	req, err = importRequest(geoformat.Feature{Name: "Ruta", Properties: map[string]interface{}{"width_meters": "40"}, Geometry: line}, false)
+	require.NoError(t, err)
+	assert.Equal(t, shapeCorridor, req.shape())
+	assert.Equal(t, 40.0, req.WidthMeters)
+
+	tests := []struct {
+		name    string
+		feature geoformat.Feature
+	}{
+		{"sin nombre", geoformat.Feature{Geometry: polygon}},
+		{"punto sin radio", geoformat.Feature{Name: "x", Geometry: point}},
+		{"línea sin ancho", geoformat.Feature{Name: "x", Geometry: line}},
+		{"número inválido", geoformat.Feature{Name: "x", Properties: map[string]interface{}{"dwell_seconds": "mucho"}, Geometry: polygon}},
+		{"min_fixes fuera de rango", geoformat.Feature{Name: "x", Properties: map[string]interface{}{"min_fixes": -1.0}, Geometry: polygon}},
+		{"error de lectura", geoformat.Feature{Name: "x", Err: errors.New("La feature no tiene geometría")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := importRequest(tt.feature, false)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+	"github.com/gin-gonic/gin"
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// GeofenceMetadata son los datos descriptivos de una zona; no cambian cómo
+// se evalúa. Al actualizar, lo omitido se conserva: description, color y
+// category vacíos se borran, tags [] quita las etiquetas y properties {}
+// vacía las propiedades.
+type GeofenceMetadata struct {
+	Description *string `json:"description" binding:"omitempty,max=2000"`
+	// Color es "#RRGGBB".
+	Color    *string `json:"color"`
+	Category *string `json:"category" binding:"omitempty,max=100"`
+	// Tags viajan en los eventos de la zona para que los consumidores los
+	// enruten.
+	Tags       []string               `json:"tags" binding:"omitempty,max=50,dive,max=64"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+func (m GeofenceMetadata) validate() error {
+	if m.Color != nil && *m.Color != "" && !colorPattern.MatchString(*m.Color) {
+		return fmt.Errorf("Color inválido %q: use #RRGGBB", *m.Color)
+	}
+	for _, tag := range m.Tags {
+		if strings.TrimSpace(tag) == "" {
+			return errors.New("Las etiquetas no pueden estar vacías")
+		}
+	}
+	return nil
+}
+
+// tags devuelve las etiquetas sin espacios sobrantes ni repetidas; nil si se
+// omitieron.
+func (m GeofenceMetadata) tags() []string {
+	if m.Tags == nil {
+		return nil
+	}
+	tags := make([]string, 0, len(m.Tags))
+	seen := map[string]bool{}
+	for _, tag := range m.Tags {
+		tag = strings.TrimSpace(tag)
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// properties devuelve el JSON de las propiedades; nil si se omitieron.
+func (m GeofenceMetadata) properties() []byte {
+	if m.Properties == nil {
+		return nil
+	}
+	raw, _ := json.Marshal(m.Properties)
+	return raw
+}
+
+// createText es un campo de texto al crear: vacío queda NULL.
+func createText(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	v := strings.TrimSpace(*s)
+	return sql.NullString{String: v, Valid: v != ""}
+}
+
+// updateText es un campo de texto al actualizar: NULL conserva el valor y
+// vacío lo borra.
+func updateText(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: strings.TrimSpace(*s), Valid: true}
+}
+
+// geofenceFilter son los filtros y la paginación de GET /geofences (y de la
+// exportación).
+type geofenceFilter struct {
+	// Tag se puede repetir: la zona debe tener todas.
+	Tags     []string `form:"tag"`
+	Category string   `form:"category"`
+	// Search busca en el nombre, sin distinguir mayúsculas.
+	Search string `form:"search"`
+	// BBox es "min_lng,min_lat,max_lng,max_lat"; vuelven las zonas que lo
+	// cruzan.
+	BBox   string `form:"bbox"`
+	Limit  int32  `form:"limit" binding:"omitempty,min=1,max=1000"`
+	Offset int32  `form:"offset" binding:"omitempty,min=0"`
+}
+
+// bindGeofenceFilter lee los filtros de la query. Si son inválidos ya
+// respondió y ok es false.
+func bindGeofenceFilter(c *gin.Context) (database.GetGeofencesParams, bool) {
+	var f geofenceFilter
+	if err := c.ShouldBindQuery(&f); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return database.GetGeofencesParams{}, false
+	}
+
+	params := database.GetGeofencesParams{
+		Category:   sql.NullString{String: f.Category, Valid: f.Category != ""},
+		PageLimit:  sql.NullInt32{Int32: f.Limit, Valid: f.Limit > 0},
+		PageOffset: f.Offset,
+	}
+	for _, tag := range f.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			params.Tags = append(params.Tags, tag)
+		}
+	}
+	if search := strings.TrimSpace(f.Search); search != "" {
+		params.Search = sql.NullString{String: escapeLike(search), Valid: true}
+	}
+	if f.BBox != "" {
+		box, err := parseBBox(f.BBox)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return database.GetGeofencesParams{}, false
+		}
+		params.MinLng = sql.NullFloat64{Float64: box.MinLongitude, Valid: true}
+		params.MinLat = sql.NullFloat64{Float64: box.MinLatitude, Valid: true}
+		params.MaxLng = sql.NullFloat64{Float64: box.MaxLongitude, Valid: true}
+		params.MaxLat = sql.NullFloat64{Float64: box.MaxLatitude, Valid: true}
+	}
+	return params, true
+}
+
+var errBBoxAntimeridian = errors.New("bbox cruza el antimeridiano, no soportado")
+
+// parseBBox lee "min_lng,min_lat,max_lng,max_lat" en grados. Una vista que
+// cruza el antimeridiano (min_lng > max_lng) se rechaza con un error propio
+// en vez de tratarse como vacía.
+func parseBBox(s string) (ingest.Box, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return ingest.Box{}, errors.New("bbox debe ser min_lng,min_lat,max_lng,max_lat")
+	}
+	var v [4]float64
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return ingest.Box{}, fmt.Errorf("bbox inválido: %q no es un número", part)
+		}
+		v[i] = n
+	}
+
+	box := ingest.Box{MinLongitude: v[0], MinLatitude: v[1], MaxLongitude: v[2], MaxLatitude: v[3]}
+	switch {
+	case box.MinLongitude < -180 || box.MaxLongitude > 180 || box.MinLatitude < -90 || box.MaxLatitude > 90:
+		return ingest.Box{}, errors.New("bbox fuera de rango")
+	case box.MinLongitude > box.MaxLongitude:
+		return ingest.Box{}, errBBoxAntimeridian
+	case box.MinLongitude == box.MaxLongitude || box.MinLatitude >= box.MaxLatitude:
+		return ingest.Box{}, errors.New("bbox vacío: el mínimo debe ser menor que el máximo")
+	}
+	return box, nil
+}
+
+// escapeLike escapa los comodines de ILIKE para buscar el texto literal.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func countParams(p database.GetGeofencesParams) database.CountGeofencesParams {
+	return database.CountGeofencesParams{
+		Tags:     p.Tags,
+		Category: p.Category,
+		Search:   p.Search,
+		MinLng:   p.MinLng,
+		MinLat:   p.MinLat,
+		MaxLng:   p.MaxLng,
+		MaxLat:   p.MaxLat,
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+)
+
+func TestGeofenceMetadataValidate(t *testing.T) {
+	color := func(s string) GeofenceMetadata { return GeofenceMetadata{Color: &s} }
+
+	assert.NoError(t, color("#00ff7F").validate())
+	assert.NoError(t, color("").validate(), "vacío borra el color")
+	assert.Error(t, color("#fff").validate())
+	assert.Error(t, color("rojo").validate())
+	assert.Error(t, GeofenceMetadata{Tags: []string{"ok", " "}}.validate())
+
+	m := GeofenceMetadata{Tags: []string{" carga", "carga", "frío "}}
+	assert.Equal(t, []string{"carga", "frío"}, m.tags())
+	assert.Nil(t, GeofenceMetadata{}.tags(), "omitidas se conservan")
+	assert.Equal(t, []string{}, GeofenceMetadata{Tags: []string{}}.tags(), "[] las quita")
+}
+
+func TestParseBBox(t *testing.T) {
+	box, err := parseBBox("-99.2, 19.3,-99.0,19.5")
+	require.NoError(t, err)
+	assert.Equal(t, ingest.Box{MinLongitude: -99.2, MinLatitude: 19.3, MaxLongitude: -99.0, MaxLatitude: 19.5}, box)
+
+	for _, bad := range []string{"-99.2,19.3,-99.0", "a,b,c,d", "-99.0,19.3,-99.0,19.5", "-99.2,19.5,-99.0,19.3", "-190,0,0,1"} {
+		_, err := parseBBox(bad)
+		assert.Error(t, err, bad)
+	}
+
+	_, err = parseBBox("170,-20,-170,-10")
+	assert.ErrorIs(t, err, errBBoxAntimeridian)
+}
+
+func TestImportMetadata(t *testing.T) {
+	meta, err := importMetadata(map[string]interface{}{
+		"description": "Andén",
+		"tags":        "carga, frío,,",
+		"properties":  `{"cliente": "acme"}`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Andén", *meta.Description)
+	assert.Nil(t, meta.Color)
+	assert.Equal(t, []string{"carga", "frío"}, meta.Tags)
+	assert.Equal(t, map[string]interface{}{"cliente": "acme"}, meta.Properties)
+
+	meta, err = importMetadata(map[string]interface{}{"tags": []interface{}{"a", "b"}, "properties": map[string]interface{}{"n": 1.0}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, meta.Tags)
+
+	_, err = importMetadata(map[string]interface{}{"properties": "[1, 2]"})
+	assert.Error(t, err)
+	_, err = importMetadata(map[string]interface{}{"tags": 3.0})
+	assert.Error(t, err)
+}
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, `50\% \_norte\\`, escapeLike(`50% _norte\`))
+}
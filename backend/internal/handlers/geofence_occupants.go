@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetGeofenceOccupants lista los dispositivos que están dentro de la zona
+// ahora, con la hora de entrada y su último fix. Solo cuentan las entradas
+// confirmadas.
+func (h *LocationHandler) GetGeofenceOccupants(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	name, err := h.queries.GetGeofenceName(c, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "Zona no encontrada"})
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("Error obteniendo zona", "error", err)
+		c.JSON(500, gin.H{"error": "No se pudo obtener la zona"})
+		return
+	}
+
+	occupants, err := h.cache.ZoneOccupants(c, id)
+	if err != nil {
+		h.logger.Errorw("Error leyendo ocupantes", "error", err)
+		c.JSON(500, gin.H{"error": "No se pudieron obtener los ocupantes"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"geofence_id": id,
+		"name":        name,
+		"count":       len(occupants),
+		"data":        occupants,
+	})
+}
+
+// ZoneOccupancy es la cantidad de dispositivos dentro de una zona.
+type ZoneOccupancy struct {
+	GeofenceID uuid.UUID `json:"geofence_id"`
+	Name       string    `json:"name"`
+	Count      int       `json:"count"`
+}
+
+// GetOccupantCounts cuenta los dispositivos dentro de cada zona, para
+// tableros. Acepta los mismos filtros y paginación que GET /geofences.
+func (h *LocationHandler) GetOccupantCounts(c *gin.Context) {
+	params, ok := bindGeofenceFilter(c)
+	if !ok {
+		return
+	}
+
+	zones, err := h.queries.GetGeofences(c, params)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error cargando zonas"})
+		return
+	}
+
+	ids := make([]uuid.UUID, len(zones))
+	for i, z := range zones {
+		ids[i] = z.ID
+	}
+	counts, err := h.cache.OccupantCounts(c, ids)
+	if err != nil {
+		h.logger.Errorw("Error contando ocupantes", "error", err)
+		c.JSON(500, gin.H{"error": "No se pudieron contar los ocupantes"})
+		return
+	}
+
+	data := make([]ZoneOccupancy, len(zones))
+	total := 0
+	for i, z := range zones {
+		data[i] = ZoneOccupancy{GeofenceID: z.ID, Name: z.Name, Count: counts[i]}
+		total += counts[i]
+	}
+	c.JSON(200, gin.H{"total": total, "data": data})
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GeofenceSchedule limita una geocerca a ciertas horas locales. Fuera de
+// horario la zona no cuenta para ENTER/EXIT/DWELL.
+type GeofenceSchedule struct {
+	// Timezone es un nombre IANA, p. ej. "America/Mexico_City".
+	Timezone string           `json:"timezone" binding:"required"`
+	Windows  []ScheduleWindow `json:"windows" binding:"required,min=1,dive"`
+	// Exceptions son fechas locales (YYYY-MM-DD) en las que la zona no se
+	// activa, p. ej. feriados.
+	Exceptions []string `json:"exceptions"`
+}
+
+// ScheduleWindow es un horario semanal. Days usa 0 = domingo; si End es
+// anterior o igual a Start la ventana cruza la medianoche.
+type ScheduleWindow struct {
+	Days  []int  `json:"days" binding:"required,min=1,dive,min=0,max=6"`
+	Start string `json:"start" binding:"required"`
+	End   string `json:"end" binding:"required"`
+}
+
+// validate revisa el formato. La zona horaria además debe existir en
+// Postgres (ver knownTimezone); "Local" depende del servidor y no sirve.
+func (s GeofenceSchedule) validate() error {
+	if _, err := time.LoadLocation(s.Timezone); err != nil || s.Timezone == "Local" {
+		return fmt.Errorf("Zona horaria desconocida: %s", s.Timezone)
+	}
+	for i, w := range s.Windows {
+		if _, err := time.Parse("15:04", w.Start); err != nil {
+			return fmt.Errorf("Ventana %d: start debe ser HH:MM", i+1)
+		}
+		// 24:00 permite cerrar una ventana al final del día.
+		if _, err := time.Parse("15:04", w.End); err != nil && w.End != "24:00" {
+			return fmt.Errorf("Ventana %d: end debe ser HH:MM", i+1)
+		}
+	}
+	for _, date := range s.Exceptions {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("Excepción inválida %q: use YYYY-MM-DD", date)
+		}
+	}
+	return nil
+}
+
+func (h *LocationHandler) GetGeofenceSchedule(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	schedule, err := h.queries.GetGeofenceSchedule(c, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "Zona no encontrada"})
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("Error obteniendo horario", "error", err)
+		c.JSON(500, gin.H{"error": "No se pudo obtener el horario"})
+		return
+	}
+	if schedule == "" {
+		c.JSON(404, gin.H{"error": "La zona no tiene horario"})
+		return
+	}
+
+	c.Data(200, "application/json; charset=utf-8", []byte(schedule))
+}
+
+// PutGeofenceSchedule reemplaza el horario de la zona. Los dispositivos que
+// ya estén adentro reciben ENTER/EXIT sintéticos en el próximo barrido.
+func (h *LocationHandler) PutGeofenceSchedule(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	var req GeofenceSchedule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.knownTimezone(c, req.Timezone) {
+		return
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Error interno"})
+		return
+	}
+	h.setSchedule(c, id, sql.NullString{String: string(data), Valid: true}, req)
+}
+
+// knownTimezone confirma que Postgres conoce la zona horaria; si no, ya
+// respondió. La base de zonas de Go puede traer nombres que Postgres no.
+func (h *LocationHandler) knownTimezone(c *gin.Context, name string) bool {
+	exists, err := h.queries.TimezoneExists(c, name)
+	if err != nil {
+		h.logger.Errorw("Error verificando zona horaria", "error", err)
+		c.JSON(500, gin.H{"error": "No se pudo guardar el horario"})
+		return false
+	}
+	if !exists {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("Zona horaria desconocida: %s", name)})
+		return false
+	}
+	return true
+}
+
+// DeleteGeofenceSchedule deja la zona siempre activa.
+func (h *LocationHandler) DeleteGeofenceSchedule(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "ID inválido"})
+		return
+	}
+	h.setSchedule(c, id, sql.NullString{}, gin.H{"message": "Horario eliminado"})
+}
+
+func (h *LocationHandler) setSchedule(c *gin.Context, id uuid.UUID, schedule sql.NullString, response interface{}) {
+	updated, err := h.queries.SetGeofenceSchedule(c, database.SetGeofenceScheduleParams{
+		Schedule:  schedule,
+		UpdatedBy: actor(c),
+		ID:        id,
+	})
+	if err != nil {
+		h.logger.Errorw("Error guardando horario", "error", err)
+		c.JSON(500, gin.H{"error": "No se pudo guardar el horario"})
+		return
+	}
+	if updated == 0 {
+		c.JSON(404, gin.H{"error": "Zona no encontrada"})
+		return
+	}
+	c.JSON(200, response)
+}
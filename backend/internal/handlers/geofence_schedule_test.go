@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeofenceScheduleValidate(t *testing.T) {
+	weekdays := []ScheduleWindow{{Days: []int{1, 2, 3, 4, 5}, Start: "07:00", End: "09:00"}}
+
+	tests := []struct {
+		name     string
+		schedule GeofenceSchedule
+		valid    bool
+	}{
+		{"días hábiles", GeofenceSchedule{Timezone: "America/Mexico_City", Windows: weekdays}, true},
+		{"nocturna", GeofenceSchedule{Timezone: "UTC", Windows: []ScheduleWindow{{Days: []int{0}, Start: "18:00", End: "06:00"}}}, true},
+		{"hasta 24:00", GeofenceSchedule{Timezone: "UTC", Windows: []ScheduleWindow{{Days: []int{6}, Start: "12:00", End: "24:00"}}}, true},
+		{"con excepciones", GeofenceSchedule{Timezone: "UTC", Windows: weekdays, Exceptions: []string{"2026-12-25"}}, true},
+		{"zona horaria desconocida", GeofenceSchedule{Timezone: "Marte/Olympus", Windows: weekdays}, false},
+		{"zona horaria del servidor", GeofenceSchedule{Timezone: "Local", Windows: weekdays}, false},
+		{"hora inválida", GeofenceSchedule{Timezone: "UTC", Windows: []ScheduleWindow{{Days: []int{1}, Start: "7am", End: "09:00"}}}, false},
+		{"fin inválido", GeofenceSchedule{Timezone: "UTC", Windows: []ScheduleWindow{{Days: []int{1}, Start: "07:00", End: "25:00"}}}, false},
+		{"excepción inválida", GeofenceSchedule{Timezone: "UTC", Windows: weekdays, Exceptions: []string{"25/12/2026"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schedule.validate()
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestPutGeofenceScheduleRejectsTimezone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	// Sin queries: el rechazo ocurre antes de tocar la base.
+	r.PUT("/geofences/:id/schedule", (&LocationHandler{}).PutGeofenceSchedule)
+
+	for _, tz := range []string{"Local", "Marte/Olympus"} {
+		body := `{"timezone":"` + tz + `","windows":[{"days":[1],"start":"07:00","end":"09:00"}]}`
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("PUT", "/geofences/"+uuid.NewString()+"/schedule", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, tz)
+		assert.Contains(t, w.Body.String(), "Zona horaria desconocida", tz)
+	}
+}
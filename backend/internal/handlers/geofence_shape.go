@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	shapePolygon  = "polygon"
+	shapeCircle   = "circle"
+	shapeCorridor = "corridor"
+
+	// Topes fijos para círculos y corredores, aunque GEOFENCE_MAX_AREA_KM2
+	// esté desactivado: más allá el buffer geodésico deja de tener sentido.
+	maxRadiusMeters = 500_000
+	maxWidthMeters  = 50_000
+)
+
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude" binding:"min=-90,max=90"`
+	Longitude float64 `json:"longitude" binding:"min=-180,max=180"`
+}
+
+// GeofenceShape es la geometría de una geocerca: un Polygon o MultiPolygon
+// GeoJSON (con huecos opcionales), un
+// círculo (centro + radio en metros) o un corredor (LineString en geojson +
+// ancho total en metros).
+type GeofenceShape struct {
+	// Type es "polygon" (por defecto), "circle" o "corridor".
+	Type         string    `json:"type" binding:"omitempty,oneof=polygon circle corridor"`
+	GeoJSON      string    `json:"geojson"`
+	Center       *GeoPoint `json:"center"`
+	RadiusMeters float64   `json:"radius_meters" binding:"omitempty,gt=0"`
+	WidthMeters  float64   `json:"width_meters" binding:"omitempty,gt=0"`
+	// Repair intenta reparar un polígono inválido con ST_MakeValid en vez de
+	// rechazarlo.
+	Repair bool `json:"repair"`
+}
+
+// shape devuelve el tipo efectivo: sin type, un geojson es un polígono.
+func (s GeofenceShape) shape() string {
+	if s.Type == "" && s.GeoJSON != "" {
+		return shapePolygon
+	}
+	return s.Type
+}
+
+func (s GeofenceShape) validate() error {
+	switch s.shape() {
+	case shapeCircle:
+		if s.Center == nil || s.RadiusMeters <= 0 {
+			return errors.New("Un círculo necesita center y radius_meters")
+		}
+		if s.RadiusMeters > maxRadiusMeters {
+			return fmt.Errorf("radius_meters no puede superar %d", maxRadiusMeters)
+		}
+	case shapeCorridor:
+		if s.WidthMeters <= 0 {
+			return errors.New("Un corredor necesita width_meters")
+		}
+		if s.WidthMeters > maxWidthMeters {
+			return fmt.Errorf("width_meters no puede superar %d", maxWidthMeters)
+		}
+		if geoJSONType(s.GeoJSON) != "LineString" {
+			return errors.New("Un corredor necesita una LineString en geojson")
+		}
+		return validateLineGeoJSON(s.GeoJSON)
+	case shapePolygon:
+		if s.GeoJSON == "" {
+			return errors.New("Falta el geojson del polígono")
+		}
+		return validatePolygonGeoJSON(s.GeoJSON)
+	default:
+		return errors.New("Falta la geometría de la zona")
+	}
+	return nil
+}
+
+func geoJSONType(raw string) string {
+	var g struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal([]byte(raw), &g); err != nil {
+		return ""
+	}
+	return g.Type
+}
+
+// validatePolygonGeoJSON revisa la estructura de un Polygon o MultiPolygon y
+// explica el primer problema que encuentra. La validez topológica (anillos
+// que se cruzan, huecos fuera del exterior) la decide PostGIS.
+func validatePolygonGeoJSON(raw string) error {
+	var g struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+	if err := json.Unmarshal([]byte(raw), &g); err != nil {
+		return fmt.Errorf("El geojson no es JSON válido: %v", err)
+	}
+
+	switch g.Type {
+	case "Polygon":
+		var rings [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &rings); err != nil {
+			return errors.New("Las coordenadas de un Polygon deben ser una lista de anillos [[lng, lat], ...]")
+		}
+		return validateRings(rings, "")
+	case "MultiPolygon":
+		var polygons [][][][]float64
+		if err := json.Unmarshal(g.Coordinates, &polygons); err != nil {
+			return errors.New("Las coordenadas de un MultiPolygon deben ser una lista de polígonos")
+		}
+		if len(polygons) == 0 {
+			return errors.New("El MultiPolygon no tiene polígonos")
+		}
+		for i, rings := range polygons {
+			if err := validateRings(rings, fmt.Sprintf("polígono %d: ", i+1)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "":
+		return errors.New("El geojson no tiene type")
+	default:
+		return fmt.Errorf("Tipo %s no soportado para una zona: use Polygon o MultiPolygon", g.Type)
+	}
+}
+
+// validateLineGeoJSON revisa la línea central de un corredor. Que no se cruce
+// consigo misma lo decide PostGIS.
+func validateLineGeoJSON(raw string) error {
+	var g struct {
+		Coordinates [][]float64 `json:"coordinates"`
+	}
+	if err := json.Unmarshal([]byte(raw), &g); err != nil {
+		return errors.New("Las coordenadas de una LineString deben ser una lista [[lng, lat], ...]")
+	}
+
+	distinct := 0
+	for i, pos := range g.Coordinates {
+		if len(pos) < 2 {
+			return fmt.Errorf("La posición %d de la línea debe ser [lng, lat]", i+1)
+		}
+		if pos[0] < -180 || pos[0] > 180 || pos[1] < -90 || pos[1] > 90 {
+			return fmt.Errorf("La posición %d de la línea está fuera de rango (se espera [lng, lat])", i+1)
+		}
+		if i == 0 || pos[0] != g.Coordinates[i-1][0] || pos[1] != g.Coordinates[i-1][1] {
+			distinct++
+		}
+	}
+	if distinct < 2 {
+		return errors.New("La línea del corredor necesita al menos 2 posiciones distintas")
+	}
+	return nil
+}
+
+// validateRings revisa los anillos de un polígono: el primero es el exterior
+// y el resto son huecos.
+func validateRings(rings [][][]float64, prefix string) error {
+	if len(rings) == 0 {
+		return fmt.Errorf("%sel polígono no tiene anillos", prefix)
+	}
+
+	for i, ring := range rings {
+		name := "anillo exterior"
+		if i > 0 {
+			name = fmt.Sprintf("hueco %d", i)
+		}
+
+		if len(ring) < 4 {
+			return fmt.Errorf("%s%s necesita al menos 4 posiciones (tiene %d)", prefix, name, len(ring))
+		}
+		for j, pos := range ring {
+			if len(pos) < 2 {
+				return fmt.Errorf("%s%s: la posición %d debe ser [lng, lat]", prefix, name, j+1)
+			}
+			if pos[0] < -180 || pos[0] > 180 || pos[1] < -90 || pos[1] > 90 {
+				return fmt.Errorf("%s%s: la posición %d está fuera de rango (se espera [lng, lat])", prefix, name, j+1)
+			}
+		}
+
+		first, last := ring[0], ring[len(ring)-1]
+		if first[0] != last[0] || first[1] != last[1] {
+			return fmt.Errorf("%s%s no está cerrado: la primera y la última posición deben coincidir", prefix, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeofenceShapeValidate(t *testing.T) {
+	polygon := `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}`
+	line := `{"type": "LineString", "coordinates": [[0, 0], [1, 1]]}`
+	holed := `{"type": "Polygon", "coordinates": [[[0, 0], [4, 0], [4, 4], [0, 4], [0, 0]], [[1, 1], [2, 1], [2, 2], [1, 1]]]}`
+	multi := `{"type": "MultiPolygon", "coordinates": [[[[0, 0], [1, 0], [1, 1], [0, 0]]], [[[5, 5], [6, 5], [6, 6], [5, 5]]]]}`
+	unclosed := `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 1]]]}`
+	short := `{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [0, 0]]]}`
+	badHole := `{"type": "MultiPolygon", "coordinates": [[[[0, 0], [4, 0], [4, 4], [0, 0]], [[1, 1], [2, 1], [2, 2]]]]}`
+	swapped := `{"type": "Polygon", "coordinates": [[[0, 0], [100, 200], [1, 1], [0, 0]]]}`
+	point := `{"type": "LineString", "coordinates": [[1, 1], [1, 1]]}`
+	swappedLine := `{"type": "LineString", "coordinates": [[0, 0], [19.4, -99.1]]}`
+
+	tests := []struct {
+		name  string
+		shape GeofenceShape
+		valid bool
+	}{
+		{"polígono sin type", GeofenceShape{GeoJSON: polygon}, true},
+		{"sin geometría", GeofenceShape{}, false},
+		{"polígono vacío", GeofenceShape{Type: shapePolygon}, false},
+		{"polígono con hueco", GeofenceShape{GeoJSON: holed}, true},
+		{"multipolígono", GeofenceShape{Type: shapePolygon, GeoJSON: multi}, true},
+		{"anillo abierto", GeofenceShape{GeoJSON: unclosed}, false},
+		{"anillo con 3 posiciones", GeofenceShape{GeoJSON: short}, false},
+		{"hueco inválido en multipolígono", GeofenceShape{GeoJSON: badHole}, false},
+		{"coordenadas fuera de rango", GeofenceShape{GeoJSON: swapped}, false},
+		{"línea como polígono", GeofenceShape{Type: shapePolygon, GeoJSON: line}, false},
+		{"geojson roto", GeofenceShape{GeoJSON: `{"type": "Polygon"`}, false},
+		{"círculo", GeofenceShape{Type: shapeCircle, Center: &GeoPoint{Latitude: 19.4, Longitude: -99.1}, RadiusMeters: 150}, true},
+		{"círculo sin radio", GeofenceShape{Type: shapeCircle, Center: &GeoPoint{}}, false},
+		{"círculo sin centro", GeofenceShape{Type: shapeCircle, RadiusMeters: 150}, false},
+		{"círculo gigante", GeofenceShape{Type: shapeCircle, Center: &GeoPoint{}, RadiusMeters: 1e9}, false},
+		{"corredor", GeofenceShape{Type: shapeCorridor, GeoJSON: line, WidthMeters: 40}, true},
+		{"corredor con polígono", GeofenceShape{Type: shapeCorridor, GeoJSON: polygon, WidthMeters: 40}, false},
+		{"corredor sin ancho", GeofenceShape{Type: shapeCorridor, GeoJSON: line}, false},
+		{"corredor demasiado ancho", GeofenceShape{Type: shapeCorridor, GeoJSON: line, WidthMeters: 1e6}, false},
+		{"corredor de un solo punto", GeofenceShape{Type: shapeCorridor, GeoJSON: point, WidthMeters: 40}, false},
+		{"corredor fuera de rango", GeofenceShape{Type: shapeCorridor, GeoJSON: swappedLine, WidthMeters: 40}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.shape.validate()
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestPolygonGeoJSONErrorsExplainTheProblem(t *testing.T) {
+	err := validatePolygonGeoJSON(`{"type": "MultiPolygon", "coordinates": [[[[0, 0], [1, 0], [1, 1], [0, 0]]], [[[0, 0], [4, 0], [4, 4], [0, 0]], [[1, 1], [2, 1], [2, 2], [1, 2]]]]}`)
+	assert.EqualError(t, err, "polígono 2: hueco 1 no está cerrado: la primera y la última posición deben coincidir")
+
+	err = validatePolygonGeoJSON(`{"type": "Point", "coordinates": [0, 0]}`)
+	assert.EqualError(t, err, "Tipo Point no soportado para una zona: use Polygon o MultiPolygon")
+}
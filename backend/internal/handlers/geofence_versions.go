@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// actorHeader dice quién hace un cambio en las geocercas, para el historial.
+// La API key es compartida, así que lo declara el cliente; sin él la versión
+// queda sin autor.
+const actorHeader = "X-Geo-Actor"
+
+func actor(c *gin.Context) sql.NullString {
+	name := strings.TrimSpace(c.GetHeader(actorHeader))
+	if utf8.RuneCountInString(name) > 255 {
+		name = string([]rune(name)[:255])
+	}
+	return sql.NullString{String: name, Valid: name != ""}
+}
+
+// ListGeofenceVersions devuelve el historial de la zona, también si está
+// borrada.
+func (h *LocationHandler) ListGeofenceVersions(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	versions, err := h.queries.ListGeofenceVersions(c, id)
+	if err != nil {
+		h.logger.Errorw("Error listando versiones", "error", err)
+		c.JSON(500, gin.H{"error": "Error cargando el historial"})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(404, gin.H{"error": "Zona no encontrada"})
+		return
+	}
+	c.JSON(200, versions)
+}
+
+// RestoreGeofenceVersion vuelve la zona a una versión anterior. Una zona
+// borrada se restaura así; el cambio queda como una versión nueva.
+func (h *LocationHandler) RestoreGeofenceVersion(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "ID inválido"})
+		return
+	}
+	version, err := strconv.ParseInt(c.Param("version"), 10, 32)
+	if err != nil || version < 1 {
+		c.JSON(400, gin.H{"error": "Versión inválida"})
+		return
+	}
+
+	zone, err := h.queries.RestoreGeofenceVersion(c, database.RestoreGeofenceVersionParams{
+		UpdatedBy:  actor(c),
+		GeofenceID: id,
+		Version:    int32(version),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "Versión no encontrada"})
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("Error restaurando versión", "error", err)
+		c.JSON(500, gin.H{"error": "No se pudo restaurar la zona"})
+		return
+	}
+
+	c.JSON(200, gin.H{"id": zone.ID, "name": zone.Name, "restored_version": version})
+}
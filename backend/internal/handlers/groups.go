@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type DeviceGroupRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+// GeofenceAssignments son los destinatarios de una geocerca. Sin ninguno la
+// zona aplica a todos los dispositivos.
+type GeofenceAssignments struct {
+	AppliesToAll bool                                       `json:"applies_to_all"`
+	DeviceIDs    []string                                   `json:"device_ids"`
+	Groups       []database.ListGeofenceGroupAssignmentsRow `json:"groups"`
+}
+
+// paramUUID lee un parámetro de ruta como UUID; si no lo es ya respondió 400.
+func paramUUID(c *gin.Context, name string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param(name))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "ID inválido"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func (h *LocationHandler) ListDeviceGroups(c *gin.Context) {
+	groups, err := h.queries.ListDeviceGroups(c)
+	if err != nil {
+		h.logger.Errorw("Error listando grupos", "error", err)
+		c.JSON(500, gin.H{"error": "Error cargando grupos"})
+		return
+	}
+	if groups == nil {
+		groups = []database.ListDeviceGroupsRow{}
+	}
+	c.JSON(200, groups)
+}
+
+func (h *LocationHandler) CreateDeviceGroup(c *gin.Context) {
+	var req DeviceGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, err := h.queries.CreateDeviceGroup(c, req.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(409, gin.H{"error": "Ya existe un grupo con ese nombre"})
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("Error creando grupo", "error", err)
+		c.JSON(500, gin.H{"error": "No se pudo crear el grupo"})
+		return
+	}
+	c.JSON(201, group)
+}
+
+func (h *LocationHandler) RenameDeviceGroup(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+	var req DeviceGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, err := h.queries.RenameDeviceGroup(c, database.RenameDeviceGroupParams{Name: req.Name, ID: id})
+	if errors.Is(err, sql.ErrNoRows) {
+		h.groupConflict(c, id, "Ya existe un grupo con ese nombre")
+		return
+	}
+	if err != nil {
+		h.logger.Errorw("Error renombrando grupo", "error", err)
+		c.JSON(500, gin.H{"error": "No se pudo actualizar"})
+		return
+	}
+	c.JSON(200, group)
+}
+
+func (h *LocationHandler) DeleteDeviceGroup(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	deleted, err := h.queries.DeleteDeviceGroup(c, id)
+	if err != nil {
+		h.logger.Errorw("Error borrando grupo", "error", err)
+		c.JSON(500, gin.H{"error": "No se pudo eliminar"})
+		return
+	}
+	if deleted == 0 {
+		h.groupConflict(c, id, "El grupo está asignado a geocercas; quite las asignaciones primero")
+		return
+	}
+	c.JSON(200, gin.H{"message": "Eliminado"})
+}
+
+// groupConflict responde 404 si el grupo no existe y 409 con msg si existe.
+func (h *LocationHandler) groupConflict(c *gin.Context, id uuid.UUID, msg string) {
+	_, err := h.queries.GetDeviceGroup(c, id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(404, gin.H{"error": "Grupo no encontrado"})
+	case err != nil:
+		h.logger.Errorw("Error obteniendo grupo", "error", err)
+		c.JSON(500, gin.H{"error": "Error interno"})
+	default:
+		c.JSON(409, gin.H{"error": msg})
+	}
+}
+
+func (h *LocationHandler) ListDeviceGroupMembers(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	if _, err := h.queries.GetDeviceGroup(c, id); errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "Grupo no encontrado"})
+		return
+	}
+	devices, err := h.queries.ListDeviceGroupMembers(c, id)
+	if err != nil {
+		h.logger.Errorw("Error listando miembros", "error", err)
+		c.JSON(500, gin.H{"error": "Error cargando dispositivos"})
+		return
+	}
+	if devices == nil {
+		devices = []string{}
+	}
+	c.JSON(200, gin.H{"group_id": id, "device_ids": devices})
+}
+
+func (h *LocationHandler) AddDeviceGroupMember(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	added, err := h.queries.AddDeviceGroupMember(c, database.AddDeviceGroupMemberParams{
+		DeviceID: c.Param("device_id"),
+		GroupID:  id,
+	})
+	if err != nil {
+		h.logger.Errorw("Error agregando dispositivo al grupo", "error", err)
+		c.JSON(500, gin.H{"error": "No se pudo agregar el dispositivo"})
+		return
+	}
+	if added == 0 {
+		c.JSON(404, gin.H{"error": "Grupo no encontrado"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Dispositivo agregado"})
+}
+
+func (h *LocationHandler) RemoveDeviceGroupMember(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	removed, err := h.queries.RemoveDeviceGroupMember(c, database.RemoveDeviceGroupMemberParams{
+		GroupID:  id,
+		DeviceID: c.Param("device_id"),
+	})
+	if err != nil {
+		h.logger.Errorw("Error quitando dispositivo del grupo", "error", err)
+		c.JSON(500, gin.H{"error": "No se pudo quitar el dispositivo"})
+		return
+	}
+	if removed == 0 {
+		c.JSON(404, gin.H{"error": "El dispositivo no está en el grupo"})
+		return
+	}
+	c.JSON(200, gin.H{"message": "Dispositivo quitado"})
+}
+
+func (h *LocationHandler) GetGeofenceAssignments(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	devices, err := h.queries.ListGeofenceDeviceAssignments(c, id)
+	if err != nil {
+		h.logger.Errorw("Error listando asignaciones", "error", err)
+		c.JSON(500, gin.H{"error": "Error cargando asignaciones"})
+		return
+	}
+	groups, err := h.queries.ListGeofenceGroupAssignments(c, id)
+	if err != nil {
+		h.logger.Errorw("Error listando asignaciones", "error", err)
+		c.JSON(500, gin.H{"error": "Error cargando asignaciones"})
+		return
+	}
+
+	resp := GeofenceAssignments{
+		AppliesToAll: len(devices) == 0 && len(groups) == 0,
+		DeviceIDs:    devices,
+		Groups:       groups,
+	}
+	if resp.DeviceIDs == nil {
+		resp.DeviceIDs = []string{}
+	}
+	if resp.Groups == nil {
+		resp.Groups = []database.ListGeofenceGroupAssignmentsRow{}
+	}
+	c.JSON(200, resp)
+}
+
+func (h *LocationHandler) AssignGeofenceToDevice(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	assigned, err := h.queries.AssignGeofenceToDevice(c, database.AssignGeofenceToDeviceParams{
+		DeviceID:   c.Param("device_id"),
+		GeofenceID: id,
+	})
+	h.assignmentResult(c, assigned, err, "Zona no encontrada", "Asignada")
+}
+
+func (h *LocationHandler) UnassignGeofenceFromDevice(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	removed, err := h.queries.UnassignGeofenceFromDevice(c, database.UnassignGeofenceFromDeviceParams{
+		GeofenceID: id,
+		DeviceID:   c.Param("device_id"),
+	})
+	h.assignmentResult(c, removed, err, "La zona no está asignada a ese dispositivo", "Asignación eliminada")
+}
+
+func (h *LocationHandler) AssignGeofenceToGroup(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+	groupID, ok := paramUUID(c, "group_id")
+	if !ok {
+		return
+	}
+
+	assigned, err := h.queries.AssignGeofenceToGroup(c, database.AssignGeofenceToGroupParams{
+		GeofenceID: id,
+		GroupID:    groupID,
+	})
+	h.assignmentResult(c, assigned, err, "Zona o grupo no encontrado", "Asignada")
+}
+
+func (h *LocationHandler) UnassignGeofenceFromGroup(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+	groupID, ok := paramUUID(c, "group_id")
+	if !ok {
+		return
+	}
+
+	removed, err := h.queries.UnassignGeofenceFromGroup(c, database.UnassignGeofenceFromGroupParams{
+		GeofenceID: id,
+		GroupID:    groupID,
+	})
+	h.assignmentResult(c, removed, err, "La zona no está asignada a ese grupo", "Asignación eliminada")
+}
+
+func (h *LocationHandler) assignmentResult(c *gin.Context, rows int64, err error, notFound, message string) {
+	if err != nil {
+		h.logger.Errorw("Error actualizando asignaciones", "error", err)
+		c.JSON(500, gin.H{"error": "No se pudo actualizar la asignación"})
+		return
+	}
+	if rows == 0 {
+		c.JSON(404, gin.H{"error": notFound})
+		return
+	}
+	c.JSON(200, gin.H{"message": message})
+}
@@ -3,12 +3,13 @@ package handlers
 import (
 	"context"
 	"database/sql"
-	"fmt"
+	"errors"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
 	"github.com/AlexG695/geo-engine-core/internal/ws"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -19,9 +20,13 @@ import (
 
 type LocationHandler struct {
 	queries     *database.Queries
+	tx          ingest.TxRunner
 	redisClient *redis.Client
+	cache       *ingest.RedisCache
 	logger      *zap.SugaredLogger
 	hub         *ws.Hub
+	ingest      *ingest.Service
+	limits      GeometryLimits
 }
 
 var upgrader = websocket.Upgrader{
@@ -31,149 +36,130 @@ var upgrader = websocket.Upgrader{
 }
 
 type CreateGeofenceRequest struct {
-	Name    string `json:"name" binding:"required"`
-	GeoJSON string `json:"geojson" binding:"required"`
+	Name string `json:"name" binding:"required"`
+	GeofenceShape
+	// DwellSeconds es el umbral para emitir DWELL; 0 u omitido lo desactiva.
+	DwellSeconds *int32 `json:"dwell_seconds" binding:"omitempty,min=0"`
+	// Histéresis: fixes consecutivos (mínimo 1) y segundos que debe durar el
+	// nuevo estado antes de contar la transición, y margen extra para salir.
+	MinFixes           int32   `json:"min_fixes" binding:"omitempty,min=1"`
+	MinDurationSeconds int32   `json:"min_duration_seconds" binding:"omitempty,min=0"`
+	ExitBufferMeters   float64 `json:"exit_buffer_meters" binding:"omitempty,min=0"`
+	// SpeedLimitKmh es el límite dentro de la zona; 0 u omitido usa el
+	// global.
+	SpeedLimitKmh *float64 `json:"speed_limit_kmh" binding:"omitempty,min=0"`
+	GeofenceMetadata
 }
 
-func NewLocationHandler(q *database.Queries, r *redis.Client, l *zap.SugaredLogger, h *ws.Hub) *LocationHandler {
+// validate revisa la geometría y los metadatos.
+func (r CreateGeofenceRequest) validate() error {
+	if err := r.GeofenceShape.validate(); err != nil {
+		return err
+	}
+	return r.GeofenceMetadata.validate()
+}
+
+type LocationRequest struct {
+	DeviceID  string  `json:"device_id" binding:"required"`
+	Latitude  float64 `json:"latitude" binding:"required"`
+	Longitude float64 `json:"longitude" binding:"required"`
+	// Speed va en km/h. Un cliente que mide en m/s (Android) puede mandar
+	// SpeedMps en su lugar.
+	Speed    float64  `json:"speed"`
+	SpeedMps *float64 `json:"speed_mps" binding:"omitempty,min=0"`
+	Heading  float64  `json:"heading"`
+	Accuracy float64  `json:"accuracy"`
+	// RecordedAt es la hora del fix según el dispositivo. Si se omite se usa
+	// la hora de recepción.
+	RecordedAt *time.Time `json:"recorded_at"`
+}
+
+func (r LocationRequest) Fix() ingest.Fix {
+	return ingest.Fix{
+		DeviceID:   r.DeviceID,
+		Latitude:   r.Latitude,
+		Longitude:  r.Longitude,
+		Speed:      ingest.SpeedKmh(r.Speed, r.SpeedMps),
+		Heading:    r.Heading,
+		Accuracy:   r.Accuracy,
+		RecordedAt: r.RecordedAt,
+	}
+}
+
+func NewLocationHandler(q *database.Queries, tx ingest.TxRunner, r *redis.Client, l *zap.SugaredLogger, h *ws.Hub, svc *ingest.Service, limits GeometryLimits) *LocationHandler {
 	return &LocationHandler{
 		queries:     q,
+		tx:          tx,
 		redisClient: r,
+		cache:       ingest.NewRedisCache(r),
 		logger:      l,
 		hub:         h,
+		ingest:      svc,
+		limits:      limits,
 	}
 }
 
 func (h *LocationHandler) RegisterRoutes(r *gin.Engine) {
 	r.POST("/location", h.CreateLocation)
+	r.POST("/locations/batch", h.CreateLocationBatch)
 	r.GET("/drivers/nearby", h.GetNearbyDrivers)
+	r.GET("/drivers/nearest", h.GetNearestDrivers)
+	r.GET("/drivers/within", h.GetDriversWithin)
+	r.POST("/drivers/within", h.PostDriversWithin)
 	r.GET("/drivers/:id/route", h.GetDriverRoute)
+	r.GET("/drivers/:id/status", h.GetDriverStatus)
+	r.PUT("/drivers/:id/status", h.PutDriverStatus)
 	r.GET("/geofences", h.GetGeofences)
 	r.POST("/geofences", h.CreateGeofence)
+	r.POST("/geofences/import", h.ImportGeofences)
+	r.GET("/geofences/export", h.ExportGeofences)
+	r.GET("/geofences/occupants", h.GetOccupantCounts)
 	r.DELETE("/geofences/:id", h.DeleteGeofence)
 	r.PUT("/geofences/:id", h.UpdateGeofence)
+	r.GET("/geofences/:id/schedule", h.GetGeofenceSchedule)
+	r.PUT("/geofences/:id/schedule", h.PutGeofenceSchedule)
+	r.DELETE("/geofences/:id/schedule", h.DeleteGeofenceSchedule)
+	r.GET("/geofences/:id/occupants", h.GetGeofenceOccupants)
+	r.GET("/geofences/:id/versions", h.ListGeofenceVersions)
+	r.POST("/geofences/:id/versions/:version/restore", h.RestoreGeofenceVersion)
+	r.GET("/geofences/:id/assignments", h.GetGeofenceAssignments)
+	r.PUT("/geofences/:id/assignments/devices/:device_id", h.AssignGeofenceToDevice)
+	r.DELETE("/geofences/:id/assignments/devices/:device_id", h.UnassignGeofenceFromDevice)
+	r.PUT("/geofences/:id/assignments/groups/:group_id", h.AssignGeofenceToGroup)
+	r.DELETE("/geofences/:id/assignments/groups/:group_id", h.UnassignGeofenceFromGroup)
+	r.GET("/groups", h.ListDeviceGroups)
+	r.POST("/groups", h.CreateDeviceGroup)
+	r.PUT("/groups/:id", h.RenameDeviceGroup)
+	r.DELETE("/groups/:id", h.DeleteDeviceGroup)
+	r.GET("/groups/:id/devices", h.ListDeviceGroupMembers)
+	r.PUT("/groups/:id/devices/:device_id", h.AddDeviceGroupMember)
+	r.DELETE("/groups/:id/devices/:device_id", h.RemoveDeviceGroupMember)
+	r.GET("/imeis", h.ListDeviceIMEIs)
+	r.PUT("/imeis/:imei", h.PutDeviceIMEI)
+	r.DELETE("/imeis/:imei", h.DeleteDeviceIMEI)
 }
 
 func (h *LocationHandler) CreateLocation(c *gin.Context) {
-	var req struct {
-		DeviceID  string  `json:"device_id" binding:"required"`
-		Latitude  float64 `json:"latitude" binding:"required"`
-		Longitude float64 `json:"longitude" binding:"required"`
-		Speed     float64 `json:"speed"`
-		Heading   float64 `json:"heading"`
-		Accuracy  float64 `json:"accuracy"`
-	}
+	var req LocationRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if req.Latitude < -90 || req.Latitude > 90 || req.Longitude < -180 || req.Longitude > 180 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Coordenadas fuera de rango"})
-		return
-	}
-
-	go h.checkGeofences(req.DeviceID, req.Latitude, req.Longitude)
-
-	id, _ := uuid.NewV7()
-
-	insertedID, err := h.queries.CreateLocation(c, database.CreateLocationParams{
-		ID:        id,
-		DeviceID:  req.DeviceID,
-		Latitude:  req.Latitude,
-		Longitude: req.Longitude,
-		Speed:     sql.NullFloat64{Float64: req.Speed, Valid: true},
-		Heading:   sql.NullFloat64{Float64: req.Heading, Valid: true},
-		Accuracy:  sql.NullFloat64{Float64: req.Accuracy, Valid: true},
-		IsMock:    sql.NullBool{Bool: false, Valid: true},
-	})
-
-	if err != nil {
-		h.logger.Errorw("Error guardando ubicación", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno"})
-		return
-	}
-
-	errRedis := h.redisClient.GeoAdd(c, "drivers:locations", &redis.GeoLocation{
-		Name:      req.DeviceID,
-		Longitude: req.Longitude,
-		Latitude:  req.Latitude,
-	}).Err()
-
-	if errRedis != nil {
-		h.logger.Warnw("Falló actualización en Redis", "error", errRedis)
-	}
+	result, err := h.ingest.Ingest(c, req.Fix())
 
-	updatePayload := gin.H{
-		"type":      "LOCATION_UPDATE",
-		"device_id": req.DeviceID,
-		"latitude":  req.Latitude,
-		"longitude": req.Longitude,
-		"heading":   req.Heading,
-	}
-
-	h.hub.SendUpdate(updatePayload)
-	c.JSON(201, gin.H{"status": "created", "id": insertedID})
-}
-
-func (h *LocationHandler) GetNearbyDrivers(c *gin.Context) {
-	var params struct {
-		Lat    float64 `form:"lat" binding:"required"`
-		Lng    float64 `form:"lng" binding:"required"`
-		Radius float64 `form:"radius" binding:"required"`
-	}
-
-	if err := c.ShouldBindQuery(&params); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Faltan coordenadas o radio"})
-		return
-	}
-
-	locations, err := h.redisClient.GeoSearchLocation(c, "drivers:locations",
-		&redis.GeoSearchLocationQuery{
-			GeoSearchQuery: redis.GeoSearchQuery{
-				Longitude:  params.Lng,
-				Latitude:   params.Lat,
-				Radius:     params.Radius,
-				RadiusUnit: "m",
-			},
-			WithCoord: true,
-			WithDist:  true,
-		},
-	).Result()
-
-	if err == nil && len(locations) > 0 {
-		var response []gin.H
-		for _, loc := range locations {
-			response = append(response, gin.H{
-				"device_id": loc.Name,
-				"latitude":  loc.Latitude,
-				"longitude": loc.Longitude,
-				"distance":  loc.Dist,
-			})
-		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"source": "redis-cache",
-			"count":  len(response),
-			"data":   response,
-		})
+	var validationErr *ingest.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	drivers, err := h.queries.GetNearbyDrivers(c, database.GetNearbyDriversParams{
-		Lng:          params.Lng,
-		Lat:          params.Lat,
-		RadiusMeters: params.Radius,
-	})
-
 	if err != nil {
-		h.logger.Errorw("Error buscando cercanos", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error en el radar"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"count": len(drivers), "data": drivers, "source": "database"})
+	c.JSON(201, gin.H{"status": "created", "id": result.ID})
 }
 
 func (h *LocationHandler) GetDriverRoute(c *gin.Context) {
@@ -209,117 +195,27 @@ func (h *LocationHandler) ServeWS(c *gin.Context) {
 	}()
 }
 
-func (h *LocationHandler) sendGeofenceEvent(deviceID, zoneName, eventType string) {
-	event := gin.H{
-		"type":      "GEOFENCE_EVENT",
-		"device_id": deviceID,
-		"zone_name": zoneName,
-		"event":     eventType,
-		"timestamp": time.Now(),
-	}
-	h.hub.SendUpdate(event)
-	h.logger.Infow("GEOFENCE CHANGE", "device", deviceID, "event", eventType, "zone", zoneName)
-}
-
-func (h *LocationHandler) checkGeofences(deviceID string, lat, lng float64) {
-	ctx := context.Background()
-
-	currentZones, err := h.queries.FindGeofencesContainingPoint(ctx, database.FindGeofencesContainingPointParams{
-		StMakepoint:   lng,
-		StMakepoint_2: lat,
-	})
-	if err != nil {
-		h.logger.Error("Error checking geofences", err)
+// GetGeofences lista las zonas vigentes, filtradas por etiqueta, categoría,
+// nombre o bbox. Con limit pagina y el total va en X-Total-Count.
+func (h *LocationHandler) GetGeofences(c *gin.Context) {
+	params, ok := bindGeofenceFilter(c)
+	if !ok {
 		return
 	}
 
-	currentZoneSet := make(map[string]bool)
-	for _, z := range currentZones {
-		key := fmt.Sprintf("%s|%s", z.ID.String(), z.Name)
-		currentZoneSet[key] = true
-	}
-
-	redisKey := fmt.Sprintf("driver:zones:%s", deviceID)
-	prevZones, err := h.redisClient.SMembers(ctx, redisKey).Result()
-	if err != nil {
-		prevZones = []string{}
-	}
-
-	for _, prevKey := range prevZones {
-		if !currentZoneSet[prevKey] {
-			parts := strings.Split(prevKey, "|")
-			if len(parts) < 2 {
-				continue
-			}
-
-			idStr := parts[0]
-			name := parts[1]
-
-			zoneID, _ := uuid.Parse(idStr)
-			if len(parts) > 1 {
-				name = parts[1]
-			}
-
-			h.sendGeofenceEvent(deviceID, name, "EXIT")
-
-			go func(zid uuid.UUID, did string) {
-				h.queries.LogGeofenceEvent(context.Background(), database.LogGeofenceEventParams{
-					GeofenceID: zid,
-					DeviceID:   did,
-					EventType:  "EXIT",
-				})
-			}(zoneID, deviceID)
-		}
-	}
-
-	pipeline := h.redisClient.Pipeline()
-	pipeline.Del(ctx, redisKey)
-
-	for currentKey := range currentZoneSet {
-		isNew := true
-		for _, prevKey := range prevZones {
-			if prevKey == currentKey {
-				isNew = false
-				break
-			}
-		}
-
-		if isNew {
-			parts := strings.Split(currentKey, "|")
-			if len(parts) < 2 {
-				continue
-			}
-
-			idStr := parts[0]
-			name := parts[1]
-
-			zoneID, _ := uuid.Parse(idStr)
-			h.sendGeofenceEvent(deviceID, name, "ENTER")
-			go func(zid uuid.UUID, did string) {
-				h.queries.LogGeofenceEvent(context.Background(), database.LogGeofenceEventParams{
-					GeofenceID: zid,
-					DeviceID:   did,
-					EventType:  "ENTER",
-				})
-			}(zoneID, deviceID)
-		}
-
-		pipeline.SAdd(ctx, redisKey, currentKey)
-	}
-
-	if len(currentZoneSet) > 0 {
-		pipeline.Expire(ctx, redisKey, 24*time.Hour)
-	}
-
-	pipeline.Exec(ctx)
-}
-
-func (h *LocationHandler) GetGeofences(c *gin.Context) {
-	zones, err := h.queries.GetGeofences(c)
+	zones, err := h.queries.GetGeofences(c, params)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Error cargando zonas"})
 		return
 	}
+	if params.PageLimit.Valid {
+		total, err := h.queries.CountGeofences(c, countParams(params))
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Error cargando zonas"})
+			return
+		}
+		c.Header("X-Total-Count", strconv.Itoa(int(total)))
+	}
 	c.JSON(200, zones)
 }
 
@@ -329,19 +225,107 @@ func (h *LocationHandler) CreateGeofence(c *gin.Context) {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
+	if err := req.validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
-	_, err := h.queries.CreateGeofence(c, database.CreateGeofenceParams{
-		Name:              req.Name,
-		StGeomfromgeojson: req.GeoJSON,
-	})
+	geojson, ok := h.checkShape(c, req.GeofenceShape)
+	if !ok {
+		return
+	}
 
+	id, err := createGeofence(c, h.queries, req, geojson, actor(c))
 	if err != nil {
 		h.logger.Error("Error creating geofence from drawing", err)
 		c.JSON(500, gin.H{"error": "No se pudo guardar la zona dibujada"})
 		return
 	}
 
-	c.Status(201)
+	c.JSON(201, gin.H{"id": id, "repaired": geojson != req.GeoJSON})
+}
+
+// createGeofence guarda una zona ya validada con q (las queries del handler o
+// las de una transacción); geojson es el polígono a usar (el reparado, si lo
+// hubo).
+func createGeofence(ctx context.Context, q database.Querier, req CreateGeofenceRequest, geojson string, updatedBy sql.NullString) (uuid.UUID, error) {
+	var dwell sql.NullInt32
+	if req.DwellSeconds != nil && *req.DwellSeconds > 0 {
+		dwell = sql.NullInt32{Int32: *req.DwellSeconds, Valid: true}
+	}
+
+	var speedLimit sql.NullFloat64
+	if req.SpeedLimitKmh != nil && *req.SpeedLimitKmh > 0 {
+		speedLimit = sql.NullFloat64{Float64: *req.SpeedLimitKmh, Valid: true}
+	}
+
+	if req.MinFixes == 0 {
+		req.MinFixes = 1
+	}
+
+	var id uuid.UUID
+	var err error
+	switch req.shape() {
+	case shapeCircle:
+		var zone database.CreateCircleGeofenceRow
+		zone, err = q.CreateCircleGeofence(ctx, database.CreateCircleGeofenceParams{
+			Name:               req.Name,
+			Lng:                req.Center.Longitude,
+			Lat:                req.Center.Latitude,
+			RadiusMeters:       req.RadiusMeters,
+			DwellSeconds:       dwell,
+			MinFixes:           req.MinFixes,
+			MinDurationSeconds: req.MinDurationSeconds,
+			ExitBufferMeters:   req.ExitBufferMeters,
+			SpeedLimitKmh:      speedLimit,
+			UpdatedBy:          updatedBy,
+			Description:        createText(req.Description),
+			Color:              createText(req.Color),
+			Category:           createText(req.Category),
+			Tags:               req.tags(),
+			Properties:         req.properties(),
+		})
+		id = zone.ID
+	case shapeCorridor:
+		var zone database.CreateCorridorGeofenceRow
+		zone, err = q.CreateCorridorGeofence(ctx, database.CreateCorridorGeofenceParams{
+			Name:               req.Name,
+			Geojson:            req.GeoJSON,
+			WidthMeters:        req.WidthMeters,
+			DwellSeconds:       dwell,
+			MinFixes:           req.MinFixes,
+			MinDurationSeconds: req.MinDurationSeconds,
+			ExitBufferMeters:   req.ExitBufferMeters,
+			SpeedLimitKmh:      speedLimit,
+			UpdatedBy:          updatedBy,
+			Description:        createText(req.Description),
+			Color:              createText(req.Color),
+			Category:           createText(req.Category),
+			Tags:               req.tags(),
+			Properties:         req.properties(),
+		})
+		id = zone.ID
+	default:
+		var zone database.CreateGeofenceRow
+		zone, err = q.CreateGeofence(ctx, database.CreateGeofenceParams{
+			Name:               req.Name,
+			StGeomfromgeojson:  geojson,
+			DwellSeconds:       dwell,
+			MinFixes:           req.MinFixes,
+			MinDurationSeconds: req.MinDurationSeconds,
+			ExitBufferMeters:   req.ExitBufferMeters,
+			SpeedLimitKmh:      speedLimit,
+			UpdatedBy:          updatedBy,
+			Description:        createText(req.Description),
+			Color:              createText(req.Color),
+			Category:           createText(req.Category),
+			Tags:               req.tags(),
+			Properties:         req.properties(),
+		})
+		id = zone.ID
+	}
+
+	return id, err
 }
 
 func (h *LocationHandler) DeleteGeofence(c *gin.Context) {
@@ -354,12 +338,16 @@ func (h *LocationHandler) DeleteGeofence(c *gin.Context) {
 		return
 	}
 
-	err = h.queries.DeleteGeofence(c, id)
+	deleted, err := h.queries.DeleteGeofence(c, database.DeleteGeofenceParams{UpdatedBy: actor(c), ID: id})
 	if err != nil {
 		h.logger.Error("Error deleting geofence", err)
 		c.JSON(500, gin.H{"error": "No se pudo eliminar"})
 		return
 	}
+	if deleted == 0 {
+		c.JSON(404, gin.H{"error": "Zona no encontrada"})
+		return
+	}
 
 	c.JSON(200, gin.H{"message": "Eliminado"})
 }
@@ -374,8 +362,18 @@ func (h *LocationHandler) UpdateGeofence(c *gin.Context) {
 	}
 
 	var req struct {
-		Name    string `json:"name" binding:"required"`
-		GeoJSON string `json:"geojson"`
+		Name string `json:"name" binding:"required"`
+		// Sin type ni geojson se conserva la geometría actual.
+		GeofenceShape
+		// Omitido conserva el umbral actual; 0 lo desactiva.
+		DwellSeconds *int32 `json:"dwell_seconds" binding:"omitempty,min=0"`
+		// Omitidos conservan la histéresis actual.
+		MinFixes           *int32   `json:"min_fixes" binding:"omitempty,min=1"`
+		MinDurationSeconds *int32   `json:"min_duration_seconds" binding:"omitempty,min=0"`
+		ExitBufferMeters   *float64 `json:"exit_buffer_meters" binding:"omitempty,min=0"`
+		// Omitido conserva el límite actual; 0 vuelve al global.
+		SpeedLimitKmh *float64 `json:"speed_limit_kmh" binding:"omitempty,min=0"`
+		GeofenceMetadata
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -383,12 +381,64 @@ func (h *LocationHandler) UpdateGeofence(c *gin.Context) {
 		return
 	}
 
-	updated, err := h.queries.UpdateGeofence(c, database.UpdateGeofenceParams{
-		ID:      id,
-		Name:    req.Name,
-		Column3: req.GeoJSON,
-	})
+	if err := req.GeofenceMetadata.validate(); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
 
+	var dwell sql.NullInt32
+	if req.DwellSeconds != nil {
+		dwell = sql.NullInt32{Int32: *req.DwellSeconds, Valid: true}
+	}
+
+	params := database.UpdateGeofenceParams{
+		ID:           id,
+		Name:         req.Name,
+		Geojson:      req.GeoJSON,
+		RadiusMeters: req.RadiusMeters,
+		WidthMeters:  req.WidthMeters,
+		DwellSeconds: dwell,
+		Description:  updateText(req.Description),
+		Color:        updateText(req.Color),
+		Category:     updateText(req.Category),
+		Tags:         req.tags(),
+		UpdatedBy:    actor(c),
+	}
+	if properties := req.properties(); properties != nil {
+		params.Properties = sql.NullString{String: string(properties), Valid: true}
+	}
+	if shape := req.shape(); shape != "" {
+		if err := req.GeofenceShape.validate(); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		var ok bool
+		if params.Geojson, ok = h.checkShape(c, req.GeofenceShape); !ok {
+			return
+		}
+		params.Shape = sql.NullString{String: shape, Valid: true}
+		if req.Center != nil {
+			params.Lat, params.Lng = req.Center.Latitude, req.Center.Longitude
+		}
+	}
+	if req.MinFixes != nil {
+		params.MinFixes = sql.NullInt32{Int32: *req.MinFixes, Valid: true}
+	}
+	if req.MinDurationSeconds != nil {
+		params.MinDurationSeconds = sql.NullInt32{Int32: *req.MinDurationSeconds, Valid: true}
+	}
+	if req.ExitBufferMeters != nil {
+		params.ExitBufferMeters = sql.NullFloat64{Float64: *req.ExitBufferMeters, Valid: true}
+	}
+	if req.SpeedLimitKmh != nil {
+		params.SpeedLimitKmh = sql.NullFloat64{Float64: *req.SpeedLimitKmh, Valid: true}
+	}
+
+	updated, err := h.queries.UpdateGeofence(c, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(404, gin.H{"error": "Zona no encontrada"})
+		return
+	}
 	if err != nil {
 		h.logger.Error("Error updating geofence", err)
 		c.JSON(500, gin.H{"error": "No se pudo actualizar"})
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+	"github.com/gin-gonic/gin"
+)
+
+type BatchLocationRequest struct {
+	Locations []LocationRequest `json:"locations" binding:"required"`
+}
+
+// CreateLocationBatch guarda un lote de ubicaciones (posiblemente de varios
+// dispositivos) en una sola transacción. Los fixes inválidos se reportan por
+// ítem sin abortar el resto del lote.
+func (h *LocationHandler) CreateLocationBatch(c *gin.Context) {
+	var req BatchLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Locations) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El lote está vacío"})
+		return
+	}
+	if len(req.Locations) > ingest.MaxBatchSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "El lote excede el máximo permitido", "max": ingest.MaxBatchSize})
+		return
+	}
+
+	fixes := make([]ingest.Fix, len(req.Locations))
+	for i, loc := range req.Locations {
+		fixes[i] = loc.Fix()
+	}
+
+	results, err := h.ingest.IngestBatch(c, fixes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error interno"})
+		return
+	}
+
+	accepted := 0
+	for _, r := range results {
+		if r.Status == "created" {
+			accepted++
+		}
+	}
+
+	c.JSON(http.StatusMultiStatus, gin.H{
+		"accepted": accepted,
+		"rejected": len(results) - accepted,
+		"results":  results,
+	})
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+)
+
+func TestCreateLocationBatchRejectsEmptyAndOversized(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/locations/batch", (&LocationHandler{}).CreateLocationBatch)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/locations/batch", strings.NewReader(body)))
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"locations":[]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"locations":`).Code)
+
+	item := `{"device_id":"bus-1","latitude":1,"longitude":1}`
+	w := post(`{"locations":[` + strings.Repeat(item+",", ingest.MaxBatchSize) + item + `]}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), `"max":1000`)
+}
+
+func TestCreateLocationBatchReportsInvalidItems(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Sin ítems válidos el servicio no toca la base ni el cache.
+	svc := ingest.NewService(nil, nil, nil, nil, zap.NewNop().Sugar(), ingest.Options{
+		MaxClockSkew: time.Minute,
+		MaxFixAge:    time.Hour,
+	})
+	defer svc.Close()
+
+	r := gin.New()
+	r.POST("/locations/batch", (&LocationHandler{ingest: svc}).CreateLocationBatch)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/locations/batch", strings.NewReader(`{"locations":[
+		{"device_id":"bus-1","latitude":95,"longitude":1},
+		{"latitude":1,"longitude":1}
+	]}`)))
+	require.Equal(t, http.StatusMultiStatus, w.Code)
+
+	var resp struct {
+		Accepted int                `json:"accepted"`
+		Rejected int                `json:"rejected"`
+		Results  []ingest.BatchItem `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Zero(t, resp.Accepted)
+	assert.Equal(t, 2, resp.Rejected)
+	require.Len(t, resp.Results, 2)
+	for i, item := range resp.Results {
+		assert.Equal(t, i, item.Index)
+		assert.Equal(t, "invalid", item.Status)
+		assert.NotEmpty(t, item.Error)
+		assert.Nil(t, item.ID)
+	}
+	assert.Equal(t, "bus-1", resp.Results[0].DeviceID)
+}
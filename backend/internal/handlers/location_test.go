@@ -3,8 +3,11 @@ package handlers_test
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"math"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
@@ -46,12 +49,13 @@ func TestGeofenceLifecycle(t *testing.T) {
 	geofence, err := queries.CreateGeofence(ctx, database.CreateGeofenceParams{
 		Name:              name,
 		StGeomfromgeojson: geojson,
+		MinFixes:          1,
 	})
 	require.NoError(t, err)
 	t.Logf("Zona creada: %s", geofence.Name)
 
 	defer func() {
-		_ = queries.DeleteGeofence(ctx, geofence.ID)
+		_, _ = queries.DeleteGeofence(ctx, database.DeleteGeofenceParams{ID: geofence.ID})
 	}()
 	zonesInside, err := queries.FindGeofencesContainingPoint(ctx, database.FindGeofencesContainingPointParams{
 		StMakepoint:   -99.167,
@@ -94,10 +98,11 @@ func TestConcurrentEvents(t *testing.T) {
 	zone, err := queries.CreateGeofence(ctx, database.CreateGeofenceParams{
 		Name:              geoName,
 		StGeomfromgeojson: geoJson,
+		MinFixes:          1,
 	})
 	require.NoError(t, err)
 
-	defer queries.DeleteGeofence(ctx, zone.ID)
+	defer queries.DeleteGeofence(ctx, database.DeleteGeofenceParams{ID: zone.ID})
 
 	var wg sync.WaitGroup
 	workers := 20
@@ -113,6 +118,7 @@ func TestConcurrentEvents(t *testing.T) {
 				GeofenceID: zone.ID,
 				DeviceID:   deviceID,
 				EventType:  "ENTER",
+				Timestamp:  time.Now().UTC(),
 			})
 			assert.NoError(t, err, "Fallo en escritura concurrente")
 		}()
@@ -121,3 +127,682 @@ func TestConcurrentEvents(t *testing.T) {
 	wg.Wait()
 	t.Log("Todas las goroutines terminaron sin errores")
 }
+
+func zoneRow(zones []database.FindGeofencesContainingPointRow, id uuid.UUID) (database.FindGeofencesContainingPointRow, bool) {
+	for _, z := range zones {
+		if z.ID == id {
+			return z, true
+		}
+	}
+	return database.FindGeofencesContainingPointRow{}, false
+}
+
+func TestCircleAndCorridorGeofences(t *testing.T) {
+	db, queries := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	circle, err := queries.CreateCircleGeofence(ctx, database.CreateCircleGeofenceParams{
+		Name:         "Test Circle " + uuid.New().String(),
+		Lng:          -99.167,
+		Lat:          19.427,
+		RadiusMeters: 200,
+		MinFixes:     1,
+	})
+	require.NoError(t, err)
+	defer queries.DeleteGeofence(ctx, database.DeleteGeofenceParams{ID: circle.ID})
+
+	// ~0.0017° de latitud son ~188 m: dentro, cerca del borde.
+	zones, err := queries.FindGeofencesContainingPoint(ctx, database.FindGeofencesContainingPointParams{
+		StMakepoint:   -99.167,
+		StMakepoint_2: 19.4287,
+	})
+	require.NoError(t, err)
+	z, ok := zoneRow(zones, circle.ID)
+	require.True(t, ok, "El punto debería estar DENTRO del círculo")
+	assert.True(t, z.Inside)
+	assert.InDelta(t, 12, z.BoundaryDistanceMeters, 2)
+
+	// ~0.0019° son ~210 m: afuera; la zona vuelve solo por Column3.
+	zones, err = queries.FindGeofencesContainingPoint(ctx, database.FindGeofencesContainingPointParams{
+		StMakepoint:   -99.167,
+		StMakepoint_2: 19.4289,
+		Column3:       []uuid.UUID{circle.ID},
+	})
+	require.NoError(t, err)
+	z, ok = zoneRow(zones, circle.ID)
+	require.True(t, ok)
+	assert.False(t, z.Inside, "El punto debería estar FUERA del círculo")
+
+	corridor, err := queries.CreateCorridorGeofence(ctx, database.CreateCorridorGeofenceParams{
+		Name:        "Test Corridor " + uuid.New().String(),
+		Geojson:     `{"type": "LineString", "coordinates": [[-99.20, 19.40], [-99.10, 19.40]]}`,
+		WidthMeters: 100,
+		MinFixes:    1,
+	})
+	require.NoError(t, err)
+	defer queries.DeleteGeofence(ctx, database.DeleteGeofenceParams{ID: corridor.ID})
+
+	zones, err = queries.FindGeofencesContainingPoint(ctx, database.FindGeofencesContainingPointParams{
+		StMakepoint:   -99.15,
+		StMakepoint_2: 19.4004,
+	})
+	require.NoError(t, err)
+	z, ok = zoneRow(zones, corridor.ID)
+	require.True(t, ok, "El punto debería estar DENTRO del corredor")
+	assert.True(t, z.Inside)
+
+	all, err := queries.GetGeofences(ctx, database.GetGeofencesParams{})
+	require.NoError(t, err)
+	for _, g := range all {
+		switch g.ID {
+		case circle.ID:
+			assert.Equal(t, "circle", g.Shape)
+			assert.InDelta(t, 19.427, g.CenterLatitude, 1e-9)
+			assert.InDelta(t, -99.167, g.CenterLongitude, 1e-9)
+			assert.Equal(t, 200.0, g.RadiusMeters)
+		case corridor.ID:
+			assert.Equal(t, "corridor", g.Shape)
+			assert.Contains(t, g.PathGeojson, "LineString")
+			assert.Equal(t, 100.0, g.WidthMeters)
+		}
+	}
+}
+
+func TestMultiPolygonWithHoleGeofence(t *testing.T) {
+	db, queries := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	// Ciudad con un lago (hueco) más un aeropuerto separado.
+	geojson := `{"type": "MultiPolygon", "coordinates": [
+		[[[-99.20, 19.40], [-99.10, 19.40], [-99.10, 19.50], [-99.20, 19.50], [-99.20, 19.40]],
+		 [[-99.16, 19.44], [-99.14, 19.44], [-99.14, 19.46], [-99.16, 19.46], [-99.16, 19.44]]],
+		[[[-99.08, 19.42], [-99.06, 19.42], [-99.06, 19.44], [-99.08, 19.44], [-99.08, 19.42]]]
+	]}`
+	zone, err := queries.CreateGeofence(ctx, database.CreateGeofenceParams{
+		Name:              "Test Multi " + uuid.New().String(),
+		StGeomfromgeojson: geojson,
+		MinFixes:          1,
+	})
+	require.NoError(t, err)
+	defer queries.DeleteGeofence(ctx, database.DeleteGeofenceParams{ID: zone.ID})
+
+	inside := func(lng, lat float64) bool {
+		zones, err := queries.FindGeofencesContainingPoint(ctx, database.FindGeofencesContainingPointParams{
+			StMakepoint:   lng,
+			StMakepoint_2: lat,
+			Column3:       []uuid.UUID{zone.ID},
+		})
+		require.NoError(t, err)
+		z, ok := zoneRow(zones, zone.ID)
+		return ok && z.Inside
+	}
+
+	assert.True(t, inside(-99.18, 19.42), "La ciudad debería contar como DENTRO")
+	assert.True(t, inside(-99.07, 19.43), "El aeropuerto debería contar como DENTRO")
+	assert.False(t, inside(-99.15, 19.45), "El lago debería contar como FUERA")
+	assert.False(t, inside(-99.09, 19.43), "Entre ambas partes debería contar como FUERA")
+}
+
+func TestCheckGeofenceGeometry(t *testing.T) {
+	db, queries := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	// Moño: los lados se cruzan en (-99.15, 19.45).
+	bowtie := `{"type": "Polygon", "coordinates": [[[-99.20, 19.40], [-99.10, 19.50], [-99.10, 19.40], [-99.20, 19.50], [-99.20, 19.40]]]}`
+
+	check, err := queries.CheckGeofenceGeometry(ctx, database.CheckGeofenceGeometryParams{Geojson: bowtie})
+	require.NoError(t, err)
+	assert.False(t, check.Valid)
+	assert.False(t, check.Repaired)
+	assert.Contains(t, check.Reason, "Self-intersection")
+	require.True(t, check.HasLocation)
+	assert.InDelta(t, 19.45, check.LocationLatitude, 1e-6)
+	assert.InDelta(t, -99.15, check.LocationLongitude, 1e-6)
+
+	check, err = queries.CheckGeofenceGeometry(ctx, database.CheckGeofenceGeometryParams{Geojson: bowtie, Repair: true})
+	require.NoError(t, err)
+	assert.True(t, check.Repaired)
+	assert.Contains(t, check.Geojson, "MultiPolygon")
+	assert.Greater(t, check.AreaSqMeters, 0.0)
+
+	square := `{"type": "Polygon", "coordinates": [[[-99.20, 19.40], [-99.10, 19.40], [-99.10, 19.50], [-99.20, 19.50], [-99.20, 19.40]]]}`
+	check, err = queries.CheckGeofenceGeometry(ctx, database.CheckGeofenceGeometryParams{Geojson: square})
+	require.NoError(t, err)
+	assert.True(t, check.Valid)
+	assert.Equal(t, int32(5), check.Vertices)
+	// ~10.5 km x 11.1 km
+	assert.InDelta(t, 116e6, check.AreaSqMeters, 3e6)
+}
+
+func TestCheckBufferedGeometry(t *testing.T) {
+	db, queries := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	circle, err := queries.CheckCircleGeometry(ctx, database.CheckCircleGeometryParams{Lng: -99.15, Lat: 19.45, RadiusMeters: 1000})
+	require.NoError(t, err)
+	assert.InDelta(t, math.Pi*1e6, circle.AreaSqMeters, 0.05*math.Pi*1e6)
+	assert.Greater(t, circle.Vertices, int32(30))
+
+	// La línea regresa cruzando su primer tramo.
+	crossing := `{"type": "LineString", "coordinates": [[-99.20, 19.40], [-99.10, 19.50], [-99.10, 19.40], [-99.20, 19.50]]}`
+	corridor, err := queries.CheckCorridorGeometry(ctx, database.CheckCorridorGeometryParams{Geojson: crossing, WidthMeters: 50})
+	require.NoError(t, err)
+	assert.False(t, corridor.Simple)
+
+	straight := `{"type": "LineString", "coordinates": [[-99.20, 19.40], [-99.10, 19.40]]}`
+	corridor, err = queries.CheckCorridorGeometry(ctx, database.CheckCorridorGeometryParams{Geojson: straight, WidthMeters: 100})
+	require.NoError(t, err)
+	assert.True(t, corridor.Simple)
+	// ~10.5 km x 100 m más las puntas redondeadas.
+	assert.InDelta(t, 1.06e6, corridor.AreaSqMeters, 0.05e6)
+}
+
+func TestGeofenceSchedule(t *testing.T) {
+	db, queries := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	zone, err := queries.CreateGeofence(ctx, database.CreateGeofenceParams{
+		Name:              "Test Escuela " + uuid.New().String(),
+		StGeomfromgeojson: `{"type": "Polygon", "coordinates": [[[-99.20, 19.40], [-99.10, 19.40], [-99.10, 19.50], [-99.20, 19.50], [-99.20, 19.40]]]}`,
+		MinFixes:          1,
+	})
+	require.NoError(t, err)
+	defer queries.DeleteGeofence(ctx, database.DeleteGeofenceParams{ID: zone.ID})
+
+	// Días hábiles 7–9 y domingo nocturno; el 2026-10-16 (viernes) es feriado.
+	schedule := `{"timezone": "America/Mexico_City", "windows": [
+		{"days": [1, 2, 3, 4, 5], "start": "07:00", "end": "09:00"},
+		{"days": [0], "start": "22:00", "end": "02:00"}
+	], "exceptions": ["2026-10-16"]}`
+	updated, err := queries.SetGeofenceSchedule(ctx, database.SetGeofenceScheduleParams{
+		Schedule: sql.NullString{String: schedule, Valid: true},
+		ID:       zone.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), updated)
+
+	mexico, err := time.LoadLocation("America/Mexico_City")
+	require.NoError(t, err)
+	activeAt := func(at time.Time) bool {
+		zones, err := queries.FindGeofencesContainingPoint(ctx, database.FindGeofencesContainingPointParams{
+			StMakepoint:   -99.15,
+			StMakepoint_2: 19.45,
+			Column4:       at,
+		})
+		require.NoError(t, err)
+		_, ok := zoneRow(zones, zone.ID)
+		return ok
+	}
+
+	cases := []struct {
+		name   string
+		at     time.Time
+		active bool
+	}{
+		{"miércoles 8:00", time.Date(2026, 10, 14, 8, 0, 0, 0, mexico), true},
+		{"miércoles 9:00", time.Date(2026, 10, 14, 9, 0, 0, 0, mexico), false},
+		{"feriado 8:00", time.Date(2026, 10, 16, 8, 0, 0, 0, mexico), false},
+		{"domingo 23:00", time.Date(2026, 10, 18, 23, 0, 0, 0, mexico), true},
+		{"lunes 1:00, cola del domingo", time.Date(2026, 10, 19, 1, 0, 0, 0, mexico), true},
+		{"lunes 3:00", time.Date(2026, 10, 19, 3, 0, 0, 0, mexico), false},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.active, activeAt(tc.at), tc.name)
+	}
+
+	// Fuera de horario la zona solo vuelve por Column3, marcada.
+	zones, err := queries.FindGeofencesContainingPoint(ctx, database.FindGeofencesContainingPointParams{
+		StMakepoint:   -99.15,
+		StMakepoint_2: 19.45,
+		Column3:       []uuid.UUID{zone.ID},
+		Column4:       time.Date(2026, 10, 14, 12, 0, 0, 0, mexico),
+	})
+	require.NoError(t, err)
+	z, ok := zoneRow(zones, zone.ID)
+	require.True(t, ok)
+	assert.True(t, z.OffSchedule)
+}
+
+func TestGeofenceAssignments(t *testing.T) {
+	db, queries := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	zone, err := queries.CreateGeofence(ctx, database.CreateGeofenceParams{
+		Name:              "Test Depósito " + uuid.New().String(),
+		StGeomfromgeojson: `{"type": "Polygon", "coordinates": [[[-99.20, 19.40], [-99.10, 19.40], [-99.10, 19.50], [-99.20, 19.50], [-99.20, 19.40]]]}`,
+		MinFixes:          1,
+	})
+	require.NoError(t, err)
+	defer queries.DeleteGeofence(ctx, database.DeleteGeofenceParams{ID: zone.ID})
+
+	group, err := queries.CreateDeviceGroup(ctx, "Test Camiones "+uuid.New().String())
+	require.NoError(t, err)
+	defer queries.DeleteDeviceGroup(ctx, group.ID)
+
+	appliesTo := func(deviceID string) bool {
+		zones, err := queries.FindGeofencesContainingPoint(ctx, database.FindGeofencesContainingPointParams{
+			StMakepoint:   -99.15,
+			StMakepoint_2: 19.45,
+			Column4:       time.Now(),
+			Column5:       deviceID,
+		})
+		require.NoError(t, err)
+		_, ok := zoneRow(zones, zone.ID)
+		return ok
+	}
+
+	// Sin asignaciones la zona aplica a todos.
+	assert.True(t, appliesTo("camion-1"))
+	assert.True(t, appliesTo("moto-1"))
+
+	added, err := queries.AddDeviceGroupMember(ctx, database.AddDeviceGroupMemberParams{DeviceID: "camion-1", GroupID: group.ID})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), added)
+	assigned, err := queries.AssignGeofenceToGroup(ctx, database.AssignGeofenceToGroupParams{GeofenceID: zone.ID, GroupID: group.ID})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), assigned)
+	assigned, err = queries.AssignGeofenceToDevice(ctx, database.AssignGeofenceToDeviceParams{DeviceID: "van-1", GeofenceID: zone.ID})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), assigned)
+
+	assert.True(t, appliesTo("camion-1"), "asignada por grupo")
+	assert.True(t, appliesTo("van-1"), "asignada directamente")
+	assert.False(t, appliesTo("moto-1"))
+
+	// Un grupo asignado no se puede borrar: la zona pasaría a aplicar a todos.
+	deleted, err := queries.DeleteDeviceGroup(ctx, group.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), deleted)
+
+	removed, err := queries.UnassignGeofenceFromGroup(ctx, database.UnassignGeofenceFromGroupParams{GeofenceID: zone.ID, GroupID: group.ID})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), removed)
+	assert.False(t, appliesTo("camion-1"))
+	assert.True(t, appliesTo("van-1"))
+
+	deleted, err = queries.DeleteDeviceGroup(ctx, group.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
+
+func TestGeofenceSpeedLimit(t *testing.T) {
+	db, queries := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	zone, err := queries.CreateGeofence(ctx, database.CreateGeofenceParams{
+		Name:              "Test Zona Escolar " + uuid.New().String(),
+		StGeomfromgeojson: `{"type": "Polygon", "coordinates": [[[-99.20, 19.40], [-99.10, 19.40], [-99.10, 19.50], [-99.20, 19.50], [-99.20, 19.40]]]}`,
+		MinFixes:          1,
+		SpeedLimitKmh:     sql.NullFloat64{Float64: 30, Valid: true},
+	})
+	require.NoError(t, err)
+	defer queries.DeleteGeofence(ctx, database.DeleteGeofenceParams{ID: zone.ID})
+
+	zones, err := queries.FindGeofencesContainingPoint(ctx, database.FindGeofencesContainingPointParams{
+		StMakepoint:   -99.15,
+		StMakepoint_2: 19.45,
+		Column4:       time.Now(),
+	})
+	require.NoError(t, err)
+	z, ok := zoneRow(zones, zone.ID)
+	require.True(t, ok)
+	assert.Equal(t, 30.0, z.SpeedLimitKmh)
+
+	// 0 vuelve al límite global.
+	updated, err := queries.UpdateGeofence(ctx, database.UpdateGeofenceParams{
+		ID:            zone.ID,
+		Name:          zone.Name,
+		SpeedLimitKmh: sql.NullFloat64{Float64: 0, Valid: true},
+	})
+	require.NoError(t, err)
+	assert.Zero(t, updated.SpeedLimitKmh)
+
+	err = queries.LogGeofenceEvent(ctx, database.LogGeofenceEventParams{
+		GeofenceID:      zone.ID,
+		DeviceID:        "test-overspeed",
+		EventType:       "OVERSPEED",
+		Timestamp:       time.Now().UTC(),
+		DurationSeconds: sql.NullInt32{Int32: 15, Valid: true},
+		StartSpeedKmh:   sql.NullFloat64{Float64: 42, Valid: true},
+		PeakSpeedKmh:    sql.NullFloat64{Float64: 55, Valid: true},
+		EndSpeedKmh:     sql.NullFloat64{Float64: 28, Valid: true},
+	})
+	assert.NoError(t, err)
+}
+
+func TestGeofenceVersionsAndSoftDelete(t *testing.T) {
+	db, queries := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	square := func(size float64) string {
+		return fmt.Sprintf(`{"type": "Polygon", "coordinates": [[[-99.2, 19.4], [%[1]f, 19.4], [%[1]f, %[2]f], [-99.2, %[2]f], [-99.2, 19.4]]]}`,
+			-99.2+size, 19.4+size)
+	}
+	author := sql.NullString{String: "ana@flota", Valid: true}
+
+	zone, err := queries.CreateGeofence(ctx, database.CreateGeofenceParams{
+		Name:              "Test Historial " + uuid.New().String(),
+		StGeomfromgeojson: square(0.1),
+		MinFixes:          1,
+		UpdatedBy:         author,
+	})
+	require.NoError(t, err)
+
+	_, err = queries.UpdateGeofence(ctx, database.UpdateGeofenceParams{
+		ID:        zone.ID,
+		Name:      zone.Name + " ampliada",
+		Shape:     sql.NullString{String: "polygon", Valid: true},
+		Geojson:   square(0.2),
+		UpdatedBy: sql.NullString{String: "luis@flota", Valid: true},
+	})
+	require.NoError(t, err)
+
+	// Un evento previo al borrado debe sobrevivirlo.
+	require.NoError(t, queries.LogGeofenceEvent(ctx, database.LogGeofenceEventParams{
+		GeofenceID: zone.ID,
+		DeviceID:   "test-historial",
+		EventType:  "ENTER",
+		Timestamp:  time.Now().UTC(),
+	}))
+
+	deleted, err := queries.DeleteGeofence(ctx, database.DeleteGeofenceParams{UpdatedBy: author, ID: zone.ID})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+
+	zones, err := queries.FindGeofencesContainingPoint(ctx, database.FindGeofencesContainingPointParams{
+		StMakepoint:   -99.15,
+		StMakepoint_2: 19.45,
+		Column3:       []uuid.UUID{zone.ID},
+		Column4:       time.Now(),
+	})
+	require.NoError(t, err)
+	_, found := zoneRow(zones, zone.ID)
+	assert.False(t, found, "una zona borrada no se evalúa")
+
+	var events int
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT count(*) FROM geofence_events WHERE geofence_id = $1", zone.ID).Scan(&events))
+	assert.Equal(t, 1, events)
+
+	versions, err := queries.ListGeofenceVersions(ctx, zone.ID)
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, []string{"delete", "update", "create"}, []string{versions[0].Action, versions[1].Action, versions[2].Action})
+	assert.Equal(t, "luis@flota", versions[1].ChangedBy.String)
+	assert.NotEmpty(t, versions[1].PreviousGeojson)
+	assert.Empty(t, versions[2].PreviousGeojson)
+
+	restored, err := queries.RestoreGeofenceVersion(ctx, database.RestoreGeofenceVersionParams{
+		UpdatedBy:  author,
+		GeofenceID: zone.ID,
+		Version:    1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, zone.Name, restored.Name)
+	defer queries.DeleteGeofence(ctx, database.DeleteGeofenceParams{ID: zone.ID})
+
+	zones, err = queries.FindGeofencesContainingPoint(ctx, database.FindGeofencesContainingPointParams{
+		StMakepoint:   -99.15,
+		StMakepoint_2: 19.45,
+		Column4:       time.Now(),
+	})
+	require.NoError(t, err)
+	_, found = zoneRow(zones, zone.ID)
+	assert.True(t, found, "la versión 1 contiene el punto")
+
+	versions, err = queries.ListGeofenceVersions(ctx, zone.ID)
+	require.NoError(t, err)
+	require.Len(t, versions, 4)
+	assert.Equal(t, "restore", versions[0].Action)
+}
+
+func TestGeofenceMetadataAndFilters(t *testing.T) {
+	db, queries := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	// Una etiqueta única aísla la prueba de otras zonas en la BD.
+	tag := "test-" + uuid.New().String()
+	square := func(lng, lat float64) string {
+		return fmt.Sprintf(`{"type": "Polygon", "coordinates": [[[%[1]f, %[2]f], [%[3]f, %[2]f], [%[3]f, %[4]f], [%[1]f, %[4]f], [%[1]f, %[2]f]]]}`,
+			lng, lat, lng+0.01, lat+0.01)
+	}
+
+	north, err := queries.CreateGeofence(ctx, database.CreateGeofenceParams{
+		Name:              "Test Almacén 50% Norte",
+		StGeomfromgeojson: square(-99.20, 19.50),
+		MinFixes:          1,
+		Description:       sql.NullString{String: "Andén de carga", Valid: true},
+		Color:             sql.NullString{String: "#FF8800", Valid: true},
+		Category:          sql.NullString{String: "almacen", Valid: true},
+		Tags:              []string{tag, "carga"},
+		Properties:        []byte(`{"cliente": "acme", "turnos": 2}`),
+	})
+	require.NoError(t, err)
+	defer queries.DeleteGeofence(ctx, database.DeleteGeofenceParams{ID: north.ID})
+
+	south, err := queries.CreateCircleGeofence(ctx, database.CreateCircleGeofenceParams{
+		Name:         "Test Caseta Sur",
+		Lng:          -99.10,
+		Lat:          19.30,
+		RadiusMeters: 100,
+		MinFixes:     1,
+		Tags:         []string{tag},
+	})
+	require.NoError(t, err)
+	defer queries.DeleteGeofence(ctx, database.DeleteGeofenceParams{ID: south.ID})
+
+	list := func(p database.GetGeofencesParams) []database.GetGeofencesRow {
+		p.Tags = append(p.Tags, tag)
+		rows, err := queries.GetGeofences(ctx, p)
+		require.NoError(t, err)
+		return rows
+	}
+
+	all := list(database.GetGeofencesParams{})
+	require.Len(t, all, 2)
+	assert.Equal(t, north.ID, all[0].ID, "ordenadas por nombre")
+	assert.Equal(t, "Andén de carga", all[0].Description)
+	assert.Equal(t, "#FF8800", all[0].Color)
+	assert.ElementsMatch(t, []string{tag, "carga"}, all[0].Tags)
+	assert.JSONEq(t, `{"cliente": "acme", "turnos": 2}`, string(all[0].Properties))
+	assert.Equal(t, []string{tag}, all[1].Tags)
+	assert.JSONEq(t, `{}`, string(all[1].Properties))
+
+	assert.Len(t, list(database.GetGeofencesParams{Tags: []string{"carga"}}), 1)
+	assert.Len(t, list(database.GetGeofencesParams{Category: sql.NullString{String: "almacen", Valid: true}}), 1)
+	// El % se busca literal.
+	assert.Len(t, list(database.GetGeofencesParams{Search: sql.NullString{String: `50\%`, Valid: true}}), 1)
+	assert.Len(t, list(database.GetGeofencesParams{Search: sql.NullString{String: "caseta", Valid: true}}), 1)
+
+	inSouth := list(database.GetGeofencesParams{
+		MinLng: sql.NullFloat64{Float64: -99.2, Valid: true},
+		MinLat: sql.NullFloat64{Float64: 19.2, Valid: true},
+		MaxLng: sql.NullFloat64{Float64: -99.0, Valid: true},
+		MaxLat: sql.NullFloat64{Float64: 19.4, Valid: true},
+	})
+	require.Len(t, inSouth, 1)
+	assert.Equal(t, south.ID, inSouth[0].ID)
+
+	page := list(database.GetGeofencesParams{PageLimit: sql.NullInt32{Int32: 1, Valid: true}, PageOffset: 1})
+	require.Len(t, page, 1)
+	assert.Equal(t, south.ID, page[0].ID)
+	total, err := queries.CountGeofences(ctx, database.CountGeofencesParams{Tags: []string{tag}})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, total)
+
+	// Los metadatos omitidos se conservan; vacíos se borran.
+	updated, err := queries.UpdateGeofence(ctx, database.UpdateGeofenceParams{
+		ID:       north.ID,
+		Name:     north.Name,
+		Color:    sql.NullString{String: "", Valid: true},
+		Tags:     []string{tag},
+		Category: sql.NullString{},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, updated.Color)
+	assert.Equal(t, "almacen", updated.Category)
+	assert.Equal(t, []string{tag}, updated.Tags)
+
+	zones, err := queries.FindGeofencesContainingPoint(ctx, database.FindGeofencesContainingPointParams{
+		StMakepoint:   -99.195,
+		StMakepoint_2: 19.505,
+		Column4:       time.Now(),
+	})
+	require.NoError(t, err)
+	z, ok := zoneRow(zones, north.ID)
+	require.True(t, ok)
+	assert.Equal(t, []string{tag}, z.Tags)
+}
+
+func TestNearestDrivers(t *testing.T) {
+	db, queries := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	// Dispositivos únicos, y el filtro device_ids aísla la prueba.
+	prefix := "test-" + uuid.New().String()[:8]
+	near, far, stale := prefix+"-near", prefix+"-far", prefix+"-stale"
+	now := time.Now()
+	insert := func(deviceID string, lat float64, at time.Time) {
+		_, err := queries.CreateLocation(ctx, database.CreateLocationParams{
+			ID:         uuid.New(),
+			DeviceID:   deviceID,
+			Latitude:   lat,
+			Longitude:  -99.0,
+			Speed:      sql.NullFloat64{Float64: 30, Valid: true},
+			RecordedAt: at,
+		})
+		require.NoError(t, err)
+	}
+	// near estuvo lejos antes; cuenta solo su último fix.
+	insert(near, 19.50, now.Add(-2*time.Minute))
+	insert(near, 19.001, now.Add(-time.Minute))
+	insert(far, 19.01, now.Add(-time.Minute))
+	insert(stale, 19.0, now.Add(-time.Hour))
+	defer db.Exec(`DELETE FROM locations WHERE device_id LIKE $1`, prefix+"%")
+
+	nearest := func(p database.GetNearestDriversParams) []database.GetNearestDriversRow {
+		p.Lng, p.Lat = -99.0, 19.0
+		p.DeviceIds = []string{near, far, stale}
+		p.Since = now.Add(-5 * time.Minute)
+		rows, err := queries.GetNearestDrivers(ctx, p)
+		require.NoError(t, err)
+		return rows
+	}
+
+	rows := nearest(database.GetNearestDriversParams{MaxResults: 5})
+	require.Len(t, rows, 2, "uno por dispositivo y sin los inactivos")
+	assert.Equal(t, near, rows[0].DeviceID)
+	assert.InDelta(t, 111, rows[0].DistanceMeters, 1)
+	assert.Equal(t, 30.0, rows[0].Speed)
+	assert.Equal(t, far, rows[1].DeviceID)
+
+	assert.Len(t, nearest(database.GetNearestDriversParams{MaxResults: 1}), 1)
+	assert.Len(t, nearest(database.GetNearestDriversParams{
+		MaxDistance: sql.NullFloat64{Float64: 500, Valid: true},
+		MaxResults:  5,
+	}), 1)
+}
+
+func TestDriversWithin(t *testing.T) {
+	db, queries := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	// Coordenadas en medio del océano para no cruzarse con otros datos.
+	prefix := "test-" + uuid.New().String()[:8]
+	now := time.Now()
+	insert := func(deviceID string, lng, lat float64) {
+		_, err := queries.CreateLocation(ctx, database.CreateLocationParams{
+			ID:         uuid.New(),
+			DeviceID:   deviceID,
+			Latitude:   lat,
+			Longitude:  lng,
+			RecordedAt: now.Add(-time.Minute),
+		})
+		require.NoError(t, err)
+	}
+	insert(prefix+"-a", -140.4, -40.6)
+	insert(prefix+"-b", -140.9, -40.1)
+	insert(prefix+"-c", -139.5, -40.5)
+	defer db.Exec(`DELETE FROM locations WHERE device_id LIKE $1`, prefix+"%")
+
+	within := func(geojson string) []string {
+		rows, err := queries.GetDriversWithin(ctx, database.GetDriversWithinParams{
+			Geojson:    geojson,
+			Since:      now.Add(-5 * time.Minute),
+			MaxResults: 10,
+		})
+		require.NoError(t, err)
+		var ids []string
+		for _, row := range rows {
+			ids = append(ids, row.DeviceID)
+		}
+		return ids
+	}
+
+	box := `{"type": "Polygon", "coordinates": [[[-141, -41], [-140, -41], [-140, -40], [-141, -40], [-141, -41]]]}`
+	assert.Equal(t, []string{prefix + "-a", prefix + "-b"}, within(box), "ordenados por distancia al centro")
+
+	// Triángulo que deja afuera la esquina de b.
+	triangle := `{"type": "Polygon", "coordinates": [[[-141, -41], [-140, -41], [-140, -40], [-141, -41]]]}`
+	assert.Equal(t, []string{prefix + "-a"}, within(triangle))
+}
+
+func TestDeviceIMEIs(t *testing.T) {
+	db, queries := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	// IMEI de prueba único, con el formato que entrega ParseLogin.
+	imei := fmt.Sprintf("99%013d", time.Now().UnixNano()%1e13)
+	deviceID := "test-" + uuid.New().String()[:8]
+	defer db.Exec(`DELETE FROM device_imeis WHERE imei = $1`, imei)
+
+	_, err := queries.GetDeviceIDByIMEI(ctx, imei)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	created, err := queries.UpsertDeviceIMEI(ctx, database.UpsertDeviceIMEIParams{Imei: imei, DeviceID: deviceID})
+	require.NoError(t, err)
+	resolved, err := queries.GetDeviceIDByIMEI(ctx, imei)
+	require.NoError(t, err)
+	assert.Equal(t, deviceID, resolved, "el gateway GT06 resuelve el login")
+
+	// Reasignar conserva el alta.
+	moved, err := queries.UpsertDeviceIMEI(ctx, database.UpsertDeviceIMEIParams{Imei: imei, DeviceID: deviceID + "-b"})
+	require.NoError(t, err)
+	assert.Equal(t, deviceID+"-b", moved.DeviceID)
+	assert.True(t, created.CreatedAt.Equal(moved.CreatedAt))
+
+	listed, err := queries.ListDeviceIMEIs(ctx, sql.NullString{String: deviceID + "-b", Valid: true})
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, imei, listed[0].Imei)
+
+	deleted, err := queries.DeleteDeviceIMEI(ctx, imei)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	deleted, err = queries.DeleteDeviceIMEI(ctx, imei)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+}
+
+func TestTimezoneExists(t *testing.T) {
+	db, queries := setupTestDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	for tz, want := range map[string]bool{"America/Mexico_City": true, "UTC": true, "Local": false, "Marte/Olympus": false} {
+		exists, err := queries.TimezoneExists(ctx, tz)
+		require.NoError(t, err)
+		assert.Equal(t, want, exists, tz)
+	}
+}
@@ -0,0 +1,101 @@
+package ingest
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/google/uuid"
+)
+
+// MaxBatchSize limita los fixes por lote; un dispositivo que estuvo offline
+// horas debe partir su buffer en varias subidas.
+const MaxBatchSize = 1000
+
+type BatchItem struct {
+	Index    int        `json:"index"`
+	DeviceID string     `json:"device_id"`
+	Status   string     `json:"status"`
+	ID       *uuid.UUID `json:"id,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// IngestBatch guarda un lote de fixes (posiblemente de varios dispositivos)
+// en una sola transacción y actualiza el cache con un único pipeline. Los
+// fixes inválidos se reportan por ítem sin abortar el resto del lote; un
+// error de base de datos aborta el lote completo.
+func (s *Service) IngestBatch(ctx context.Context, fixes []Fix) ([]BatchItem, error) {
+	receivedAt := s.now()
+	results := make([]BatchItem, len(fixes))
+	valid := make([]int, 0, len(fixes))
+
+	for i, fix := range fixes {
+		results[i] = BatchItem{Index: i, DeviceID: fix.DeviceID}
+		if err := fix.Validate(receivedAt, s.opts); err != nil {
+			results[i].Status = "invalid"
+			results[i].Error = err.Error()
+			continue
+		}
+		valid = append(valid, i)
+	}
+
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	err := s.inTx(ctx, func(q database.Querier) error {
+		for _, i := range valid {
+			id, _ := uuid.NewV7()
+			insertedID, err := q.CreateLocation(ctx, fixes[i].params(id, receivedAt))
+			if err != nil {
+				return err
+			}
+			results[i].Status = "created"
+			results[i].ID = &insertedID
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Errorw("Error guardando lote de ubicaciones", "error", err, "size", len(valid))
+		return nil, err
+	}
+
+	byDevice := groupByDevice(fixes, valid, receivedAt)
+
+	latest := make([]Fix, 0, len(byDevice))
+	for _, list := range byDevice {
+		latest = append(latest, list[len(list)-1].stamped(receivedAt))
+	}
+
+	if err := s.cache.UpdatePositions(ctx, latest...); err != nil {
+		s.logger.Warnw("Falló actualización en Redis", "error", err)
+	}
+	for _, fix := range latest {
+		s.hub.SendUpdate(fix.updatePayload())
+	}
+
+	for _, list := range byDevice {
+		for _, fix := range list {
+			s.enqueueGeofences(ctx, fix, fix.Time(receivedAt))
+		}
+	}
+
+	return results, nil
+}
+
+// groupByDevice agrupa los fixes válidos por dispositivo en orden
+// cronológico de recorded_at.
+func groupByDevice(fixes []Fix, valid []int, receivedAt time.Time) map[string][]Fix {
+	byDevice := make(map[string][]Fix)
+	for _, i := range valid {
+		byDevice[fixes[i].DeviceID] = append(byDevice[fixes[i].DeviceID], fixes[i])
+	}
+
+	for _, list := range byDevice {
+		sort.SliceStable(list, func(a, b int) bool {
+			return list[a].Time(receivedAt).Before(list[b].Time(receivedAt))
+		})
+	}
+	return byDevice
+}
@@ -0,0 +1,123 @@
+package ingest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// NearbyDriver es un conductor encontrado en una búsqueda espacial, con su
+// último fix. Redis y Postgres responden con la misma forma.
+type NearbyDriver struct {
+	DeviceID  string  `json:"device_id"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// DistanceMeters es la distancia al centro de la búsqueda.
+	DistanceMeters float64   `json:"distance_meters"`
+	Heading        float64   `json:"heading"`
+	Speed          float64   `json:"speed"`
+	LastSeen       time.Time `json:"last_seen"`
+	Status         string    `json:"status"`
+}
+
+// NearbyQuery es una búsqueda de conductores alrededor de un punto.
+type NearbyQuery struct {
+	Latitude     float64
+	Longitude    float64
+	RadiusMeters float64
+	// Since descarta a los que no reportan desde entonces; cero no filtra.
+	Since time.Time
+	// ByLastSeen ordena del más reciente al más viejo en vez de por
+	// distancia.
+	ByLastSeen bool
+	// Limit cero no limita.
+	Limit int
+	// DeviceIDs restringe la búsqueda a esos dispositivos (p. ej. los de un
+	// grupo o un estado); nil no restringe.
+	DeviceIDs []string
+}
+
+// sortDrivers ordena por distancia (o por última vista) y corta en limit.
+func sortDrivers(drivers []NearbyDriver, byLastSeen bool, limit int) []NearbyDriver {
+	sort.SliceStable(drivers, func(a, b int) bool {
+		da, db := drivers[a], drivers[b]
+		if byLastSeen && !da.LastSeen.Equal(db.LastSeen) {
+			return da.LastSeen.After(db.LastSeen)
+		}
+		if da.DistanceMeters != db.DistanceMeters {
+			return da.DistanceMeters < db.DistanceMeters
+		}
+		return da.DeviceID < db.DeviceID
+	})
+	if limit > 0 && len(drivers) > limit {
+		drivers = drivers[:limit]
+	}
+	return drivers
+}
+
+// Contains dice si el punto cae en el rectángulo, bordes incluidos.
+func (b Box) Contains(longitude, latitude float64) bool {
+	return longitude >= b.MinLongitude && longitude <= b.MaxLongitude &&
+		latitude >= b.MinLatitude && latitude <= b.MaxLatitude
+}
+
+// GeoJSON devuelve el rectángulo como Polygon GeoJSON.
+func (b Box) GeoJSON() string {
+	return fmt.Sprintf(`{"type":"Polygon","coordinates":[[[%[1]g,%[2]g],[%[3]g,%[2]g],[%[3]g,%[4]g],[%[1]g,%[4]g],[%[1]g,%[2]g]]]}`,
+		b.MinLongitude, b.MinLatitude, b.MaxLongitude, b.MaxLatitude)
+}
+
+// Area son los polígonos de un Polygon o MultiPolygon GeoJSON: anillos de
+// [lng, lat], el primero exterior y el resto huecos.
+type Area [][][][]float64
+
+// Bounds es el rectángulo que contiene al área.
+func (a Area) Bounds() Box {
+	box := Box{MinLongitude: math.Inf(1), MinLatitude: math.Inf(1), MaxLongitude: math.Inf(-1), MaxLatitude: math.Inf(-1)}
+	for _, rings := range a {
+		if len(rings) == 0 {
+			continue
+		}
+		for _, pos := range rings[0] {
+			box.MinLongitude = math.Min(box.MinLongitude, pos[0])
+			box.MinLatitude = math.Min(box.MinLatitude, pos[1])
+			box.MaxLongitude = math.Max(box.MaxLongitude, pos[0])
+			box.MaxLatitude = math.Max(box.MaxLatitude, pos[1])
+		}
+	}
+	return box
+}
+
+// Contains dice si el punto cae dentro de algún polígono y fuera de sus
+// huecos. Trabaja en grados, como ST_Intersects sobre geometry.
+func (a Area) Contains(longitude, latitude float64) bool {
+	for _, rings := range a {
+		if len(rings) == 0 || !inRing(longitude, latitude, rings[0]) {
+			continue
+		}
+		inHole := false
+		for _, hole := range rings[1:] {
+			if inRing(longitude, latitude, hole) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// inRing es el test de paridad de rayos sobre un anillo cerrado.
+func inRing(x, y float64, ring [][]float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > y) != (b[1] > y) && x < (b[0]-a[0])*(y-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,49 @@
+package ingest_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+)
+
+func TestAreaContains(t *testing.T) {
+	// Un cuadrado con un hueco en el centro y un triángulo aparte.
+	area := ingest.Area{
+		{
+			{{0, 0}, {4, 0}, {4, 4}, {0, 4}, {0, 0}},
+			{{1, 1}, {1, 3}, {3, 3}, {3, 1}, {1, 1}},
+		},
+		{
+			{{10, 10}, {12, 10}, {10, 12}, {10, 10}},
+		},
+	}
+
+	assert.True(t, area.Contains(0.5, 0.5))
+	assert.False(t, area.Contains(2, 2), "dentro del hueco")
+	assert.True(t, area.Contains(10.5, 10.5))
+	assert.False(t, area.Contains(11.9, 11.9), "fuera de la hipotenusa")
+	assert.False(t, area.Contains(6, 6))
+
+	assert.Equal(t, ingest.Box{MinLongitude: 0, MinLatitude: 0, MaxLongitude: 12, MaxLatitude: 12}, area.Bounds())
+}
+
+func TestBoxGeoJSON(t *testing.T) {
+	box := ingest.Box{MinLongitude: -99.2, MinLatitude: 19.3, MaxLongitude: -99.1, MaxLatitude: 19.5}
+	assert.True(t, box.Contains(-99.2, 19.4), "el borde cuenta")
+	assert.False(t, box.Contains(-99.0, 19.4))
+
+	var g struct {
+		Type        string
+		Coordinates [][][]float64
+	}
+	require.NoError(t, json.Unmarshal([]byte(box.GeoJSON()), &g))
+	assert.Equal(t, "Polygon", g.Type)
+	require.Len(t, g.Coordinates[0], 5)
+	assert.Equal(t, []float64{-99.2, 19.3}, g.Coordinates[0][0])
+	assert.Equal(t, []float64{-99.1, 19.5}, g.Coordinates[0][2])
+	assert.Equal(t, g.Coordinates[0][0], g.Coordinates[0][4])
+}
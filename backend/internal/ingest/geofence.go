@@ -0,0 +1,387 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	EventEnter = "ENTER"
+	EventExit  = "EXIT"
+	// EventDwell se emite una sola vez por visita, al superar el umbral de
+	// permanencia de la geocerca.
+	EventDwell = "DWELL"
+	// EventOverspeed se emite al terminar un exceso de velocidad dentro de
+	// la zona; lleva la hora en que empezó.
+	EventOverspeed = "OVERSPEED"
+)
+
+// Decisiones registradas en cada evento según la precisión del fix que lo
+// produjo.
+const (
+	// DecisionCertain: el círculo de incertidumbre queda entero de un lado
+	// del borde.
+	DecisionCertain = "certain"
+	// DecisionExact: el fix no trae precisión y se toma como punto exacto.
+	DecisionExact = "exact"
+)
+
+// placement es de qué lado del borde cae un fix considerando su precisión.
+type placement int
+
+const (
+	placeUncertain placement = iota
+	placeInside
+	placeOutside
+)
+
+// GeofenceEvent es la transición que se difunde por el hub y a los
+// listeners registrados.
+type GeofenceEvent struct {
+	Type     string    `json:"type"`
+	DeviceID string    `json:"device_id"`
+	ZoneID   uuid.UUID `json:"zone_id"`
+	ZoneName string    `json:"zone_name"`
+	// ZoneTags son las etiquetas de la zona, para enrutar el evento.
+	ZoneTags []string `json:"zone_tags,omitempty"`
+	Event    string   `json:"event"`
+	// DurationSeconds es el tiempo dentro de la zona: total en EXIT,
+	// transcurrido en DWELL. Cero en ENTER.
+	DurationSeconds int64 `json:"duration_seconds,omitempty"`
+	// Decision, Accuracy y BoundaryDistance describen el fix que confirmó
+	// el evento.
+	Decision         string  `json:"decision"`
+	Accuracy         float64 `json:"accuracy,omitempty"`
+	BoundaryDistance float64 `json:"boundary_distance_meters"`
+	// Velocidades (km/h) de un OVERSPEED: al empezar, la máxima y la del fix
+	// que lo cerró.
+	StartSpeed float64   `json:"start_speed_kmh,omitempty"`
+	PeakSpeed  float64   `json:"peak_speed_kmh,omitempty"`
+	EndSpeed   float64   `json:"end_speed_kmh,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// GeofenceListener recibe cada transición de geocerca (p. ej. el bridge MQTT).
+type GeofenceListener interface {
+	PublishGeofenceEvent(event GeofenceEvent)
+}
+
+// ZoneState es lo que se guarda por dispositivo y zona: las zonas en las que
+// está confirmado y las entradas todavía sin confirmar.
+type ZoneState struct {
+	Name      string    `json:"name"`
+	Tags      []string  `json:"tags,omitempty"`
+	EnteredAt time.Time `json:"entered_at"`
+	DwellSent bool      `json:"dwell_sent,omitempty"`
+	// Entering marca una entrada pendiente de confirmar por la histéresis.
+	Entering bool `json:"entering,omitempty"`
+	// PendingFixes cuenta los fixes consecutivos que apuntan a la transición
+	// candidata (entrada si Entering, salida si no) desde PendingSince.
+	PendingFixes int       `json:"pending_fixes,omitempty"`
+	PendingSince time.Time `json:"pending_since"`
+	// Exceso de velocidad en curso: primer y último fix por encima del
+	// límite y las velocidades inicial y máxima.
+	SpeedingSince time.Time `json:"speeding_since"`
+	SpeedingUntil time.Time `json:"speeding_until"`
+	StartSpeed    float64   `json:"start_speed,omitempty"`
+	PeakSpeed     float64   `json:"peak_speed,omitempty"`
+}
+
+func (s *Service) sendGeofenceEvent(event GeofenceEvent) {
+	event.Type = "GEOFENCE_EVENT"
+
+	s.hub.SendUpdate(event)
+	for _, l := range s.listeners {
+		l.PublishGeofenceEvent(event)
+	}
+	s.logger.Infow("GEOFENCE CHANGE", "device", event.DeviceID, "event", event.Event, "zone", event.ZoneName)
+
+	var duration sql.NullInt32
+	if event.Event != EventEnter {
+		duration = sql.NullInt32{Int32: int32(event.DurationSeconds), Valid: true}
+	}
+	overspeed := event.Event == EventOverspeed
+
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		err := s.queries.LogGeofenceEvent(context.Background(), database.LogGeofenceEventParams{
+			GeofenceID:             event.ZoneID,
+			DeviceID:               event.DeviceID,
+			EventType:              event.Event,
+			Timestamp:              event.Timestamp.UTC(),
+			DurationSeconds:        duration,
+			Decision:               sql.NullString{String: event.Decision, Valid: event.Decision != ""},
+			Accuracy:               sql.NullFloat64{Float64: event.Accuracy, Valid: event.Accuracy > 0},
+			BoundaryDistanceMeters: sql.NullFloat64{Float64: event.BoundaryDistance, Valid: !overspeed},
+			StartSpeedKmh:          sql.NullFloat64{Float64: event.StartSpeed, Valid: overspeed},
+			PeakSpeedKmh:           sql.NullFloat64{Float64: event.PeakSpeed, Valid: overspeed},
+			EndSpeedKmh:            sql.NullFloat64{Float64: event.EndSpeed, Valid: overspeed},
+		})
+		if err != nil {
+			s.logger.Warnw("Error registrando evento de geocerca", "error", err)
+		}
+	}()
+}
+
+// checkGeofences compara las zonas que contienen el fix con las que el
+// dispositivo tenía en el cache y emite ENTER/EXIT por la diferencia, y DWELL
+// para las zonas donde ya superó el umbral de permanencia. El DWELL se
+// detecta con el primer fix posterior al umbral.
+//
+// Cada transición pasa por la histéresis de la geocerca: hace falta
+// min_fixes fixes consecutivos que cubran min_duration_seconds, y para salir
+// el dispositivo además debe dejar el margen exit_buffer_meters. Una
+// transición candidata que se revierte antes de confirmarse es un rebote:
+// se cuenta pero no se difunde. ENTER y EXIT llevan la hora del primer fix
+// de la racha.
+//
+// Un fix cuyo círculo de precisión cruza el borde es incierto: no avanza ni
+// corta rachas, solo se cuenta.
+//
+// Dentro de una zona confirmada también se siguen los excesos de velocidad
+// (ver trackSpeed).
+//
+// Solo cuentan las zonas asignadas al dispositivo (o sin asignaciones) y
+// activas según su horario a la hora del fix.
+func (s *Service) checkGeofences(fix Fix, at time.Time) {
+	ctx := context.Background()
+
+	prevZones, err := s.cache.DeviceZones(ctx, fix.DeviceID)
+	if err != nil {
+		// Incluye claves con el formato anterior (set "id|nombre"): se
+		// reescriben al guardar el estado nuevo.
+		prevZones = map[uuid.UUID]ZoneState{}
+	}
+
+	prevIDs := make([]uuid.UUID, 0, len(prevZones))
+	for zoneID := range prevZones {
+		prevIDs = append(prevIDs, zoneID)
+	}
+
+	zones, err := s.queries.FindGeofencesContainingPoint(ctx, database.FindGeofencesContainingPointParams{
+		StMakepoint:   fix.Longitude,
+		StMakepoint_2: fix.Latitude,
+		Column3:       prevIDs,
+		Column4:       at,
+		Column5:       fix.DeviceID,
+	})
+	if err != nil {
+		s.logger.Error("Error checking geofences", err)
+		return
+	}
+
+	// Las zonas de prevZones que no vuelven en la consulta fueron borradas o
+	// desasignadas y se descartan sin evento.
+	next := make(map[uuid.UUID]ZoneState, len(zones))
+	for _, z := range zones {
+		state, known := prevZones[z.ID]
+		if z.OffSchedule {
+			// Fuera de horario a la hora del fix: se cierra la visita como lo
+			// haría el scheduler y se olvida cualquier entrada pendiente.
+			if known && !state.Entering {
+				state = s.endOverspeed(fix.DeviceID, z.ID, state, fix.Speed)
+				s.sendGeofenceEvent(scheduleExit(fix.DeviceID, z.ID, state, at))
+			}
+			continue
+		}
+		if known && !state.Entering {
+			if state, inside := s.stayInside(fix, z, state, at); inside {
+				next[z.ID] = state
+			}
+			continue
+		}
+
+		switch placeForEntry(z, fix.Accuracy) {
+		case placeUncertain:
+			s.uncertainFixes.Add(1)
+			if known {
+				next[z.ID] = state
+			}
+			continue
+		case placeOutside:
+			if known {
+				s.countFlap(fix.DeviceID, z.Name, EventEnter)
+			}
+			continue
+		}
+
+		if !known {
+			state = ZoneState{Name: z.Name, Entering: true, PendingSince: at}
+		}
+		state.Name, state.Tags = z.Name, z.Tags
+		state.PendingFixes++
+
+		if confirmed(z, state, at) {
+			state = ZoneState{Name: z.Name, Tags: z.Tags, EnteredAt: state.PendingSince}
+			s.sendGeofenceEvent(newZoneEvent(fix, z, EventEnter, state.EnteredAt))
+		}
+		next[z.ID] = state
+	}
+
+	if err := s.cache.SetDeviceZones(ctx, fix.DeviceID, next); err != nil {
+		s.logger.Warnw("Falló actualización de zonas en Redis", "error", err)
+	}
+}
+
+// stayInside avanza el estado de una zona en la que el dispositivo está
+// confirmado. Devuelve false si con este fix se confirma la salida.
+func (s *Service) stayInside(fix Fix, z database.FindGeofencesContainingPointRow, state ZoneState, at time.Time) (ZoneState, bool) {
+	state.Name, state.Tags = z.Name, z.Tags
+
+	switch placeForExit(z, fix.Accuracy) {
+	case placeUncertain:
+		s.uncertainFixes.Add(1)
+		return state, true
+
+	case placeOutside:
+		if state.PendingFixes == 0 {
+			state.PendingSince = at
+		}
+		state.PendingFixes++
+		if !confirmed(z, state, at) {
+			return state, true
+		}
+
+		state = s.endOverspeed(fix.DeviceID, z.ID, state, fix.Speed)
+		event := newZoneEvent(fix, z, EventExit, state.PendingSince)
+		event.DurationSeconds = int64(state.PendingSince.Sub(state.EnteredAt) / time.Second)
+		s.sendGeofenceEvent(event)
+		return state, false
+	}
+
+	if state.PendingFixes > 0 {
+		s.countFlap(fix.DeviceID, z.Name, EventExit)
+		state.PendingFixes = 0
+		state.PendingSince = time.Time{}
+	}
+
+	threshold := time.Duration(z.DwellSeconds) * time.Second
+	if elapsed := at.Sub(state.EnteredAt); threshold > 0 && !state.DwellSent && elapsed >= threshold {
+		state.DwellSent = true
+		event := newZoneEvent(fix, z, EventDwell, at)
+		event.DurationSeconds = int64(elapsed / time.Second)
+		s.sendGeofenceEvent(event)
+	}
+	return s.trackSpeed(fix, z, state, at), true
+}
+
+// trackSpeed sigue los excesos de velocidad de un dispositivo confirmado
+// dentro de la zona. El exceso se cierra con el primer fix que vuelve al
+// límite (o al salir de la zona).
+func (s *Service) trackSpeed(fix Fix, z database.FindGeofencesContainingPointRow, state ZoneState, at time.Time) ZoneState {
+	limit := z.SpeedLimitKmh
+	if limit <= 0 {
+		limit = s.opts.SpeedLimitKmh
+	}
+	if limit <= 0 || fix.Speed <= limit+s.opts.SpeedToleranceKmh {
+		return s.endOverspeed(fix.DeviceID, z.ID, state, fix.Speed)
+	}
+
+	if state.SpeedingSince.IsZero() {
+		state.SpeedingSince = at
+		state.StartSpeed = fix.Speed
+	}
+	state.SpeedingUntil = at
+	state.PeakSpeed = max(state.PeakSpeed, fix.Speed)
+	return state
+}
+
+// endOverspeed termina el exceso en curso, si lo hay, y emite OVERSPEED si
+// duró al menos SpeedMinDuration entre el primer y el último fix por encima
+// del límite.
+func (s *Service) endOverspeed(deviceID string, zoneID uuid.UUID, state ZoneState, endSpeed float64) ZoneState {
+	if state.SpeedingSince.IsZero() {
+		return state
+	}
+
+	if d := state.SpeedingUntil.Sub(state.SpeedingSince); d >= s.opts.SpeedMinDuration {
+		s.sendGeofenceEvent(GeofenceEvent{
+			DeviceID:        deviceID,
+			ZoneID:          zoneID,
+			ZoneName:        state.Name,
+			ZoneTags:        state.Tags,
+			Event:           EventOverspeed,
+			DurationSeconds: int64(d / time.Second),
+			StartSpeed:      state.StartSpeed,
+			PeakSpeed:       state.PeakSpeed,
+			EndSpeed:        endSpeed,
+			Timestamp:       state.SpeedingSince,
+		})
+	} else {
+		s.logger.Debugw("Exceso de velocidad demasiado breve", "device", deviceID, "zone", state.Name, "peak", state.PeakSpeed)
+	}
+
+	state.SpeedingSince, state.SpeedingUntil = time.Time{}, time.Time{}
+	state.StartSpeed, state.PeakSpeed = 0, 0
+	return state
+}
+
+// placeForEntry ubica el fix respecto de la geocerca para decidir una
+// entrada: dentro solo si todo el círculo de precisión está dentro.
+func placeForEntry(z database.FindGeofencesContainingPointRow, accuracy float64) placement {
+	switch {
+	case z.Inside && z.BoundaryDistanceMeters >= accuracy:
+		return placeInside
+	case !z.Inside && z.BoundaryDistanceMeters >= accuracy:
+		return placeOutside
+	default:
+		return placeUncertain
+	}
+}
+
+// placeForExit hace lo mismo para una zona en la que el dispositivo ya está,
+// con el borde desplazado hacia afuera por exit_buffer_meters.
+func placeForExit(z database.FindGeofencesContainingPointRow, accuracy float64) placement {
+	// Distancia con signo al borde: negativa dentro, positiva fuera.
+	d := z.BoundaryDistanceMeters
+	if z.Inside {
+		d = -d
+	}
+
+	switch {
+	case d-accuracy > z.ExitBufferMeters:
+		return placeOutside
+	case d+accuracy <= z.ExitBufferMeters:
+		return placeInside
+	default:
+		return placeUncertain
+	}
+}
+
+func newZoneEvent(fix Fix, z database.FindGeofencesContainingPointRow, eventType string, at time.Time) GeofenceEvent {
+	decision := DecisionCertain
+	if fix.Accuracy <= 0 {
+		decision = DecisionExact
+	}
+	return GeofenceEvent{
+		DeviceID:         fix.DeviceID,
+		ZoneID:           z.ID,
+		ZoneName:         z.Name,
+		ZoneTags:         z.Tags,
+		Event:            eventType,
+		Decision:         decision,
+		Accuracy:         fix.Accuracy,
+		BoundaryDistance: z.BoundaryDistanceMeters,
+		Timestamp:        at,
+	}
+}
+
+// confirmed indica si la racha pendiente ya cumple la histéresis de la zona.
+func confirmed(z database.FindGeofencesContainingPointRow, state ZoneState, at time.Time) bool {
+	minFixes := int(z.MinFixes)
+	if minFixes < 1 {
+		minFixes = 1
+	}
+	minDuration := time.Duration(z.MinDurationSeconds) * time.Second
+	return state.PendingFixes >= minFixes && at.Sub(state.PendingSince) >= minDuration
+}
+
+func (s *Service) countFlap(deviceID, zoneName, event string) {
+	s.suppressedFlaps.Add(1)
+	s.logger.Debugw("Rebote de geocerca suprimido", "device", deviceID, "zone", zoneName, "event", event)
+}
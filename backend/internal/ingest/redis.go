@@ -0,0 +1,698 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DriversGeoKey = "drivers:locations"
+	// DriversLastSeenKey acompaña a DriversGeoKey: un sorted set con la hora
+	// del último fix de cada dispositivo (ms Unix) para barrer los inactivos.
+	DriversLastSeenKey = "drivers:last_seen"
+	// DriversStatusKey es un hash device_id → DriverStatus en JSON; cada
+	// estado tiene además el set drivers:status:<estado> con sus
+	// dispositivos, para filtrar las búsquedas.
+	DriversStatusKey = "drivers:status"
+
+	deviceZonesTTL = 24 * time.Hour
+	lastFixTTL     = 24 * time.Hour
+
+	occupantsKeyPrefix = "geofence:occupants:"
+	statusSetPrefix    = "drivers:status:"
+
+	metersPerDegree = 111320.0
+	// halfEquatorMeters es el radio de una búsqueda sin distancia máxima:
+	// cubre toda la Tierra desde cualquier punto.
+	halfEquatorMeters = 20037509.0
+)
+
+// RedisCache implementa GeoCache sobre Redis.
+type RedisCache struct {
+	client *redis.Client
+}
+
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{client: client}
+}
+
+// driver:zones:<device> es un hash zone_id → ZoneState en JSON.
+func deviceZonesKey(deviceID string) string {
+	return fmt.Sprintf("driver:zones:%s", deviceID)
+}
+
+// geofence:occupants:<zone> es el índice inverso de driver:zones: un hash
+// device_id → entered_at (RFC 3339) con los dispositivos confirmados dentro
+// de la zona. Las entradas pendientes de histéresis no cuentan.
+func zoneOccupantsKey(zoneID string) string {
+	return occupantsKeyPrefix + zoneID
+}
+
+// driver:last:<device> es el último fix del dispositivo en JSON.
+func lastFixKey(deviceID string) string {
+	return fmt.Sprintf("driver:last:%s", deviceID)
+}
+
+// updatePositionsScript aplica cada fix solo si no es anterior a la última
+// vista del dispositivo, para que un fix atrasado o reenviado no regrese al
+// conductor a una posición vieja ni adelante su salida por el barrido.
+//
+// KEYS[1] = drivers:locations, KEYS[2] = drivers:last_seen y a partir de
+// KEYS[3] el driver:last:<device> de cada fix. ARGV[1] es el TTL en ms y
+// luego cinco valores por fix: device, lng, lat, recorded_at (ms) y JSON.
+var updatePositionsScript = redis.NewScript(`
+local applied = 0
+for i = 3, #KEYS do
+	local a = 2 + (i - 3) * 5
+	local device, at = ARGV[a], tonumber(ARGV[a + 3])
+	local seen = tonumber(redis.call('ZSCORE', KEYS[2], device))
+	if not seen or at >= seen then
+		redis.call('ZADD', KEYS[2], 'GT', at, device)
+		redis.call('GEOADD', KEYS[1], ARGV[a + 1], ARGV[a + 2], device)
+		redis.call('SET', KEYS[i], ARGV[a + 4], 'PX', ARGV[1])
+		applied = applied + 1
+	end
+end
+return applied
+`)
+
+func (c *RedisCache) UpdatePositions(ctx context.Context, fixes ...Fix) error {
+	if len(fixes) == 0 {
+		return nil
+	}
+
+	keys := []string{DriversGeoKey, DriversLastSeenKey}
+	args := []interface{}{lastFixTTL.Milliseconds()}
+	for _, fix := range fixes {
+		seen := time.Now()
+		if fix.RecordedAt != nil {
+			seen = *fix.RecordedAt
+		}
+		data, err := json.Marshal(fix)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, lastFixKey(fix.DeviceID))
+		args = append(args, fix.DeviceID, fix.Longitude, fix.Latitude, seen.UnixMilli(), data)
+	}
+	return updatePositionsScript.Run(ctx, c.client, keys, args...).Err()
+}
+
+func (c *RedisCache) DeviceZones(ctx context.Context, deviceID string) (map[uuid.UUID]ZoneState, error) {
+	fields, err := c.client.HGetAll(ctx, deviceZonesKey(deviceID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	zones := make(map[uuid.UUID]ZoneState, len(fields))
+	for field, value := range fields {
+		zoneID, err := uuid.Parse(field)
+		if err != nil {
+			continue
+		}
+		var state ZoneState
+		if err := json.Unmarshal([]byte(value), &state); err != nil {
+			continue
+		}
+		zones[zoneID] = state
+	}
+	return zones, nil
+}
+
+// removeStaleScript saca de los dos índices a los dispositivos vistos antes
+// de ARGV[1] (ms Unix) y a los del índice geo sin hora (anteriores al
+// sorted set de última vista).
+//
+// KEYS[1] = drivers:locations, KEYS[2] = drivers:last_seen
+var removeStaleScript = redis.NewScript(`
+local stale = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', '(' .. ARGV[1])
+for _, device in ipairs(redis.call('ZDIFF', 2, KEYS[1], KEYS[2])) do
+	table.insert(stale, device)
+end
+for i = 1, #stale, 500 do
+	local chunk = {unpack(stale, i, math.min(i + 499, #stale))}
+	redis.call('ZREM', KEYS[1], unpack(chunk))
+	redis.call('ZREM', KEYS[2], unpack(chunk))
+end
+return #stale
+`)
+
+func (c *RedisCache) RemoveStale(ctx context.Context, before time.Time) (int, error) {
+	keys := []string{DriversGeoKey, DriversLastSeenKey}
+	return removeStaleScript.Run(ctx, c.client, keys, before.UnixMilli()).Int()
+}
+
+// NearbyDrivers busca con GEOSEARCH en el radio y completa cada conductor
+// con su último fix y la hora en que se lo vio.
+func (c *RedisCache) NearbyDrivers(ctx context.Context, q NearbyQuery) ([]NearbyDriver, error) {
+	locations, err := c.client.GeoSearchLocation(ctx, DriversGeoKey, &redis.GeoSearchLocationQuery{
+		GeoSearchQuery: redis.GeoSearchQuery{
+			Longitude:  q.Longitude,
+			Latitude:   q.Latitude,
+			Radius:     q.RadiusMeters,
+			RadiusUnit: "m",
+			Sort:       "ASC",
+		},
+		WithCoord: true,
+		WithDist:  true,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	drivers, err := c.describe(ctx, locations, q)
+	if err != nil {
+		return nil, err
+	}
+	return sortDrivers(drivers, q.ByLastSeen, q.Limit), nil
+}
+
+// NearestDrivers devuelve los q.Limit conductores más cercanos, dentro de
+// q.RadiusMeters si no es cero. GEOSEARCH corta con COUNT antes de filtrar
+// por actividad y dispositivo, así que si los filtros descartan a alguno se
+// repite pidiendo más hasta completar o agotar el radio.
+func (c *RedisCache) NearestDrivers(ctx context.Context, q NearbyQuery) ([]NearbyDriver, error) {
+	radius := q.RadiusMeters
+	if radius <= 0 {
+		radius = halfEquatorMeters
+	}
+
+	for count := q.Limit; ; count *= 4 {
+		locations, err := c.client.GeoSearchLocation(ctx, DriversGeoKey, &redis.GeoSearchLocationQuery{
+			GeoSearchQuery: redis.GeoSearchQuery{
+				Longitude:  q.Longitude,
+				Latitude:   q.Latitude,
+				Radius:     radius,
+				RadiusUnit: "m",
+				Sort:       "ASC",
+				Count:      count,
+			},
+			WithCoord: true,
+			WithDist:  true,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		drivers, err := c.describe(ctx, locations, q)
+		if err != nil {
+			return nil, err
+		}
+		if len(drivers) >= q.Limit || len(locations) < count {
+			return sortDrivers(drivers, false, q.Limit), nil
+		}
+	}
+}
+
+// describe arma los conductores de un resultado de GEOSEARCH (con la
+// distancia en metros) y descarta a los que no pasan el filtro de
+// dispositivos o se vieron por última vez antes de q.Since; sin hora
+// conocida cuentan como inactivos.
+func (c *RedisCache) describe(ctx context.Context, locations []redis.GeoLocation, q NearbyQuery) ([]NearbyDriver, error) {
+	devices := make(map[string]bool, len(q.DeviceIDs))
+	for _, deviceID := range q.DeviceIDs {
+		devices[deviceID] = true
+	}
+	kept := locations[:0]
+	for _, loc := range locations {
+		if q.DeviceIDs == nil || devices[loc.Name] {
+			kept = append(kept, loc)
+		}
+	}
+	locations = kept
+
+	drivers := make([]NearbyDriver, 0, len(locations))
+	if len(locations) == 0 {
+		return drivers, nil
+	}
+
+	deviceIDs := make([]string, len(locations))
+	keys := make([]string, len(locations))
+	for i, loc := range locations {
+		deviceIDs[i] = loc.Name
+		keys[i] = lastFixKey(loc.Name)
+	}
+	pipeline := c.client.Pipeline()
+	scores := pipeline.ZMScore(ctx, DriversLastSeenKey, deviceIDs...)
+	fixes := pipeline.MGet(ctx, keys...)
+	statuses := pipeline.HMGet(ctx, DriversStatusKey, deviceIDs...)
+	if _, err := pipeline.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	for i, loc := range locations {
+		driver := NearbyDriver{
+			DeviceID:       loc.Name,
+			Latitude:       loc.Latitude,
+			Longitude:      loc.Longitude,
+			DistanceMeters: loc.Dist,
+			Status:         parseDriverStatus(statuses.Val()[i]).Status,
+		}
+		if score := scores.Val()[i]; score > 0 {
+			driver.LastSeen = time.UnixMilli(int64(score)).UTC()
+		}
+		if !q.Since.IsZero() && !driver.LastSeen.After(q.Since) {
+			continue
+		}
+		if data, ok := fixes.Val()[i].(string); ok {
+			var fix Fix
+			if json.Unmarshal([]byte(data), &fix) == nil {
+				driver.Heading, driver.Speed = fix.Heading, fix.Speed
+			}
+		}
+		drivers = append(drivers, driver)
+	}
+	return drivers, nil
+}
+
+func (c *RedisCache) DriverStatus(ctx context.Context, deviceID string) (DriverStatus, error) {
+	statuses, err := c.DriverStatuses(ctx, deviceID)
+	if err != nil {
+		return DriverStatus{}, err
+	}
+	return statuses[0], nil
+}
+
+// DriverStatuses devuelve el estado de cada dispositivo, en el mismo orden;
+// offline si no tiene.
+func (c *RedisCache) DriverStatuses(ctx context.Context, deviceIDs ...string) ([]DriverStatus, error) {
+	if len(deviceIDs) == 0 {
+		return nil, nil
+	}
+	values, err := c.client.HMGet(ctx, DriversStatusKey, deviceIDs...).Result()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]DriverStatus, len(values))
+	for i, value := range values {
+		statuses[i] = parseDriverStatus(value)
+	}
+	return statuses, nil
+}
+
+func parseDriverStatus(value interface{}) DriverStatus {
+	status := DriverStatus{Status: StatusOffline}
+	if data, ok := value.(string); ok {
+		_ = json.Unmarshal([]byte(data), &status)
+	}
+	return status
+}
+
+// statusSetKey es el set drivers:status:<estado> con los dispositivos en ese
+// estado.
+func statusSetKey(status string) string {
+	return statusSetPrefix + status
+}
+
+// swapStatusScript cambia el estado solo si el actual es ARGV[2] y mueve al
+// dispositivo entre los sets por estado.
+//
+// KEYS[1] = drivers:status y desde KEYS[2] el set de cada estado, en el
+// mismo orden que los nombres desde ARGV[5].
+// ARGV = device_id, estado esperado, estado nuevo, JSON nuevo, estados
+var swapStatusScript = redis.NewScript(`
+local device, expected, status, data = ARGV[1], ARGV[2], ARGV[3], ARGV[4]
+local sets = {}
+for i = 5, #ARGV do
+	sets[ARGV[i]] = KEYS[i - 3]
+end
+local current = 'offline'
+local stored = redis.call('HGET', KEYS[1], device)
+if stored then
+	current = cjson.decode(stored).status
+end
+if current ~= expected then
+	return 0
+end
+redis.call('HSET', KEYS[1], device, data)
+if sets[current] then
+	redis.call('SREM', sets[current], device)
+end
+redis.call('SADD', sets[status], device)
+return 1
+`)
+
+func (c *RedisCache) SwapDriverStatus(ctx context.Context, deviceID, from string, next DriverStatus) (bool, error) {
+	data, err := json.Marshal(next)
+	if err != nil {
+		return false, err
+	}
+	keys := []string{DriversStatusKey}
+	args := []interface{}{deviceID, from, next.Status, data}
+	for _, status := range allStatuses {
+		keys = append(keys, statusSetKey(status))
+		args = append(args, status)
+	}
+	swapped, err := swapStatusScript.Run(ctx, c.client, keys, args...).Int()
+	return swapped == 1, err
+}
+
+// DevicesWithStatus devuelve los dispositivos que están en alguno de los
+// estados. Como en DriverStatus, un conductor conocido (en
+// drivers:last_seen) sin estado guardado cuenta como offline.
+func (c *RedisCache) DevicesWithStatus(ctx context.Context, statuses ...string) ([]string, error) {
+	devices := []string{}
+	if len(statuses) == 0 {
+		return devices, nil
+	}
+
+	var keys []string
+	offline := false
+	for _, status := range statuses {
+		if status == StatusOffline {
+			offline = true
+		}
+		keys = append(keys, statusSetKey(status))
+	}
+
+	pipeline := c.client.TxPipeline()
+	union := pipeline.SUnion(ctx, keys...)
+	var known, online *redis.StringSliceCmd
+	if offline {
+		var onlineKeys []string
+		for _, status := range allStatuses {
+			if status != StatusOffline {
+				onlineKeys = append(onlineKeys, statusSetKey(status))
+			}
+		}
+		known = pipeline.ZRange(ctx, DriversLastSeenKey, 0, -1)
+		online = pipeline.SUnion(ctx, onlineKeys...)
+	}
+	if _, err := pipeline.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, device := range union.Val() {
+		seen[device] = true
+		devices = append(devices, device)
+	}
+	if offline {
+		for _, device := range online.Val() {
+			seen[device] = true
+		}
+		for _, device := range known.Val() {
+			if !seen[device] {
+				seen[device] = true
+				devices = append(devices, device)
+			}
+		}
+	}
+	return devices, nil
+}
+
+// setZonesScript reemplaza driver:zones:<device> y corrige el índice inverso
+// en la misma operación: saca al dispositivo de las zonas anteriores y lo
+// agrega a las confirmadas. Las zonas anteriores se leen antes de llamarlo
+// para declarar sus claves; si el hash cambió entre tanto devuelve 0 y el
+// llamador reintenta.
+//
+// KEYS[1] = driver:zones:<device> y desde KEYS[2] el
+// geofence:occupants:<zone> de cada zona, primero las ARGV[3] anteriores.
+// ARGV = device_id, ttl (s), cantidad de zonas anteriores, el id de zona de
+// cada clave desde KEYS[2] y por zona nueva: id, estado, entered_at (vacío
+// si la entrada está pendiente).
+var setZonesScript = redis.NewScript(`
+local device, ttl, previous = ARGV[1], ARGV[2], tonumber(ARGV[3])
+local occupants, expected = {}, {}
+for i = 2, #KEYS do
+	occupants[ARGV[i + 2]] = KEYS[i]
+	if i - 1 <= previous then
+		expected[ARGV[i + 2]] = true
+	end
+end
+local current = redis.call('HKEYS', KEYS[1])
+if #current ~= previous then
+	return 0
+end
+for _, zone in ipairs(current) do
+	if not expected[zone] then
+		return 0
+	end
+end
+for _, zone in ipairs(current) do
+	redis.call('HDEL', occupants[zone], device)
+end
+redis.call('DEL', KEYS[1])
+local first = #KEYS + 3
+for i = first, #ARGV, 3 do
+	redis.call('HSET', KEYS[1], ARGV[i], ARGV[i + 1])
+	if ARGV[i + 2] ~= '' then
+		redis.call('HSET', occupants[ARGV[i]], device, ARGV[i + 2])
+	end
+end
+if #ARGV >= first then
+	redis.call('EXPIRE', KEYS[1], ttl)
+end
+return 1
+`)
+
+// setZonesAttempts limita los reintentos de SetDeviceZones cuando otra
+// escritura cambia las zonas del dispositivo a la vez.
+const setZonesAttempts = 5
+
+func (c *RedisCache) SetDeviceZones(ctx context.Context, deviceID string, zones map[uuid.UUID]ZoneState) error {
+	for attempt := 0; attempt < setZonesAttempts; attempt++ {
+		previous, err := c.client.HKeys(ctx, deviceZonesKey(deviceID)).Result()
+		if err != nil {
+			return err
+		}
+
+		keys := []string{deviceZonesKey(deviceID)}
+		args := []interface{}{deviceID, int(deviceZonesTTL / time.Second), len(previous)}
+		declared := make(map[string]bool, len(previous)+len(zones))
+		for _, zone := range previous {
+			declared[zone] = true
+			keys = append(keys, occupantsKeyPrefix+zone)
+			args = append(args, zone)
+		}
+		for zoneID := range zones {
+			if zone := zoneID.String(); !declared[zone] {
+				declared[zone] = true
+				keys = append(keys, occupantsKeyPrefix+zone)
+				args = append(args, zone)
+			}
+		}
+		for zoneID, state := range zones {
+			data, err := json.Marshal(state)
+			if err != nil {
+				return err
+			}
+			enteredAt := ""
+			if !state.Entering {
+				enteredAt = state.EnteredAt.UTC().Format(time.RFC3339Nano)
+			}
+			args = append(args, zoneID.String(), data, enteredAt)
+		}
+
+		applied, err := setZonesScript.Run(ctx, c.client, keys, args...).Int()
+		if err != nil || applied == 1 {
+			return err
+		}
+	}
+	return fmt.Errorf("las zonas de %s cambiaron durante %d intentos", deviceID, setZonesAttempts)
+}
+
+// pruneOccupantScript borra un dispositivo del índice inverso solo si ya no
+// está en su driver:zones; así no pisa una entrada que llegó entre la
+// lectura y el borrado.
+//
+// KEYS[1] = geofence:occupants:<zone>, KEYS[2] = driver:zones:<device>
+// ARGV = zone_id, device_id
+var pruneOccupantScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[2], ARGV[1]) == 0 then
+	return redis.call('HDEL', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// Occupant es un dispositivo confirmado dentro de una zona.
+type Occupant struct {
+	DeviceID  string    `json:"device_id"`
+	EnteredAt time.Time `json:"entered_at"`
+	// LastFix falta si el último fix ya expiró del cache.
+	LastFix *Fix `json:"last_fix,omitempty"`
+}
+
+// ZoneOccupants lista los dispositivos dentro de la zona, del que entró
+// primero al último, con su último fix.
+func (c *RedisCache) ZoneOccupants(ctx context.Context, zoneID uuid.UUID) ([]Occupant, error) {
+	live, err := c.liveOccupants(ctx, []uuid.UUID{zoneID})
+	if err != nil {
+		return nil, err
+	}
+
+	occupants := make([]Occupant, 0, len(live[0]))
+	keys := make([]string, 0, len(live[0]))
+	for deviceID, enteredAt := range live[0] {
+		occupant := Occupant{DeviceID: deviceID}
+		occupant.EnteredAt, _ = time.Parse(time.RFC3339Nano, enteredAt)
+		occupants = append(occupants, occupant)
+		keys = append(keys, lastFixKey(deviceID))
+	}
+	if len(keys) > 0 {
+		values, err := c.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				continue
+			}
+			var fix Fix
+			if json.Unmarshal([]byte(data), &fix) == nil {
+				occupants[i].LastFix = &fix
+			}
+		}
+	}
+
+	sort.Slice(occupants, func(a, b int) bool {
+		if !occupants[a].EnteredAt.Equal(occupants[b].EnteredAt) {
+			return occupants[a].EnteredAt.Before(occupants[b].EnteredAt)
+		}
+		return occupants[a].DeviceID < occupants[b].DeviceID
+	})
+	return occupants, nil
+}
+
+// OccupantCounts cuenta los dispositivos dentro de cada zona, en el mismo
+// orden que zoneIDs.
+func (c *RedisCache) OccupantCounts(ctx context.Context, zoneIDs []uuid.UUID) ([]int, error) {
+	live, err := c.liveOccupants(ctx, zoneIDs)
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]int, len(live))
+	for i, devices := range live {
+		counts[i] = len(devices)
+	}
+	return counts, nil
+}
+
+// liveOccupants lee el índice inverso de cada zona (device_id → entered_at)
+// y descarta los dispositivos cuyo driver:zones ya no tiene la zona: pasa
+// cuando el hash del dispositivo expira sin que vuelva a reportar. Esas
+// entradas se borran al encontrarlas.
+func (c *RedisCache) liveOccupants(ctx context.Context, zoneIDs []uuid.UUID) ([]map[string]string, error) {
+	if len(zoneIDs) == 0 {
+		return nil, nil
+	}
+
+	pipeline := c.client.Pipeline()
+	reads := make([]*redis.MapStringStringCmd, len(zoneIDs))
+	for i, zoneID := range zoneIDs {
+		reads[i] = pipeline.HGetAll(ctx, zoneOccupantsKey(zoneID.String()))
+	}
+	if _, err := pipeline.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	type member struct {
+		zone   int
+		device string
+		exists *redis.BoolCmd
+	}
+	var members []member
+	pipeline = c.client.Pipeline()
+	live := make([]map[string]string, len(zoneIDs))
+	for i, read := range reads {
+		live[i] = read.Val()
+		for deviceID := range live[i] {
+			exists := pipeline.HExists(ctx, deviceZonesKey(deviceID), zoneIDs[i].String())
+			members = append(members, member{zone: i, device: deviceID, exists: exists})
+		}
+	}
+	if len(members) == 0 {
+		return live, nil
+	}
+	if _, err := pipeline.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	for _, m := range members {
+		if m.exists.Val() {
+			continue
+		}
+		delete(live[m.zone], m.device)
+		zoneID := zoneIDs[m.zone].String()
+		keys := []string{zoneOccupantsKey(zoneID), deviceZonesKey(m.device)}
+		if err := pruneOccupantScript.Run(ctx, c.client, keys, zoneID, m.device).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return live, nil
+}
+
+// PositionsInBox busca con GEOSEARCH BYBOX centrado en el rectángulo (ver
+// searchBox).
+func (c *RedisCache) PositionsInBox(ctx context.Context, box Box) ([]Fix, error) {
+	locations, err := c.searchBox(ctx, box)
+	if err != nil {
+		return nil, err
+	}
+
+	fixes := make([]Fix, len(locations))
+	for i, loc := range locations {
+		fixes[i] = Fix{DeviceID: loc.Name, Latitude: loc.Latitude, Longitude: loc.Longitude}
+	}
+	return fixes, nil
+}
+
+// DriversWithin devuelve los conductores dentro del rectángulo o, si area no
+// es nil, dentro del área (box debe ser su Bounds). La distancia se mide al
+// centro del rectángulo.
+func (c *RedisCache) DriversWithin(ctx context.Context, box Box, area Area, q NearbyQuery) ([]NearbyDriver, error) {
+	locations, err := c.searchBox(ctx, box)
+	if err != nil {
+		return nil, err
+	}
+
+	// BYBOX trae algunos de más: se recorta al rectángulo o al área exactos.
+	inside := locations[:0]
+	for _, loc := range locations {
+		if area != nil && area.Contains(loc.Longitude, loc.Latitude) ||
+			area == nil && box.Contains(loc.Longitude, loc.Latitude) {
+			inside = append(inside, loc)
+		}
+	}
+
+	drivers, err := c.describe(ctx, inside, q)
+	if err != nil {
+		return nil, err
+	}
+	return sortDrivers(drivers, q.ByLastSeen, q.Limit), nil
+}
+
+// searchBox busca con GEOSEARCH BYBOX centrado en el rectángulo, con la
+// distancia al centro. El ancho se mide en la latitud más cercana al
+// ecuador, así la caja de Redis cubre todo el rectángulo (puede traer
+// algunos de más).
+func (c *RedisCache) searchBox(ctx context.Context, box Box) ([]redis.GeoLocation, error) {
+	lat := math.Min(math.Abs(box.MinLatitude), math.Abs(box.MaxLatitude))
+	if box.MinLatitude < 0 && box.MaxLatitude > 0 {
+		lat = 0
+	}
+	width := (box.MaxLongitude - box.MinLongitude) * metersPerDegree * math.Cos(lat*math.Pi/180)
+	height := (box.MaxLatitude - box.MinLatitude) * metersPerDegree
+
+	return c.client.GeoSearchLocation(ctx, DriversGeoKey, &redis.GeoSearchLocationQuery{
+		GeoSearchQuery: redis.GeoSearchQuery{
+			Longitude: (box.MinLongitude + box.MaxLongitude) / 2,
+			Latitude:  (box.MinLatitude + box.MaxLatitude) / 2,
+			// Un metro de margen para los puntos justo sobre el borde.
+			BoxWidth:  width + 1,
+			BoxHeight: height + 1,
+			BoxUnit:   "m",
+		},
+		WithCoord: true,
+		WithDist:  true,
+	}).Result()
+}
@@ -0,0 +1,184 @@
+package ingest
+
+import (
+	"context"
+	"time"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/google/uuid"
+)
+
+// DecisionSchedule marca los ENTER/EXIT que provocó el horario de la zona
+// (se activó o desactivó con el dispositivo adentro) y no un movimiento.
+const DecisionSchedule = "schedule"
+
+// RunScheduler revisa cada interval las zonas con horario. Cuando una cambia
+// de activa a inactiva o al revés, reevalúa a los dispositivos cuya última
+// posición cae en ella, en el worker de cada uno. Una zona inactiva que deja
+// de tener horario queda siempre activa y se reevalúa igual. Bloquea hasta
+// que ctx termine.
+func (s *Service) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// La primera pasada solo registra el estado de cada zona: sin un cambio
+	// observado no hay ENTER/EXIT sintéticos. Lo que cambió con el servicio
+	// caído lo resuelve el próximo fix de cada dispositivo.
+	last := make(map[uuid.UUID]database.ListScheduledGeofencesRow)
+	seeded := false
+	for {
+		if s.sweepSchedules(ctx, last, seeded) {
+			seeded = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweepSchedules concilia las zonas cuyo estado cambió desde la pasada
+// anterior; last guarda cómo se vio cada zona en esa pasada. Sin seeded solo
+// llena last. Devuelve si pudo leer las zonas.
+func (s *Service) sweepSchedules(ctx context.Context, last map[uuid.UUID]database.ListScheduledGeofencesRow, seeded bool) bool {
+	at := s.now()
+
+	zones, err := s.queries.ListScheduledGeofences(ctx, at)
+	if err != nil {
+		s.logger.Warnw("Error revisando horarios de geocercas", "error", err)
+		return false
+	}
+	if !seeded {
+		for _, z := range zones {
+			last[z.ID] = z
+		}
+		return true
+	}
+
+	seen := make(map[uuid.UUID]bool, len(zones))
+	for _, z := range zones {
+		seen[z.ID] = true
+		if was, known := last[z.ID]; known && was.Active == z.Active {
+			last[z.ID] = z
+			continue
+		}
+		last[z.ID] = z
+		s.reconcileZone(ctx, z, at)
+	}
+	for zoneID, z := range last {
+		if seen[zoneID] {
+			continue
+		}
+		delete(last, zoneID)
+		// Sin horario la zona está siempre activa. Si en cambio se borró,
+		// FindGeofencesContainingPoint ya no la devuelve y no hay ENTER.
+		if !z.Active {
+			z.Active = true
+			s.reconcileZone(ctx, z, at)
+		}
+	}
+	return true
+}
+
+func (s *Service) reconcileZone(ctx context.Context, z database.ListScheduledGeofencesRow, at time.Time) {
+	devices, err := s.cache.PositionsInBox(ctx, Box{
+		MinLongitude: z.MinLongitude,
+		MinLatitude:  z.MinLatitude,
+		MaxLongitude: z.MaxLongitude,
+		MaxLatitude:  z.MaxLatitude,
+	})
+	if err != nil {
+		s.logger.Warnw("Error buscando dispositivos de la zona", "zone", z.Name, "error", err)
+		return
+	}
+
+	s.logger.Infow("Cambio de horario de geocerca", "zone", z.Name, "active", z.Active, "devices", len(devices))
+	for _, fix := range devices {
+		if err := s.pool.Do(ctx, fix.DeviceID, func() { s.applySchedule(fix, z, at) }); err != nil {
+			s.logger.Warnw("Cambio de horario descartado", "device", fix.DeviceID, "zone", z.Name, "error", err)
+		}
+	}
+}
+
+// applySchedule lleva el estado del dispositivo al de la zona: al
+// desactivarse cierra la visita con EXIT; al activarse, si la última posición
+// está dentro, abre una con ENTER sin pasar por la histéresis (el
+// dispositivo ya estaba ahí).
+func (s *Service) applySchedule(fix Fix, z database.ListScheduledGeofencesRow, at time.Time) {
+	ctx := context.Background()
+
+	zones, err := s.cache.DeviceZones(ctx, fix.DeviceID)
+	if err != nil || zones == nil {
+		zones = map[uuid.UUID]ZoneState{}
+	}
+	state, known := zones[z.ID]
+
+	switch {
+	case !z.Active && known:
+		delete(zones, z.ID)
+		if !state.Entering {
+			state = s.endOverspeed(fix.DeviceID, z.ID, state, fix.Speed)
+			s.sendGeofenceEvent(scheduleExit(fix.DeviceID, z.ID, state, at))
+		}
+
+	case z.Active && !known:
+		rows, err := s.queries.FindGeofencesContainingPoint(ctx, database.FindGeofencesContainingPointParams{
+			StMakepoint:   fix.Longitude,
+			StMakepoint_2: fix.Latitude,
+			Column3:       []uuid.UUID{z.ID},
+			Column4:       at,
+			Column5:       fix.DeviceID,
+		})
+		if err != nil {
+			s.logger.Error("Error checking geofences", err)
+			return
+		}
+		row, ok := findZone(rows, z.ID)
+		if !ok || !row.Inside || row.OffSchedule {
+			return
+		}
+		zones[z.ID] = ZoneState{Name: row.Name, Tags: row.Tags, EnteredAt: at}
+		s.sendGeofenceEvent(GeofenceEvent{
+			DeviceID:         fix.DeviceID,
+			ZoneID:           row.ID,
+			ZoneName:         row.Name,
+			ZoneTags:         row.Tags,
+			Event:            EventEnter,
+			Decision:         DecisionSchedule,
+			BoundaryDistance: row.BoundaryDistanceMeters,
+			Timestamp:        at,
+		})
+
+	default:
+		return
+	}
+
+	if err := s.cache.SetDeviceZones(ctx, fix.DeviceID, zones); err != nil {
+		s.logger.Warnw("Falló actualización de zonas en Redis", "error", err)
+	}
+}
+
+// scheduleExit cierra una visita porque la zona salió de horario.
+func scheduleExit(deviceID string, zoneID uuid.UUID, state ZoneState, at time.Time) GeofenceEvent {
+	return GeofenceEvent{
+		DeviceID:        deviceID,
+		ZoneID:          zoneID,
+		ZoneName:        state.Name,
+		ZoneTags:        state.Tags,
+		Event:           EventExit,
+		DurationSeconds: int64(at.Sub(state.EnteredAt) / time.Second),
+		Decision:        DecisionSchedule,
+		Timestamp:       at,
+	}
+}
+
+func findZone(rows []database.FindGeofencesContainingPointRow, zoneID uuid.UUID) (database.FindGeofencesContainingPointRow, bool) {
+	for _, row := range rows {
+		if row.ID == zoneID {
+			return row, true
+		}
+	}
+	return database.FindGeofencesContainingPointRow{}, false
+}
@@ -0,0 +1,143 @@
+package ingest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+)
+
+func TestOffScheduleZoneClosesVisit(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := newTestService(q, c, h)
+	defer svc.Close()
+	zone := database.FindGeofencesContainingPointRow{ID: uuid.New(), Name: "Escuela"}
+	start := time.Now().Add(-30 * time.Minute)
+	fixAt := func(offset time.Duration) ingest.Fix {
+		at := start.Add(offset)
+		return ingest.Fix{DeviceID: "bus-1", Latitude: 1, Longitude: 1, RecordedAt: &at}
+	}
+
+	q.setZones(zone)
+	evaluate(t, svc, fixAt(0))
+
+	// Mismo lugar, pero la zona ya salió de horario.
+	off := zone
+	off.Inside, off.OffSchedule = true, true
+	q.setRows(off)
+	evaluate(t, svc, fixAt(10*time.Minute))
+	evaluate(t, svc, fixAt(11*time.Minute))
+
+	events := h.geofenceEvents()
+	require.Len(t, events, 2)
+	assert.Equal(t, ingest.EventExit, events[1].Event)
+	assert.Equal(t, ingest.DecisionSchedule, events[1].Decision)
+	assert.Equal(t, int64(600), events[1].DurationSeconds)
+	assert.Empty(t, c.zones["bus-1"])
+}
+
+func TestSchedulerEmitsSyntheticEnterAndExit(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := newTestService(q, c, h)
+	defer svc.Close()
+
+	zoneID := uuid.New()
+	scheduled := database.ListScheduledGeofencesRow{
+		ID: zoneID, Name: "Depósito",
+		MinLongitude: 0, MinLatitude: 0, MaxLongitude: 2, MaxLatitude: 2,
+	}
+	q.setZones(database.FindGeofencesContainingPointRow{ID: zoneID, Name: "Depósito"})
+	require.NoError(t, c.UpdatePositions(context.Background(),
+		ingest.Fix{DeviceID: "van-1", Latitude: 1, Longitude: 1},
+		ingest.Fix{DeviceID: "van-2", Latitude: 5, Longitude: 5},
+	))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.setScheduled(scheduled)
+	go svc.RunScheduler(ctx, 5*time.Millisecond)
+
+	// Inactiva al arrancar y sin estado: nada que cerrar.
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, h.geofenceEvents())
+
+	scheduled.Active = true
+	q.setScheduled(scheduled)
+	require.Eventually(t, func() bool { return len(h.geofenceEvents()) == 1 }, time.Second, 5*time.Millisecond)
+	enter := h.geofenceEvents()[0]
+	assert.Equal(t, "van-1", enter.DeviceID)
+	assert.Equal(t, ingest.EventEnter, enter.Event)
+	assert.Equal(t, ingest.DecisionSchedule, enter.Decision)
+
+	scheduled.Active = false
+	q.setScheduled(scheduled)
+	require.Eventually(t, func() bool { return len(h.geofenceEvents()) == 2 }, time.Second, 5*time.Millisecond)
+	exit := h.geofenceEvents()[1]
+	assert.Equal(t, "van-1", exit.DeviceID)
+	assert.Equal(t, ingest.EventExit, exit.Event)
+	assert.Equal(t, ingest.DecisionSchedule, exit.Decision)
+
+	// Sin más cambios el scheduler no repite eventos.
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, h.geofenceEvents(), 2)
+}
+
+func TestSchedulerActivatesZoneWhenScheduleIsRemoved(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := newTestService(q, c, h)
+	defer svc.Close()
+
+	zoneID := uuid.New()
+	q.setZones(database.FindGeofencesContainingPointRow{ID: zoneID, Name: "Depósito"})
+	require.NoError(t, c.UpdatePositions(context.Background(), ingest.Fix{DeviceID: "van-1", Latitude: 1, Longitude: 1}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.setScheduled(database.ListScheduledGeofencesRow{
+		ID: zoneID, Name: "Depósito",
+		MinLongitude: 0, MinLatitude: 0, MaxLongitude: 2, MaxLatitude: 2,
+	})
+	go svc.RunScheduler(ctx, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, h.geofenceEvents())
+
+	// DELETE /geofences/:id/schedule: la zona sale de la lista y queda activa.
+	q.setScheduled()
+	require.Eventually(t, func() bool { return len(h.geofenceEvents()) == 1 }, time.Second, 5*time.Millisecond)
+	enter := h.geofenceEvents()[0]
+	assert.Equal(t, "van-1", enter.DeviceID)
+	assert.Equal(t, ingest.EventEnter, enter.Event)
+	assert.Equal(t, ingest.DecisionSchedule, enter.Decision)
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, h.geofenceEvents(), 1)
+}
+
+func TestSchedulerStartupDoesNotReplayActiveZones(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := newTestService(q, c, h)
+	defer svc.Close()
+
+	zoneID := uuid.New()
+	q.setZones(database.FindGeofencesContainingPointRow{ID: zoneID, Name: "Depósito"})
+	require.NoError(t, c.UpdatePositions(context.Background(), ingest.Fix{DeviceID: "van-1", Latitude: 1, Longitude: 1}))
+
+	// Activa desde antes del arranque, con el dispositivo adentro y sin estado
+	// en cache: reiniciar no es un cambio de horario.
+	q.setScheduled(database.ListScheduledGeofencesRow{
+		ID: zoneID, Name: "Depósito", Active: true,
+		MinLongitude: 0, MinLatitude: 0, MaxLongitude: 2, MaxLatitude: 2,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svc.RunScheduler(ctx, 5*time.Millisecond)
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Empty(t, h.geofenceEvents())
+}
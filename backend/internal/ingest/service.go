@@ -0,0 +1,322 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Fix es una ubicación reportada por un dispositivo, independiente del
+// transporte por el que llegó (HTTP, UDP, GT06, MQTT...).
+type Fix struct {
+	DeviceID  string  `json:"device_id"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// Speed va en km/h, la unidad de speed_limit_kmh. Cada transporte
+	// convierte al recibir (ver FixMessage).
+	Speed    float64 `json:"speed"`
+	Heading  float64 `json:"heading"`
+	Accuracy float64 `json:"accuracy"`
+	// RecordedAt es la hora del fix según el dispositivo. Si se omite se usa
+	// la hora de recepción.
+	RecordedAt *time.Time `json:"recorded_at"`
+}
+
+// mpsToKmh convierte m/s a km/h.
+const mpsToKmh = 3.6
+
+// SpeedKmh es la velocidad de un fix que llega con speed (km/h) o con
+// speed_mps (m/s, como la reporta Android); speed_mps, si viene, manda.
+func SpeedKmh(speed float64, speedMps *float64) float64 {
+	if speedMps != nil {
+		return *speedMps * mpsToKmh
+	}
+	return speed
+}
+
+// FixMessage es un fix en JSON tal como lo mandan MQTT y UDP: admite
+// speed_mps además de speed.
+type FixMessage struct {
+	Fix
+	SpeedMps *float64 `json:"speed_mps"`
+}
+
+// Normalized devuelve el fix con Speed en km/h.
+func (m FixMessage) Normalized() Fix {
+	fix := m.Fix
+	fix.Speed = SpeedKmh(fix.Speed, m.SpeedMps)
+	return fix
+}
+
+// Result describe un fix ya persistido.
+type Result struct {
+	ID         uuid.UUID `json:"id"`
+	DeviceID   string    `json:"device_id"`
+	RecordedAt time.Time `json:"recorded_at"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// Options agrupa los límites configurables de la ingesta.
+type Options struct {
+	// MaxClockSkew es cuánto puede adelantarse recorded_at respecto al servidor.
+	MaxClockSkew time.Duration
+	// MaxFixAge es la antigüedad máxima de un fix almacenado offline.
+	MaxFixAge time.Duration
+	// GeofenceWorkers y GeofenceQueueSize dimensionan el pool que evalúa
+	// geocercas en orden por dispositivo.
+	GeofenceWorkers   int
+	GeofenceQueueSize int
+	// MaxGeofenceAccuracy (metros) excluye de la evaluación de geocercas a
+	// los fixes menos precisos. Cero no limita.
+	MaxGeofenceAccuracy float64
+	// SpeedLimitKmh es el límite de las zonas que no definen uno propio; cero
+	// solo vigila las zonas con límite. Un exceso empieza al superar el
+	// límite más SpeedToleranceKmh y se reporta si dura SpeedMinDuration.
+	SpeedLimitKmh     float64
+	SpeedToleranceKmh float64
+	SpeedMinDuration  time.Duration
+	// DriverFreshness es cuánto sigue visible un dispositivo sin reportar en
+	// las búsquedas de conductores; el barrido lo saca del índice geo después.
+	// Cero no limita.
+	DriverFreshness time.Duration
+}
+
+// GeoCache es el estado caliente en Redis: el índice geo de conductores, su
+// estado de disponibilidad y las zonas en las que está cada dispositivo.
+type GeoCache interface {
+	// UpdatePositions ignora los fixes anteriores a la última vista del
+	// dispositivo.
+	UpdatePositions(ctx context.Context, fixes ...Fix) error
+	DeviceZones(ctx context.Context, deviceID string) (map[uuid.UUID]ZoneState, error)
+	SetDeviceZones(ctx context.Context, deviceID string, zones map[uuid.UUID]ZoneState) error
+	// PositionsInBox devuelve la última posición conocida de los
+	// dispositivos dentro del rectángulo.
+	PositionsInBox(ctx context.Context, box Box) ([]Fix, error)
+	// RemoveStale saca del índice geo a los dispositivos cuyo último fix es
+	// anterior a before y devuelve cuántos quitó.
+	RemoveStale(ctx context.Context, before time.Time) (int, error)
+	// DriverStatus devuelve el estado del conductor; offline si no tiene.
+	DriverStatus(ctx context.Context, deviceID string) (DriverStatus, error)
+	// SwapDriverStatus guarda next solo si el estado actual sigue siendo
+	// from; false si cambió.
+	SwapDriverStatus(ctx context.Context, deviceID, from string, next DriverStatus) (bool, error)
+}
+
+// Box es un rectángulo en grados.
+type Box struct {
+	MinLongitude float64
+	MinLatitude  float64
+	MaxLongitude float64
+	MaxLatitude  float64
+}
+
+// Broadcaster difunde mensajes a los clientes en vivo (ws.Hub).
+type Broadcaster interface {
+	SendUpdate(data interface{})
+}
+
+// TxRunner ejecuta fn dentro de una transacción.
+type TxRunner func(ctx context.Context, fn func(q database.Querier) error) error
+
+var (
+	errMissingDeviceID   = errors.New("device_id es obligatorio")
+	errCoordinatesBounds = errors.New("Coordenadas fuera de rango")
+	errFixInFuture       = errors.New("recorded_at está en el futuro")
+	errFixTooOld         = errors.New("recorded_at es demasiado antiguo")
+)
+
+// ValidationError indica que el fix fue rechazado por datos inválidos y no
+// por un fallo interno.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+func (f Fix) Validate(now time.Time, opts Options) error {
+	if strings.TrimSpace(f.DeviceID) == "" {
+		return errMissingDeviceID
+	}
+	if f.Latitude < -90 || f.Latitude > 90 || f.Longitude < -180 || f.Longitude > 180 {
+		return errCoordinatesBounds
+	}
+	if f.RecordedAt != nil {
+		if f.RecordedAt.After(now.Add(opts.MaxClockSkew)) {
+			return errFixInFuture
+		}
+		if opts.MaxFixAge > 0 && now.Sub(*f.RecordedAt) > opts.MaxFixAge {
+			return errFixTooOld
+		}
+	}
+	return nil
+}
+
+// Time devuelve la hora del fix, o receivedAt si el dispositivo no la envió.
+func (f Fix) Time(receivedAt time.Time) time.Time {
+	if f.RecordedAt != nil {
+		return *f.RecordedAt
+	}
+	return receivedAt
+}
+
+func (f Fix) params(id uuid.UUID, receivedAt time.Time) database.CreateLocationParams {
+	return database.CreateLocationParams{
+		ID:         id,
+		DeviceID:   f.DeviceID,
+		Latitude:   f.Latitude,
+		Longitude:  f.Longitude,
+		Speed:      sql.NullFloat64{Float64: f.Speed, Valid: true},
+		Heading:    sql.NullFloat64{Float64: f.Heading, Valid: true},
+		Accuracy:   sql.NullFloat64{Float64: f.Accuracy, Valid: true},
+		IsMock:     sql.NullBool{Bool: false, Valid: true},
+		CreatedAt:  sql.NullTime{Time: receivedAt, Valid: true},
+		RecordedAt: f.Time(receivedAt),
+	}
+}
+
+// stamped devuelve el fix con recorded_at resuelto, como se guarda en el
+// cache.
+func (f Fix) stamped(receivedAt time.Time) Fix {
+	at := f.Time(receivedAt)
+	f.RecordedAt = &at
+	return f
+}
+
+func (f Fix) updatePayload() map[string]interface{} {
+	return map[string]interface{}{
+		"type":      "LOCATION_UPDATE",
+		"device_id": f.DeviceID,
+		"latitude":  f.Latitude,
+		"longitude": f.Longitude,
+		"heading":   f.Heading,
+	}
+}
+
+// Service es el camino único de ingesta: valida → inserta → GEOADD →
+// geocercas → broadcast. Lo comparten todos los transportes.
+type Service struct {
+	queries   database.Querier
+	inTx      TxRunner
+	cache     GeoCache
+	hub       Broadcaster
+	logger    *zap.SugaredLogger
+	opts      Options
+	listeners []GeofenceListener
+	pool      *geofencePool
+
+	suppressedFlaps atomic.Uint64
+	uncertainFixes  atomic.Uint64
+	inaccurateFixes atomic.Uint64
+
+	// pending sigue las escrituras de eventos en curso para drenarlas al cerrar.
+	pending sync.WaitGroup
+
+	now func() time.Time
+}
+
+func NewService(q database.Querier, tx TxRunner, c GeoCache, b Broadcaster, l *zap.SugaredLogger, opts Options) *Service {
+	s := &Service{
+		queries: q,
+		inTx:    tx,
+		cache:   c,
+		hub:     b,
+		logger:  l,
+		opts:    opts,
+		now:     time.Now,
+	}
+	s.pool = newGeofencePool(opts.GeofenceWorkers, opts.GeofenceQueueSize, s.checkGeofences)
+	return s
+}
+
+// Close espera a que se evalúen los fixes encolados y se registren sus
+// eventos. Los transportes deben estar detenidos antes de llamarlo.
+func (s *Service) Close() {
+	s.pool.Close()
+	s.pending.Wait()
+}
+
+// GeofenceStats devuelve las métricas del pool de evaluación de geocercas.
+func (s *Service) GeofenceStats() GeofenceStats {
+	stats := s.pool.Stats()
+	stats.SuppressedFlaps = s.suppressedFlaps.Load()
+	stats.Uncertain = s.uncertainFixes.Load()
+	stats.Inaccurate = s.inaccurateFixes.Load()
+	return stats
+}
+
+// enqueueGeofences manda el fix al worker de su dispositivo. Con la cola
+// llena bloquea hasta que haya lugar o ctx expire. Los fixes con precisión
+// peor que MaxGeofenceAccuracy se guardan pero no se evalúan.
+func (s *Service) enqueueGeofences(ctx context.Context, fix Fix, at time.Time) {
+	if s.opts.MaxGeofenceAccuracy > 0 && fix.Accuracy > s.opts.MaxGeofenceAccuracy {
+		s.inaccurateFixes.Add(1)
+		return
+	}
+	if err := s.pool.Submit(ctx, fix, at); err != nil {
+		s.logger.Warnw("Fix descartado para evaluación de geocercas", "device", fix.DeviceID, "error", err)
+	}
+}
+
+// AddGeofenceListener registra un destino adicional para los eventos de
+// geocerca. Debe llamarse antes de empezar a recibir ubicaciones.
+func (s *Service) AddGeofenceListener(l GeofenceListener) {
+	s.listeners = append(s.listeners, l)
+}
+
+// Ingest procesa un fix. Los errores de validación se devuelven como
+// *ValidationError.
+func (s *Service) Ingest(ctx context.Context, fix Fix) (Result, error) {
+	receivedAt := s.now()
+	if err := fix.Validate(receivedAt, s.opts); err != nil {
+		return Result{}, &ValidationError{Err: err}
+	}
+
+	id, _ := uuid.NewV7()
+
+	insertedID, err := s.queries.CreateLocation(ctx, fix.params(id, receivedAt))
+	if err != nil {
+		s.logger.Errorw("Error guardando ubicación", "error", err)
+		return Result{}, err
+	}
+
+	if err := s.cache.UpdatePositions(ctx, fix.stamped(receivedAt)); err != nil {
+		s.logger.Warnw("Falló actualización en Redis", "error", err)
+	}
+
+	s.hub.SendUpdate(fix.updatePayload())
+
+	s.enqueueGeofences(ctx, fix, fix.Time(receivedAt))
+
+	return Result{
+		ID:         insertedID,
+		DeviceID:   fix.DeviceID,
+		RecordedAt: fix.Time(receivedAt),
+		ReceivedAt: receivedAt,
+	}, nil
+}
+
+// SQLTx adapta una conexión *sql.DB a TxRunner.
+func SQLTx(db *sql.DB) TxRunner {
+	return func(ctx context.Context, fn func(q database.Querier) error) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(database.New(db).WithTx(tx)); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+}
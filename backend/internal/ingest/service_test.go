@@ -0,0 +1,770 @@
+package ingest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+)
+
+// fakeQuerier implementa solo las consultas que usa la ingesta.
+type fakeQuerier struct {
+	database.Querier
+
+	mu        sync.Mutex
+	locations []database.CreateLocationParams
+	events    []database.LogGeofenceEventParams
+	zones     []database.FindGeofencesContainingPointRow
+	failWrite bool
+	// failAt, si es mayor que cero, hace fallar ese insert (contando desde 1).
+	failAt int
+
+	// lookup, si está, reemplaza a zones para decidir según el punto.
+	lookup func(database.FindGeofencesContainingPointParams) []database.FindGeofencesContainingPointRow
+	// known recuerda cada zona devuelta para emular las filas "fuera" que la
+	// consulta agrega por Column3.
+	known map[uuid.UUID]database.FindGeofencesContainingPointRow
+	// scheduled son las zonas con horario que ve el scheduler.
+	scheduled []database.ListScheduledGeofencesRow
+}
+
+func (f *fakeQuerier) CreateLocation(_ context.Context, arg database.CreateLocationParams) (uuid.UUID, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failWrite || f.failAt == len(f.locations)+1 {
+		return uuid.Nil, errors.New("db caída")
+	}
+	f.locations = append(f.locations, arg)
+	return arg.ID, nil
+}
+
+func (f *fakeQuerier) FindGeofencesContainingPoint(_ context.Context, arg database.FindGeofencesContainingPointParams) ([]database.FindGeofencesContainingPointRow, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rows := f.zones
+	if f.lookup != nil {
+		rows = f.lookup(arg)
+	}
+	if f.known == nil {
+		f.known = map[uuid.UUID]database.FindGeofencesContainingPointRow{}
+	}
+
+	// Las zonas donde estaba el dispositivo y que ya no devuelve el fake
+	// quedan lejos, bien afuera.
+	out := append([]database.FindGeofencesContainingPointRow(nil), rows...)
+	seen := map[uuid.UUID]bool{}
+	for _, z := range rows {
+		f.known[z.ID] = z
+		seen[z.ID] = true
+	}
+	for _, id := range arg.Column3 {
+		if z, ok := f.known[id]; ok && !seen[id] {
+			z.Inside, z.BoundaryDistanceMeters = false, 1000
+			out = append(out, z)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeQuerier) ListScheduledGeofences(_ context.Context, _ time.Time) ([]database.ListScheduledGeofencesRow, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]database.ListScheduledGeofencesRow(nil), f.scheduled...), nil
+}
+
+func (f *fakeQuerier) setScheduled(zones ...database.ListScheduledGeofencesRow) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scheduled = zones
+}
+
+func (f *fakeQuerier) LogGeofenceEvent(_ context.Context, arg database.LogGeofenceEventParams) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, arg)
+	return nil
+}
+
+// setZones configura las zonas que contienen al próximo fix.
+func (f *fakeQuerier) setZones(zones ...database.FindGeofencesContainingPointRow) {
+	rows := make([]database.FindGeofencesContainingPointRow, len(zones))
+	for i, z := range zones {
+		z.Inside = true
+		rows[i] = z
+	}
+	f.setRows(rows...)
+}
+
+// setRows configura las filas tal cual las devolvería la consulta.
+func (f *fakeQuerier) setRows(rows ...database.FindGeofencesContainingPointRow) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.zones = rows
+}
+
+func (f *fakeQuerier) loggedEvents() []database.LogGeofenceEventParams {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]database.LogGeofenceEventParams(nil), f.events...)
+}
+
+type fakeCache struct {
+	mu        sync.Mutex
+	positions map[string]ingest.Fix
+	zones     map[string]map[uuid.UUID]ingest.ZoneState
+	statuses  map[string]ingest.DriverStatus
+}
+
+func newFakeCache() *fakeCache {
+	return &fakeCache{
+		positions: map[string]ingest.Fix{},
+		zones:     map[string]map[uuid.UUID]ingest.ZoneState{},
+		statuses:  map[string]ingest.DriverStatus{},
+	}
+}
+
+func (c *fakeCache) UpdatePositions(_ context.Context, fixes ...ingest.Fix) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range fixes {
+		if prev, ok := c.positions[f.DeviceID]; ok && prev.RecordedAt != nil &&
+			f.RecordedAt != nil && f.RecordedAt.Before(*prev.RecordedAt) {
+			continue
+		}
+		c.positions[f.DeviceID] = f
+	}
+	return nil
+}
+
+func (c *fakeCache) DeviceZones(_ context.Context, deviceID string) (map[uuid.UUID]ingest.ZoneState, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.zones[deviceID], nil
+}
+
+func (c *fakeCache) SetDeviceZones(_ context.Context, deviceID string, zones map[uuid.UUID]ingest.ZoneState) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.zones[deviceID] = zones
+	return nil
+}
+
+func (c *fakeCache) PositionsInBox(_ context.Context, box ingest.Box) ([]ingest.Fix, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []ingest.Fix
+	for _, f := range c.positions {
+		if f.Longitude >= box.MinLongitude && f.Longitude <= box.MaxLongitude &&
+			f.Latitude >= box.MinLatitude && f.Latitude <= box.MaxLatitude {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+func (c *fakeCache) RemoveStale(_ context.Context, before time.Time) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for deviceID, f := range c.positions {
+		if f.RecordedAt == nil || f.RecordedAt.Before(before) {
+			delete(c.positions, deviceID)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (c *fakeCache) DriverStatus(_ context.Context, deviceID string) (ingest.DriverStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if status, ok := c.statuses[deviceID]; ok {
+		return status, nil
+	}
+	return ingest.DriverStatus{Status: ingest.StatusOffline}, nil
+}
+
+func (c *fakeCache) SwapDriverStatus(_ context.Context, deviceID, from string, next ingest.DriverStatus) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	current := ingest.StatusOffline
+	if status, ok := c.statuses[deviceID]; ok {
+		current = status.Status
+	}
+	if current != from {
+		return false, nil
+	}
+	c.statuses[deviceID] = next
+	return true, nil
+}
+
+func (c *fakeCache) has(deviceID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.positions[deviceID]
+	return ok
+}
+
+type fakeHub struct {
+	mu       sync.Mutex
+	messages []interface{}
+}
+
+func (h *fakeHub) SendUpdate(data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.messages = append(h.messages, data)
+}
+
+func (h *fakeHub) geofenceEvents() []ingest.GeofenceEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []ingest.GeofenceEvent
+	for _, m := range h.messages {
+		if e, ok := m.(ingest.GeofenceEvent); ok {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func noTx(q database.Querier) ingest.TxRunner {
+	return func(_ context.Context, fn func(database.Querier) error) error { return fn(q) }
+}
+
+// stagedTx emula una transacción: los inserts van a un querier aparte y
+// solo llegan a q si fn termina sin error.
+func stagedTx(q *fakeQuerier, failAt int) ingest.TxRunner {
+	return func(_ context.Context, fn func(database.Querier) error) error {
+		tx := &fakeQuerier{failAt: failAt}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.locations = append(q.locations, tx.locations...)
+		return nil
+	}
+}
+
+func newTestService(q *fakeQuerier, c *fakeCache, h *fakeHub) *ingest.Service {
+	return ingest.NewService(q, noTx(q), c, h, zap.NewNop().Sugar(), ingest.Options{
+		MaxClockSkew: time.Minute,
+		MaxFixAge:    time.Hour,
+	})
+}
+
+func TestIngestPersistsAndCaches(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := newTestService(q, c, h)
+
+	recordedAt := time.Now().Add(-10 * time.Minute).UTC()
+	result, err := svc.Ingest(context.Background(), ingest.Fix{
+		DeviceID:   "taxi-001",
+		Latitude:   28.6353,
+		Longitude:  -106.0889,
+		Speed:      40,
+		RecordedAt: &recordedAt,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "taxi-001", result.DeviceID)
+	assert.Equal(t, recordedAt, result.RecordedAt)
+	require.Len(t, q.locations, 1)
+	assert.Equal(t, result.ID, q.locations[0].ID)
+	assert.Equal(t, recordedAt, q.locations[0].RecordedAt)
+	assert.True(t, q.locations[0].CreatedAt.Valid)
+	assert.Contains(t, c.positions, "taxi-001")
+}
+
+func TestIngestCachesReceptionTimeWhenMissing(t *testing.T) {
+	c := newFakeCache()
+	svc := newTestService(&fakeQuerier{}, c, &fakeHub{})
+
+	result, err := svc.Ingest(context.Background(), ingest.Fix{DeviceID: "taxi-002", Latitude: 1, Longitude: 1})
+	require.NoError(t, err)
+
+	// El último fix en cache lleva recorded_at para mostrarlo en los ocupantes.
+	cached := c.positions["taxi-002"].RecordedAt
+	require.NotNil(t, cached)
+	assert.Equal(t, result.ReceivedAt, *cached)
+}
+
+func TestIngestValidation(t *testing.T) {
+	svc := newTestService(&fakeQuerier{}, newFakeCache(), &fakeHub{})
+	future := time.Now().Add(time.Hour)
+	old := time.Now().Add(-2 * time.Hour)
+
+	cases := []struct {
+		name string
+		fix  ingest.Fix
+	}{
+		{"sin device_id", ingest.Fix{Latitude: 10, Longitude: 10}},
+		{"latitud fuera de rango", ingest.Fix{DeviceID: "a", Latitude: 91, Longitude: 10}},
+		{"longitud fuera de rango", ingest.Fix{DeviceID: "a", Latitude: 10, Longitude: -181}},
+		{"recorded_at en el futuro", ingest.Fix{DeviceID: "a", Latitude: 10, Longitude: 10, RecordedAt: &future}},
+		{"recorded_at demasiado antiguo", ingest.Fix{DeviceID: "a", Latitude: 10, Longitude: 10, RecordedAt: &old}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := svc.Ingest(context.Background(), tc.fix)
+			var validationErr *ingest.ValidationError
+			assert.ErrorAs(t, err, &validationErr)
+		})
+	}
+}
+
+func TestIngestStoreFailureIsNotValidation(t *testing.T) {
+	q := &fakeQuerier{failWrite: true}
+	svc := newTestService(q, newFakeCache(), &fakeHub{})
+
+	_, err := svc.Ingest(context.Background(), ingest.Fix{DeviceID: "a", Latitude: 1, Longitude: 1})
+	require.Error(t, err)
+	var validationErr *ingest.ValidationError
+	assert.False(t, errors.As(err, &validationErr))
+}
+
+func TestGeofenceEnterExit(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := newTestService(q, c, h)
+	zone := database.FindGeofencesContainingPointRow{ID: uuid.New(), Name: "Centro", Tags: []string{"centro", "zona-a"}}
+
+	q.setZones(zone)
+	_, err := svc.Ingest(context.Background(), ingest.Fix{DeviceID: "taxi-002", Latitude: 1, Longitude: 1})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(h.geofenceEvents()) == 1 }, time.Second, 5*time.Millisecond)
+
+	enter := h.geofenceEvents()[0]
+	assert.Equal(t, "ENTER", enter.Event)
+	assert.Equal(t, zone.ID, enter.ZoneID)
+	assert.Equal(t, "Centro", enter.ZoneName)
+	assert.Equal(t, zone.Tags, enter.ZoneTags)
+
+	q.setZones()
+	_, err = svc.Ingest(context.Background(), ingest.Fix{DeviceID: "taxi-002", Latitude: 2, Longitude: 2})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(h.geofenceEvents()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "EXIT", h.geofenceEvents()[1].Event)
+	assert.Equal(t, zone.Tags, h.geofenceEvents()[1].ZoneTags)
+
+	require.Eventually(t, func() bool { return len(q.loggedEvents()) == 2 }, time.Second, 5*time.Millisecond)
+}
+
+func TestIngestBatch(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := newTestService(q, c, h)
+
+	now := time.Now()
+	t1, t2 := now.Add(-2*time.Minute), now.Add(-time.Minute)
+
+	results, err := svc.IngestBatch(context.Background(), []ingest.Fix{
+		{DeviceID: "bus-1", Latitude: 1, Longitude: 1, RecordedAt: &t2},
+		{DeviceID: "bus-1", Latitude: 2, Longitude: 2, RecordedAt: &t1},
+		{DeviceID: "bus-2", Latitude: 95, Longitude: 2},
+		{DeviceID: "bus-2", Latitude: 3, Longitude: 3},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+
+	assert.Equal(t, "created", results[0].Status)
+	assert.Equal(t, "created", results[1].Status)
+	assert.Equal(t, "invalid", results[2].Status)
+	assert.NotEmpty(t, results[2].Error)
+	assert.Equal(t, "created", results[3].Status)
+	assert.Len(t, q.locations, 3)
+
+	// El índice geo queda con el fix más reciente, no con el último del lote.
+	assert.Equal(t, 1.0, c.positions["bus-1"].Latitude)
+	assert.Equal(t, 3.0, c.positions["bus-2"].Latitude)
+}
+
+func TestIngestBatchRollsBackOnStoreError(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := ingest.NewService(q, stagedTx(q, 2), c, h, zap.NewNop().Sugar(), ingest.Options{
+		MaxClockSkew: time.Minute,
+		MaxFixAge:    time.Hour,
+	})
+	defer svc.Close()
+
+	_, err := svc.IngestBatch(context.Background(), []ingest.Fix{
+		{DeviceID: "bus-1", Latitude: 1, Longitude: 1},
+		{DeviceID: "bus-2", Latitude: 2, Longitude: 2},
+		{DeviceID: "bus-3", Latitude: 3, Longitude: 3},
+	})
+	require.Error(t, err)
+
+	// Nada del lote queda guardado, en cache ni publicado.
+	assert.Empty(t, q.locations)
+	assert.Empty(t, c.positions)
+	assert.Empty(t, h.messages)
+}
+
+func TestIngestBatchWithoutValidFixes(t *testing.T) {
+	q, c := &fakeQuerier{failWrite: true}, newFakeCache()
+	svc := newTestService(q, c, &fakeHub{})
+
+	results, err := svc.IngestBatch(context.Background(), []ingest.Fix{
+		{DeviceID: "bus-1", Latitude: 95, Longitude: 1},
+		{Latitude: 1, Longitude: 1},
+	})
+	require.NoError(t, err, "sin fixes válidos no se abre la transacción")
+	require.Len(t, results, 2)
+	for i, r := range results {
+		assert.Equal(t, i, r.Index)
+		assert.Equal(t, "invalid", r.Status)
+		assert.Nil(t, r.ID)
+	}
+	assert.Empty(t, c.positions)
+}
+
+func TestIngestOutOfOrderKeepsNewestPosition(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := newTestService(q, c, h)
+
+	now := time.Now()
+	t1, t2, t3 := now.Add(-3*time.Minute), now.Add(-2*time.Minute), now.Add(-time.Minute)
+
+	_, err := svc.Ingest(context.Background(), ingest.Fix{DeviceID: "bus-3", Latitude: 3, Longitude: 3, RecordedAt: &t3})
+	require.NoError(t, err)
+
+	// Un fix atrasado en otra petición se guarda pero no reemplaza la posición.
+	_, err = svc.Ingest(context.Background(), ingest.Fix{DeviceID: "bus-3", Latitude: 1, Longitude: 1, RecordedAt: &t1})
+	require.NoError(t, err)
+	_, err = svc.IngestBatch(context.Background(), []ingest.Fix{
+		{DeviceID: "bus-3", Latitude: 2, Longitude: 2, RecordedAt: &t2},
+	})
+	require.NoError(t, err)
+
+	assert.Len(t, q.locations, 3)
+	assert.Equal(t, 3.0, c.positions["bus-3"].Latitude)
+}
+
+func TestGeofenceDwellAndExitDuration(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := newTestService(q, c, h)
+	zone := database.FindGeofencesContainingPointRow{ID: uuid.New(), Name: "Base", DwellSeconds: 300}
+
+	start := time.Now().Add(-30 * time.Minute).Truncate(time.Second)
+	ingestAt := func(offset time.Duration, inside bool) {
+		if inside {
+			q.setZones(zone)
+		} else {
+			q.setZones()
+		}
+		at := start.Add(offset)
+		evaluate(t, svc, ingest.Fix{DeviceID: "van-7", Latitude: 1, Longitude: 1, RecordedAt: &at})
+	}
+
+	ingestAt(0, true)
+	ingestAt(2*time.Minute, true)
+	ingestAt(6*time.Minute, true)
+	ingestAt(8*time.Minute, true)
+	ingestAt(10*time.Minute, false)
+	svc.Close()
+
+	events := h.geofenceEvents()
+	require.Len(t, events, 3)
+
+	assert.Equal(t, ingest.EventEnter, events[0].Event)
+	assert.Zero(t, events[0].DurationSeconds)
+
+	// Un solo DWELL por visita, con el tiempo transcurrido.
+	assert.Equal(t, ingest.EventDwell, events[1].Event)
+	assert.Equal(t, int64(360), events[1].DurationSeconds)
+
+	assert.Equal(t, ingest.EventExit, events[2].Event)
+	assert.Equal(t, int64(600), events[2].DurationSeconds)
+
+	logged := q.loggedEvents()
+	require.Len(t, logged, 3)
+	durations := map[string]int32{}
+	for _, e := range logged {
+		assert.Equal(t, e.EventType != ingest.EventEnter, e.DurationSeconds.Valid)
+		durations[e.EventType] = e.DurationSeconds.Int32
+	}
+	assert.Equal(t, int32(360), durations[ingest.EventDwell])
+	assert.Equal(t, int32(600), durations[ingest.EventExit])
+}
+
+// evaluate ingesta un fix y espera a que el pool lo evalúe, para poder
+// cambiar las zonas del fake entre fixes.
+func evaluate(t *testing.T, svc *ingest.Service, fix ingest.Fix) {
+	t.Helper()
+	_, err := svc.Ingest(context.Background(), fix)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		stats := svc.GeofenceStats()
+		return stats.Processed == stats.Enqueued
+	}, time.Second, time.Millisecond)
+}
+
+func TestGeofenceHysteresisSuppressesFlaps(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := newTestService(q, c, h)
+	zone := database.FindGeofencesContainingPointRow{ID: uuid.New(), Name: "Estacionamiento", MinFixes: 3}
+
+	start := time.Now().Add(-30 * time.Minute).Truncate(time.Second)
+	step := 0
+	fixAt := func(inside bool) {
+		if inside {
+			q.setZones(zone)
+		} else {
+			q.setZones()
+		}
+		at := start.Add(time.Duration(step) * 10 * time.Second)
+		step++
+		evaluate(t, svc, ingest.Fix{DeviceID: "car-1", Latitude: 1, Longitude: 1, RecordedAt: &at})
+	}
+
+	// Rebote en el borde: nunca llega a 3 fixes seguidos dentro.
+	fixAt(true)
+	fixAt(true)
+	fixAt(false)
+	fixAt(true)
+	fixAt(false)
+	assert.Empty(t, h.geofenceEvents())
+	assert.Equal(t, uint64(2), svc.GeofenceStats().SuppressedFlaps)
+
+	// Entrada real: el ENTER lleva la hora del primer fix de la racha.
+	fixAt(true)
+	fixAt(true)
+	fixAt(true)
+	events := h.geofenceEvents()
+	require.Len(t, events, 1)
+	assert.Equal(t, ingest.EventEnter, events[0].Event)
+	assert.Equal(t, start.Add(50*time.Second), events[0].Timestamp)
+
+	// Un fix suelto afuera no es salida.
+	fixAt(false)
+	fixAt(true)
+	assert.Len(t, h.geofenceEvents(), 1)
+	assert.Equal(t, uint64(3), svc.GeofenceStats().SuppressedFlaps)
+
+	fixAt(false)
+	fixAt(false)
+	fixAt(false)
+	svc.Close()
+
+	events = h.geofenceEvents()
+	require.Len(t, events, 2)
+	assert.Equal(t, ingest.EventExit, events[1].Event)
+	assert.Equal(t, start.Add(100*time.Second), events[1].Timestamp)
+	assert.Equal(t, int64(50), events[1].DurationSeconds)
+}
+
+func TestGeofenceMinDurationAndExitBuffer(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := newTestService(q, c, h)
+	zone := database.FindGeofencesContainingPointRow{ID: uuid.New(), Name: "Patio", MinDurationSeconds: 60, ExitBufferMeters: 10}
+	// Afuera del polígono pero dentro del margen de salida.
+	buffered := zone
+	buffered.BoundaryDistanceMeters = 5
+
+	start := time.Now().Add(-30 * time.Minute).Truncate(time.Second)
+	fixAt := func(offset time.Duration, zones ...database.FindGeofencesContainingPointRow) {
+		q.setRows(zones...)
+		at := start.Add(offset)
+		evaluate(t, svc, ingest.Fix{DeviceID: "car-2", Latitude: 1, Longitude: 1, RecordedAt: &at})
+	}
+
+	inside := zone
+	inside.Inside, inside.BoundaryDistanceMeters = true, 50
+
+	fixAt(0, inside)
+	fixAt(30*time.Second, inside)
+	assert.Empty(t, h.geofenceEvents())
+	fixAt(60*time.Second, inside)
+	require.Len(t, h.geofenceEvents(), 1)
+
+	// Dentro del margen de salida sigue contando como dentro.
+	fixAt(5*time.Minute, buffered)
+	fixAt(10*time.Minute, buffered)
+	assert.Len(t, h.geofenceEvents(), 1)
+
+	fixAt(11 * time.Minute)
+	fixAt(12 * time.Minute)
+	svc.Close()
+
+	events := h.geofenceEvents()
+	require.Len(t, events, 2)
+	assert.Equal(t, ingest.EventExit, events[1].Event)
+	assert.Equal(t, int64(11*60), events[1].DurationSeconds)
+	assert.Zero(t, svc.GeofenceStats().SuppressedFlaps)
+}
+
+func TestGeofenceAccuracyUncertainty(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := newTestService(q, c, h)
+	zone := database.FindGeofencesContainingPointRow{ID: uuid.New(), Name: "Andén"}
+
+	fixAt := func(accuracy float64, inside bool, boundaryDistance float64) {
+		row := zone
+		row.Inside, row.BoundaryDistanceMeters = inside, boundaryDistance
+		q.setRows(row)
+		evaluate(t, svc, ingest.Fix{DeviceID: "bus-9", Latitude: 1, Longitude: 1, Accuracy: accuracy})
+	}
+
+	// Centro dentro, a 20 m del borde, pero con ±50 m: incierto.
+	fixAt(50, true, 20)
+	assert.Empty(t, h.geofenceEvents())
+	assert.Equal(t, uint64(1), svc.GeofenceStats().Uncertain)
+
+	fixAt(10, true, 20)
+	events := h.geofenceEvents()
+	require.Len(t, events, 1)
+	assert.Equal(t, ingest.EventEnter, events[0].Event)
+	assert.Equal(t, ingest.DecisionCertain, events[0].Decision)
+	assert.Equal(t, 10.0, events[0].Accuracy)
+	assert.Equal(t, 20.0, events[0].BoundaryDistance)
+
+	// Centro afuera pero el círculo todavía toca la zona: no hay salida.
+	fixAt(50, false, 30)
+	assert.Len(t, h.geofenceEvents(), 1)
+	assert.Equal(t, uint64(2), svc.GeofenceStats().Uncertain)
+	assert.Zero(t, svc.GeofenceStats().SuppressedFlaps)
+
+	fixAt(0, false, 30)
+	svc.Close()
+
+	events = h.geofenceEvents()
+	require.Len(t, events, 2)
+	assert.Equal(t, ingest.EventExit, events[1].Event)
+	assert.Equal(t, ingest.DecisionExact, events[1].Decision)
+
+	logged := q.loggedEvents()
+	require.Len(t, logged, 2)
+	for _, e := range logged {
+		assert.True(t, e.Decision.Valid)
+		assert.True(t, e.BoundaryDistanceMeters.Valid)
+	}
+}
+
+func TestInaccurateFixesAreStoredButNotEvaluated(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := ingest.NewService(q, noTx(q), c, h, zap.NewNop().Sugar(), ingest.Options{
+		MaxClockSkew:        time.Minute,
+		MaxFixAge:           time.Hour,
+		MaxGeofenceAccuracy: 100,
+	})
+	q.setZones(database.FindGeofencesContainingPointRow{ID: uuid.New(), Name: "Centro"})
+
+	_, err := svc.Ingest(context.Background(), ingest.Fix{DeviceID: "taxi-404", Latitude: 1, Longitude: 1, Accuracy: 850})
+	require.NoError(t, err)
+	svc.Close()
+
+	assert.Len(t, q.locations, 1)
+	assert.Empty(t, h.geofenceEvents())
+	stats := svc.GeofenceStats()
+	assert.Equal(t, uint64(1), stats.Inaccurate)
+	assert.Zero(t, stats.Enqueued)
+}
+
+func TestGeofenceOnlyForAssignedDevices(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := newTestService(q, c, h)
+	zone := database.FindGeofencesContainingPointRow{ID: uuid.New(), Name: "Andén de carga", Inside: true}
+
+	// La consulta filtra por asignación; el fake emula que solo aplica a
+	// camion-1.
+	q.lookup = func(arg database.FindGeofencesContainingPointParams) []database.FindGeofencesContainingPointRow {
+		if arg.Column5 == "camion-1" {
+			return []database.FindGeofencesContainingPointRow{zone}
+		}
+		return nil
+	}
+
+	for _, device := range []string{"camion-1", "moto-7"} {
+		_, err := svc.Ingest(context.Background(), ingest.Fix{DeviceID: device, Latitude: 1, Longitude: 1})
+		require.NoError(t, err)
+	}
+	svc.Close()
+
+	events := h.geofenceEvents()
+	require.Len(t, events, 1)
+	assert.Equal(t, "camion-1", events[0].DeviceID)
+	assert.Equal(t, "ENTER", events[0].Event)
+}
+
+func TestGeofenceOverspeed(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := ingest.NewService(q, noTx(q), c, h, zap.NewNop().Sugar(), ingest.Options{
+		MaxClockSkew:      time.Minute,
+		MaxFixAge:         time.Hour,
+		SpeedLimitKmh:     80,
+		SpeedToleranceKmh: 5,
+		SpeedMinDuration:  10 * time.Second,
+	})
+	// El límite de la zona reemplaza al global.
+	zone := database.FindGeofencesContainingPointRow{ID: uuid.New(), Name: "Escuela", SpeedLimitKmh: 50}
+
+	start := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	fixAt := func(offset time.Duration, speed float64, inside bool) {
+		if inside {
+			q.setZones(zone)
+		} else {
+			q.setZones()
+		}
+		at := start.Add(offset)
+		evaluate(t, svc, ingest.Fix{DeviceID: "bus-9", Latitude: 1, Longitude: 1, Speed: speed, RecordedAt: &at})
+	}
+
+	fixAt(0, 40, true)
+	fixAt(5*time.Second, 58, true)
+	fixAt(10*time.Second, 70, true)
+	fixAt(20*time.Second, 60, true)
+	fixAt(25*time.Second, 52, true) // dentro de la tolerancia: cierra el exceso
+	// Un pico de un solo fix no llega a la duración mínima.
+	fixAt(30*time.Second, 90, true)
+	fixAt(35*time.Second, 40, true)
+	// Un exceso abierto se cierra al salir de la zona.
+	fixAt(40*time.Second, 60, true)
+	fixAt(55*time.Second, 65, true)
+	fixAt(60*time.Second, 64, false)
+	svc.Close()
+
+	events := h.geofenceEvents()
+	require.Len(t, events, 4)
+	assert.Equal(t, ingest.EventEnter, events[0].Event)
+
+	first := events[1]
+	assert.Equal(t, ingest.EventOverspeed, first.Event)
+	assert.Equal(t, start.Add(5*time.Second), first.Timestamp)
+	assert.Equal(t, int64(15), first.DurationSeconds)
+	assert.Equal(t, []float64{58, 70, 52}, []float64{first.StartSpeed, first.PeakSpeed, first.EndSpeed})
+
+	second := events[2]
+	assert.Equal(t, ingest.EventOverspeed, second.Event)
+	assert.Equal(t, int64(15), second.DurationSeconds)
+	assert.Equal(t, []float64{60, 65, 64}, []float64{second.StartSpeed, second.PeakSpeed, second.EndSpeed})
+
+	assert.Equal(t, ingest.EventExit, events[3].Event)
+
+	for _, e := range q.loggedEvents() {
+		overspeed := e.EventType == ingest.EventOverspeed
+		assert.Equal(t, overspeed, e.PeakSpeedKmh.Valid, e.EventType)
+		assert.Equal(t, !overspeed, e.BoundaryDistanceMeters.Valid, e.EventType)
+	}
+}
+
+func TestFixMessageSpeedUnits(t *testing.T) {
+	var msg ingest.FixMessage
+	require.NoError(t, json.Unmarshal([]byte(`{"device_id":"bus-1","speed":50}`), &msg))
+	assert.InDelta(t, 50.0, msg.Normalized().Speed, 1e-9)
+
+	msg = ingest.FixMessage{}
+	require.NoError(t, json.Unmarshal([]byte(`{"device_id":"bus-1","speed":99,"speed_mps":12.5}`), &msg))
+	fix := msg.Normalized()
+	assert.InDelta(t, 45.0, fix.Speed, 1e-9)
+	assert.Equal(t, "bus-1", fix.DeviceID)
+}
@@ -0,0 +1,65 @@
+package ingest
+
+import (
+	"context"
+	"time"
+)
+
+// RunStaleSweeper saca cada interval del índice geo a los dispositivos que
+// no reportan desde hace más de DriverFreshness, para que las búsquedas en
+// Redis no devuelvan conductores desconectados, y poda el último fix que
+// recuerda el pool de geocercas. Bloquea hasta que ctx termine.
+func (s *Service) RunStaleSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.sweepStale(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) sweepStale(ctx context.Context) {
+	if before := s.pruneBefore(); !before.IsZero() {
+		if err := s.pool.Prune(ctx, before); err != nil {
+			s.logger.Warnw("Error podando el último fix por dispositivo", "error", err)
+		}
+	}
+
+	if s.opts.DriverFreshness <= 0 {
+		return
+	}
+	removed, err := s.cache.RemoveStale(ctx, s.FreshSince())
+	if err != nil {
+		s.logger.Warnw("Error barriendo conductores inactivos", "error", err)
+		return
+	}
+	if removed > 0 {
+		s.logger.Infow("Conductores inactivos quitados del índice geo", "removed", removed)
+	}
+}
+
+// pruneBefore es la hora antes de la cual el pool olvida el último fix de un
+// dispositivo: la antigüedad máxima de un fix, ya que nada anterior pasa la
+// validación. Podar antes dejaría evaluar un fix atrasado contra un estado
+// más nuevo.
+func (s *Service) pruneBefore() time.Time {
+	if s.opts.MaxFixAge <= 0 {
+		return time.Time{}
+	}
+	return s.now().Add(-s.opts.MaxFixAge)
+}
+
+// FreshSince es la hora del fix más viejo que todavía cuenta como activo en
+// las búsquedas de conductores; cero si DriverFreshness no limita.
+func (s *Service) FreshSince() time.Time {
+	if s.opts.DriverFreshness <= 0 {
+		return time.Time{}
+	}
+	return s.now().Add(-s.opts.DriverFreshness)
+}
@@ -0,0 +1,92 @@
+package ingest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+)
+
+func TestStaleSweeperRemovesInactiveDrivers(t *testing.T) {
+	q, c := &fakeQuerier{}, newFakeCache()
+	svc := ingest.NewService(q, noTx(q), c, &fakeHub{}, zap.NewNop().Sugar(), ingest.Options{
+		MaxClockSkew:    time.Minute,
+		MaxFixAge:       time.Hour,
+		DriverFreshness: 5 * time.Minute,
+	})
+	defer svc.Close()
+
+	recent, old := time.Now().Add(-time.Minute), time.Now().Add(-10*time.Minute)
+	require.NoError(t, c.UpdatePositions(context.Background(),
+		ingest.Fix{DeviceID: "taxi-1", Latitude: 1, Longitude: 1, RecordedAt: &recent},
+		ingest.Fix{DeviceID: "taxi-2", Latitude: 1, Longitude: 1, RecordedAt: &old},
+	))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svc.RunStaleSweeper(ctx, 5*time.Millisecond)
+
+	require.Eventually(t, func() bool { return !c.has("taxi-2") }, time.Second, 5*time.Millisecond)
+	assert.True(t, c.has("taxi-1"))
+	assert.WithinDuration(t, time.Now().Add(-5*time.Minute), svc.FreshSince(), time.Second)
+}
+
+func TestFreshSinceWithoutWindow(t *testing.T) {
+	svc := newTestService(&fakeQuerier{}, newFakeCache(), &fakeHub{})
+	defer svc.Close()
+	assert.True(t, svc.FreshSince().IsZero())
+}
+
+func TestStaleSweeperPrunesLastFixPerDevice(t *testing.T) {
+	q := &fakeQuerier{}
+	svc := ingest.NewService(q, noTx(q), newFakeCache(), &fakeHub{}, zap.NewNop().Sugar(), ingest.Options{
+		MaxClockSkew:    time.Minute,
+		MaxFixAge:       100 * time.Millisecond,
+		DriverFreshness: 5 * time.Minute,
+	})
+	defer svc.Close()
+
+	at := time.Now()
+	_, err := svc.Ingest(context.Background(), ingest.Fix{DeviceID: "taxi-1", Latitude: 1, Longitude: 1, RecordedAt: &at})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return svc.GeofenceStats().Tracked == 1 }, time.Second, 5*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svc.RunStaleSweeper(ctx, 5*time.Millisecond)
+
+	// Solo se olvida cuando el fix ya no pasaría la validación.
+	require.Eventually(t, func() bool { return svc.GeofenceStats().Tracked == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestStaleSweeperKeepsOrderingForQuietDevices(t *testing.T) {
+	q := &fakeQuerier{}
+	svc := ingest.NewService(q, noTx(q), newFakeCache(), &fakeHub{}, zap.NewNop().Sugar(), ingest.Options{
+		MaxClockSkew:    time.Minute,
+		MaxFixAge:       time.Hour,
+		DriverFreshness: 5 * time.Minute,
+	})
+	defer svc.Close()
+
+	// El último fix tiene 20 minutos: inactivo para las búsquedas, pero su
+	// marca de orden sigue valiendo.
+	last, late := time.Now().Add(-20*time.Minute), time.Now().Add(-25*time.Minute)
+	_, err := svc.Ingest(context.Background(), ingest.Fix{DeviceID: "taxi-1", Latitude: 1, Longitude: 1, RecordedAt: &last})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svc.RunStaleSweeper(ctx, 5*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+
+	_, err = svc.Ingest(context.Background(), ingest.Fix{DeviceID: "taxi-1", Latitude: 2, Longitude: 2, RecordedAt: &late})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return svc.GeofenceStats().Stale == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int64(1), svc.GeofenceStats().Tracked)
+}
@@ -0,0 +1,120 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Estados de disponibilidad de un conductor. Un dispositivo sin estado
+// guardado está offline.
+const (
+	StatusOffline   = "offline"
+	StatusAvailable = "available"
+	StatusEnRoute   = "en-route"
+	StatusBusy      = "busy"
+	StatusOnBreak   = "on-break"
+)
+
+// allStatuses fija el orden de los estados donde hace falta recorrerlos.
+var allStatuses = []string{StatusOffline, StatusAvailable, StatusEnRoute, StatusBusy, StatusOnBreak}
+
+// statusTransitions son los cambios permitidos desde cada estado.
+var statusTransitions = map[string][]string{
+	StatusOffline:   {StatusAvailable},
+	StatusAvailable: {StatusEnRoute, StatusBusy, StatusOnBreak, StatusOffline},
+	StatusEnRoute:   {StatusBusy, StatusAvailable, StatusOffline},
+	StatusBusy:      {StatusAvailable, StatusOffline},
+	StatusOnBreak:   {StatusAvailable, StatusOffline},
+}
+
+// ErrStatusConflict indica que el estado cambió mientras se aplicaba otro
+// cambio; el cliente debe releerlo y reintentar.
+var ErrStatusConflict = errors.New("El estado del conductor cambió mientras se actualizaba")
+
+// DriverStatus es el estado de un conductor y desde cuándo lo tiene.
+type DriverStatus struct {
+	Status string `json:"status"`
+	// Since es cero si el dispositivo nunca tuvo estado.
+	Since time.Time `json:"since"`
+}
+
+// TransitionError indica un cambio de estado no permitido.
+type TransitionError struct {
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("No se puede pasar de %s a %s", e.From, e.To)
+}
+
+// ValidStatus dice si status es uno de los estados conocidos.
+func ValidStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// CanTransition dice si se puede pasar de from a to.
+func CanTransition(from, to string) bool {
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusEvent es lo que se difunde al cambiar el estado de un conductor.
+type StatusEvent struct {
+	Type     string    `json:"type"`
+	DeviceID string    `json:"device_id"`
+	Status   string    `json:"status"`
+	Previous string    `json:"previous"`
+	Since    time.Time `json:"since"`
+}
+
+// SetDriverStatus lleva al conductor al estado status si la transición está
+// permitida y la difunde como DRIVER_STATUS. Pedir el estado actual no es un
+// cambio: lo devuelve sin difundir nada.
+func (s *Service) SetDriverStatus(ctx context.Context, deviceID, status string) (DriverStatus, error) {
+	if !ValidStatus(status) {
+		return DriverStatus{}, fmt.Errorf("Estado desconocido %q", status)
+	}
+
+	current, err := s.cache.DriverStatus(ctx, deviceID)
+	if err != nil {
+		return DriverStatus{}, err
+	}
+	if current.Status == status {
+		return current, nil
+	}
+	if !CanTransition(current.Status, status) {
+		return DriverStatus{}, &TransitionError{From: current.Status, To: status}
+	}
+
+	next := DriverStatus{Status: status, Since: s.now().UTC()}
+	swapped, err := s.cache.SwapDriverStatus(ctx, deviceID, current.Status, next)
+	if err != nil {
+		return DriverStatus{}, err
+	}
+	if !swapped {
+		return DriverStatus{}, ErrStatusConflict
+	}
+
+	s.hub.SendUpdate(StatusEvent{
+		Type:     "DRIVER_STATUS",
+		DeviceID: deviceID,
+		Status:   status,
+		Previous: current.Status,
+		Since:    next.Since,
+	})
+	s.logger.Infow("DRIVER STATUS", "device", deviceID, "from", current.Status, "to", status)
+	return next, nil
+}
+
+// DriverStatus devuelve el estado actual del conductor.
+func (s *Service) DriverStatus(ctx context.Context, deviceID string) (DriverStatus, error) {
+	return s.cache.DriverStatus(ctx, deviceID)
+}
@@ -0,0 +1,69 @@
+package ingest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+)
+
+func TestDriverStatusTransitions(t *testing.T) {
+	c, h := newFakeCache(), &fakeHub{}
+	svc := newTestService(&fakeQuerier{}, c, h)
+	defer svc.Close()
+	ctx := context.Background()
+
+	status, err := svc.DriverStatus(ctx, "taxi-1")
+	require.NoError(t, err)
+	assert.Equal(t, ingest.StatusOffline, status.Status, "sin estado guardado")
+
+	// offline no puede pasar directo a ocupado.
+	_, err = svc.SetDriverStatus(ctx, "taxi-1", ingest.StatusBusy)
+	var transition *ingest.TransitionError
+	require.True(t, errors.As(err, &transition))
+	assert.Equal(t, ingest.StatusOffline, transition.From)
+
+	for _, next := range []string{ingest.StatusAvailable, ingest.StatusEnRoute, ingest.StatusBusy, ingest.StatusAvailable} {
+		status, err = svc.SetDriverStatus(ctx, "taxi-1", next)
+		require.NoError(t, err)
+		assert.Equal(t, next, status.Status)
+		assert.False(t, status.Since.IsZero())
+	}
+
+	// Repetir el estado actual no es un cambio ni se difunde.
+	_, err = svc.SetDriverStatus(ctx, "taxi-1", ingest.StatusAvailable)
+	require.NoError(t, err)
+
+	events := h.statusEvents()
+	require.Len(t, events, 4)
+	assert.Equal(t, "DRIVER_STATUS", events[1].Type)
+	assert.Equal(t, ingest.StatusAvailable, events[1].Previous)
+	assert.Equal(t, ingest.StatusEnRoute, events[1].Status)
+
+	_, err = svc.SetDriverStatus(ctx, "taxi-1", "durmiendo")
+	assert.Error(t, err)
+}
+
+func TestCanTransition(t *testing.T) {
+	assert.True(t, ingest.CanTransition(ingest.StatusOnBreak, ingest.StatusAvailable))
+	assert.False(t, ingest.CanTransition(ingest.StatusOnBreak, ingest.StatusBusy))
+	assert.False(t, ingest.CanTransition(ingest.StatusBusy, ingest.StatusEnRoute))
+	assert.True(t, ingest.CanTransition(ingest.StatusEnRoute, ingest.StatusOffline))
+	assert.False(t, ingest.CanTransition("durmiendo", ingest.StatusAvailable))
+}
+
+func (h *fakeHub) statusEvents() []ingest.StatusEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []ingest.StatusEvent
+	for _, m := range h.messages {
+		if e, ok := m.(ingest.StatusEvent); ok {
+			out = append(out, e)
+		}
+	}
+	return out
+}
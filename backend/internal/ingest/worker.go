@@ -0,0 +1,226 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrPoolClosed = errors.New("pool de geocercas cerrado")
+
+type geofenceJob struct {
+	fix Fix
+	at  time.Time
+	// fn, si está, reemplaza la evaluación del fix (p. ej. cambios de
+	// horario que tocan el estado del dispositivo).
+	fn func()
+	// pruneBefore, si no es cero, reemplaza la evaluación por la limpieza
+	// del último fix de los dispositivos inactivos desde entonces.
+	pruneBefore time.Time
+}
+
+// GeofenceStats expone el estado del pool para monitoreo.
+type GeofenceStats struct {
+	Workers       int `json:"workers"`
+	QueueCapacity int `json:"queue_capacity"`
+	// Queued es el total de fixes esperando y MaxQueueDepth la cola más llena.
+	Queued        int `json:"queued"`
+	MaxQueueDepth int `json:"max_queue_depth"`
+
+	Enqueued  uint64 `json:"enqueued"`
+	Processed uint64 `json:"processed"`
+	// Blocked cuenta los envíos que encontraron la cola llena y tuvieron que
+	// esperar; Dropped los que se abandonaron porque el contexto expiró.
+	Blocked uint64 `json:"blocked"`
+	Dropped uint64 `json:"dropped"`
+	// Stale cuenta fixes más viejos que el último evaluado del dispositivo y
+	// Tracked los dispositivos de los que se recuerda ese último fix.
+	Stale   uint64 `json:"stale"`
+	Tracked int64  `json:"tracked_devices"`
+	// SuppressedFlaps cuenta transiciones descartadas por la histéresis.
+	SuppressedFlaps uint64 `json:"suppressed_flaps"`
+	// Uncertain cuenta evaluaciones donde la precisión cruzaba el borde e
+	// Inaccurate los fixes que ni se evaluaron por superar el límite.
+	Uncertain  uint64 `json:"uncertain"`
+	Inaccurate uint64 `json:"skipped_inaccurate"`
+}
+
+// geofencePool reparte los fixes en colas por dispositivo (hash del
+// device_id), así cada dispositivo se evalúa siempre en el mismo worker y en
+// orden, sin carreras sobre driver:zones:<id>.
+type geofencePool struct {
+	queues []chan geofenceJob
+	eval   func(Fix, time.Time)
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+
+	enqueued  atomic.Uint64
+	processed atomic.Uint64
+	blocked   atomic.Uint64
+	dropped   atomic.Uint64
+	stale     atomic.Uint64
+	tracked   atomic.Int64
+}
+
+func newGeofencePool(workers, queueSize int, eval func(Fix, time.Time)) *geofencePool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	p := &geofencePool{
+		queues: make([]chan geofenceJob, workers),
+		eval:   eval,
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan geofenceJob, queueSize)
+		p.wg.Add(1)
+		go p.run(p.queues[i])
+	}
+	return p
+}
+
+func (p *geofencePool) run(queue chan geofenceJob) {
+	defer p.wg.Done()
+
+	// Solo este worker ve a sus dispositivos, no hace falta lock.
+	lastAt := make(map[string]time.Time)
+
+	for job := range queue {
+		if job.fn != nil {
+			job.fn()
+			p.processed.Add(1)
+			continue
+		}
+		if !job.pruneBefore.IsZero() {
+			for deviceID, at := range lastAt {
+				if at.Before(job.pruneBefore) {
+					delete(lastAt, deviceID)
+					p.tracked.Add(-1)
+				}
+			}
+			p.processed.Add(1)
+			continue
+		}
+		prev, ok := lastAt[job.fix.DeviceID]
+		if ok && job.at.Before(prev) {
+			p.stale.Add(1)
+			p.processed.Add(1)
+			continue
+		}
+		if !ok {
+			p.tracked.Add(1)
+		}
+		lastAt[job.fix.DeviceID] = job.at
+
+		p.eval(job.fix, job.at)
+		p.processed.Add(1)
+	}
+}
+
+func (p *geofencePool) queueFor(deviceID string) chan geofenceJob {
+	h := fnv.New32a()
+	h.Write([]byte(deviceID))
+	return p.queues[h.Sum32()%uint32(len(p.queues))]
+}
+
+// Submit encola un fix. Si la cola del dispositivo está llena espera
+// (backpressure hacia el transporte) hasta que haya lugar o ctx expire.
+func (p *geofencePool) Submit(ctx context.Context, fix Fix, at time.Time) error {
+	return p.enqueue(ctx, fix.DeviceID, geofenceJob{fix: fix, at: at})
+}
+
+// Do ejecuta fn en el worker del dispositivo, en orden con sus fixes.
+func (p *geofencePool) Do(ctx context.Context, deviceID string, fn func()) error {
+	return p.enqueue(ctx, deviceID, geofenceJob{fn: fn})
+}
+
+// Prune hace que cada worker olvide el último fix de los dispositivos sin
+// fixes desde before; si no, el mapa crece con cada device_id que llegue.
+// Un fix posterior de esos dispositivos se evalúa como el primero.
+func (p *geofencePool) Prune(ctx context.Context, before time.Time) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, queue := range p.queues {
+		if err := p.send(ctx, queue, geofenceJob{pruneBefore: before}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *geofencePool) enqueue(ctx context.Context, deviceID string, job geofenceJob) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.send(ctx, p.queueFor(deviceID), job)
+}
+
+// send encola job en queue; el llamador tiene p.mu en lectura.
+func (p *geofencePool) send(ctx context.Context, queue chan geofenceJob, job geofenceJob) error {
+	if p.closed {
+		p.dropped.Add(1)
+		return ErrPoolClosed
+	}
+
+	select {
+	case queue <- job:
+		p.enqueued.Add(1)
+		return nil
+	default:
+	}
+
+	p.blocked.Add(1)
+	select {
+	case queue <- job:
+		p.enqueued.Add(1)
+		return nil
+	case <-ctx.Done():
+		p.dropped.Add(1)
+		return ctx.Err()
+	}
+}
+
+// Close deja de aceptar fixes y espera a que los workers vacíen sus colas.
+func (p *geofencePool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	for _, q := range p.queues {
+		close(q)
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+func (p *geofencePool) Stats() GeofenceStats {
+	stats := GeofenceStats{
+		Workers:   len(p.queues),
+		Enqueued:  p.enqueued.Load(),
+		Processed: p.processed.Load(),
+		Blocked:   p.blocked.Load(),
+		Dropped:   p.dropped.Load(),
+		Stale:     p.stale.Load(),
+		Tracked:   p.tracked.Load(),
+	}
+	for _, q := range p.queues {
+		stats.QueueCapacity += cap(q)
+		stats.Queued += len(q)
+		if len(q) > stats.MaxQueueDepth {
+			stats.MaxQueueDepth = len(q)
+		}
+	}
+	return stats
+}
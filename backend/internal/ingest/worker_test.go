@@ -0,0 +1,107 @@
+package ingest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/AlexG695/geo-engine-core/internal/database"
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+)
+
+// insideAtLatitudeOne devuelve la zona solo para fixes con latitud 1.
+func insideAtLatitudeOne(zone database.FindGeofencesContainingPointRow) func(database.FindGeofencesContainingPointParams) []database.FindGeofencesContainingPointRow {
+	return func(arg database.FindGeofencesContainingPointParams) []database.FindGeofencesContainingPointRow {
+		if lat, _ := arg.StMakepoint_2.(float64); lat == 1 {
+			zone.Inside = true
+			return []database.FindGeofencesContainingPointRow{zone}
+		}
+		return nil
+	}
+}
+
+func TestGeofenceEvaluationIsOrderedPerDevice(t *testing.T) {
+	zone := database.FindGeofencesContainingPointRow{ID: uuid.New(), Name: "Centro"}
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	q.lookup = insideAtLatitudeOne(zone)
+
+	// Colas mínimas para forzar backpressure.
+	svc := ingest.NewService(q, noTx(q), c, h, zap.NewNop().Sugar(), ingest.Options{
+		MaxClockSkew:      time.Minute,
+		MaxFixAge:         time.Hour,
+		GeofenceWorkers:   2,
+		GeofenceQueueSize: 1,
+	})
+
+	const fixes = 50
+	start := time.Now().Add(-30 * time.Minute)
+	for i := 0; i < fixes; i++ {
+		at := start.Add(time.Duration(i) * time.Second)
+		lat := 1.0
+		if i%2 == 1 {
+			lat = 2
+		}
+		_, err := svc.Ingest(context.Background(), ingest.Fix{DeviceID: "taxi-010", Latitude: lat, Longitude: 1, RecordedAt: &at})
+		require.NoError(t, err)
+	}
+
+	// Close drena las colas y las escrituras pendientes.
+	svc.Close()
+
+	events := h.geofenceEvents()
+	require.Len(t, events, fixes)
+	for i, e := range events {
+		want := "ENTER"
+		if i%2 == 1 {
+			want = "EXIT"
+		}
+		assert.Equal(t, want, e.Event, "evento %d", i)
+		assert.Equal(t, start.Add(time.Duration(i)*time.Second), e.Timestamp)
+	}
+	assert.Len(t, q.loggedEvents(), fixes)
+
+	stats := svc.GeofenceStats()
+	assert.Equal(t, 2, stats.Workers)
+	assert.Equal(t, uint64(fixes), stats.Enqueued)
+	assert.Equal(t, uint64(fixes), stats.Processed)
+	assert.Zero(t, stats.Queued)
+}
+
+func TestGeofenceEvaluationSkipsStaleFixes(t *testing.T) {
+	zone := database.FindGeofencesContainingPointRow{ID: uuid.New(), Name: "Centro"}
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	q.lookup = insideAtLatitudeOne(zone)
+	svc := newTestService(q, c, h)
+
+	now := time.Now()
+	newer, older := now.Add(-time.Minute), now.Add(-5*time.Minute)
+
+	_, err := svc.Ingest(context.Background(), ingest.Fix{DeviceID: "taxi-011", Latitude: 1, Longitude: 1, RecordedAt: &newer})
+	require.NoError(t, err)
+	// Llega tarde un fix de afuera: se guarda pero no provoca EXIT.
+	_, err = svc.Ingest(context.Background(), ingest.Fix{DeviceID: "taxi-011", Latitude: 2, Longitude: 2, RecordedAt: &older})
+	require.NoError(t, err)
+	svc.Close()
+
+	events := h.geofenceEvents()
+	require.Len(t, events, 1)
+	assert.Equal(t, "ENTER", events[0].Event)
+	assert.Len(t, q.locations, 2)
+	assert.Equal(t, uint64(1), svc.GeofenceStats().Stale)
+}
+
+func TestIngestAfterCloseStillStores(t *testing.T) {
+	q, c, h := &fakeQuerier{}, newFakeCache(), &fakeHub{}
+	svc := newTestService(q, c, h)
+	svc.Close()
+
+	_, err := svc.Ingest(context.Background(), ingest.Fix{DeviceID: "taxi-012", Latitude: 1, Longitude: 1})
+	require.NoError(t, err)
+	assert.Len(t, q.locations, 1)
+	assert.Equal(t, uint64(1), svc.GeofenceStats().Dropped)
+}
@@ -0,0 +1,174 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"go.uber.org/zap"
+)
+
+const (
+	qos            = 1
+	connectTimeout = 10 * time.Second
+	publishTimeout = 5 * time.Second
+	// ingestTimeout acota cada mensaje: la ingesta corre en el goroutine de
+	// paho y una base trabada no debe frenar la suscripción para siempre.
+	ingestTimeout = 10 * time.Second
+
+	// deviceIDPlaceholder se reemplaza en EventTopic por el device_id.
+	deviceIDPlaceholder = "{device_id}"
+)
+
+// Ingester es el camino de ingesta compartido con el endpoint HTTP.
+type Ingester interface {
+	Ingest(ctx context.Context, fix ingest.Fix) (ingest.Result, error)
+}
+
+type Options struct {
+	BrokerURL string
+	ClientID  string
+	Username  string
+	Password  string
+	// LocationTopic es el filtro de suscripción; el nivel '+' es el device_id
+	// (p. ej. fleet/+/location).
+	LocationTopic string
+	// EventTopic es donde se publican las transiciones de geocerca
+	// (p. ej. fleet/{device_id}/geofence). Vacío desactiva la publicación.
+	EventTopic string
+}
+
+// Bridge consume ubicaciones desde un broker MQTT y publica de vuelta los
+// eventos ENTER/EXIT de geocercas.
+type Bridge struct {
+	opts     Options
+	ingester Ingester
+	logger   *zap.SugaredLogger
+	client   paho.Client
+
+	deviceLevel int
+}
+
+func NewBridge(opts Options, i Ingester, l *zap.SugaredLogger) (*Bridge, error) {
+	level := -1
+	for idx, part := range strings.Split(opts.LocationTopic, "/") {
+		if part == "+" {
+			level = idx
+			break
+		}
+	}
+	if level < 0 {
+		return nil, errors.New("mqtt: el tópico de ubicaciones necesita un nivel '+' para el device_id")
+	}
+
+	return &Bridge{
+		opts:        opts,
+		ingester:    i,
+		logger:      l,
+		deviceLevel: level,
+	}, nil
+}
+
+// Start conecta al broker. La suscripción se renueva en cada reconexión.
+func (b *Bridge) Start() error {
+	clientOpts := paho.NewClientOptions().
+		AddBroker(b.opts.BrokerURL).
+		SetClientID(b.opts.ClientID).
+		SetUsername(b.opts.Username).
+		SetPassword(b.opts.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectTimeout(connectTimeout).
+		// handleMessage depende de esto: paho entrega los mensajes de a uno
+		// y en orden, así los fixes de un dispositivo se ingieren en el
+		// orden en que se publicaron.
+		SetOrderMatters(true).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			b.logger.Warnw("Conexión MQTT perdida", "error", err)
+		})
+
+	b.client = paho.NewClient(clientOpts)
+
+	token := b.client.Connect()
+	if !token.WaitTimeout(connectTimeout) {
+		b.logger.Warnw("Broker MQTT no responde, reintentando en segundo plano", "broker", b.opts.BrokerURL)
+		return nil
+	}
+	return token.Error()
+}
+
+func (b *Bridge) Stop() {
+	if b.client != nil {
+		b.client.Disconnect(250)
+	}
+}
+
+func (b *Bridge) onConnect(c paho.Client) {
+	token := c.Subscribe(b.opts.LocationTopic, qos, b.handleMessage)
+	token.Wait()
+	if err := token.Error(); err != nil {
+		b.logger.Errorw("No se pudo suscribir a MQTT", "topic", b.opts.LocationTopic, "error", err)
+		return
+	}
+	b.logger.Infow("Bridge MQTT suscrito", "broker", b.opts.BrokerURL, "topic", b.opts.LocationTopic)
+}
+
+// handleMessage ingiere un fix de forma síncrona, en el goroutine de paho
+// (ver SetOrderMatters): mientras dura, los siguientes mensajes esperan.
+func (b *Bridge) handleMessage(_ paho.Client, msg paho.Message) {
+	deviceID := b.deviceFromTopic(msg.Topic())
+	if deviceID == "" {
+		b.logger.Warnw("Tópico MQTT sin device_id", "topic", msg.Topic())
+		return
+	}
+
+	var payload ingest.FixMessage
+	if err := json.Unmarshal(msg.Payload(), &payload); err != nil {
+		b.logger.Warnw("Payload MQTT inválido", "topic", msg.Topic(), "error", err)
+		return
+	}
+	fix := payload.Normalized()
+	// El tópico manda sobre el payload: así un dispositivo solo puede
+	// publicar en su propio tópico (vía ACLs del broker).
+	fix.DeviceID = deviceID
+
+	ctx, cancel := context.WithTimeout(context.Background(), ingestTimeout)
+	defer cancel()
+	if _, err := b.ingester.Ingest(ctx, fix); err != nil {
+		b.logger.Warnw("Ubicación MQTT rechazada", "device", deviceID, "error", err)
+	}
+}
+
+func (b *Bridge) deviceFromTopic(topic string) string {
+	parts := strings.Split(topic, "/")
+	if b.deviceLevel >= len(parts) {
+		return ""
+	}
+	return parts[b.deviceLevel]
+}
+
+// PublishGeofenceEvent implementa ingest.GeofenceListener.
+func (b *Bridge) PublishGeofenceEvent(event ingest.GeofenceEvent) {
+	if b.opts.EventTopic == "" || b.client == nil || !b.client.IsConnectionOpen() {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		b.logger.Warnw("Error codificando evento para MQTT", "error", err)
+		return
+	}
+
+	topic := strings.ReplaceAll(b.opts.EventTopic, deviceIDPlaceholder, event.DeviceID)
+	token := b.client.Publish(topic, qos, false, payload)
+	go func() {
+		if token.WaitTimeout(publishTimeout) && token.Error() != nil {
+			b.logger.Warnw("Falló publicación MQTT", "topic", topic, "error", token.Error())
+		}
+	}()
+}
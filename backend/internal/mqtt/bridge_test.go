@@ -0,0 +1,134 @@
+package mqtt_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+	"github.com/AlexG695/geo-engine-core/internal/mqtt"
+)
+
+type fakeIngester struct {
+	mu    sync.Mutex
+	fixes []ingest.Fix
+	// unbounded cuenta las ingestas que recibieron un contexto sin deadline.
+	unbounded int
+}
+
+func (f *fakeIngester) Ingest(ctx context.Context, fix ingest.Fix) (ingest.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fixes = append(f.fixes, fix)
+	if _, ok := ctx.Deadline(); !ok {
+		f.unbounded++
+	}
+	return ingest.Result{ID: uuid.New(), DeviceID: fix.DeviceID}, nil
+}
+
+func (f *fakeIngester) received() []ingest.Fix {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]ingest.Fix(nil), f.fixes...)
+}
+
+func startBroker(t *testing.T) string {
+	server := mochi.New(nil)
+	require.NoError(t, server.AddHook(new(auth.AllowHook), nil))
+
+	tcp := listeners.NewTCP(listeners.Config{ID: "test", Address: "127.0.0.1:0"})
+	require.NoError(t, server.AddListener(tcp))
+
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+
+	return "tcp://" + tcp.Address()
+}
+
+func connectClient(t *testing.T, broker, id string) paho.Client {
+	client := paho.NewClient(paho.NewClientOptions().AddBroker(broker).SetClientID(id))
+	token := client.Connect()
+	require.True(t, token.WaitTimeout(5*time.Second))
+	require.NoError(t, token.Error())
+	t.Cleanup(func() { client.Disconnect(100) })
+	return client
+}
+
+func TestBridgeIngestsAndPublishes(t *testing.T) {
+	broker := startBroker(t)
+	ingester := &fakeIngester{}
+
+	bridge, err := mqtt.NewBridge(mqtt.Options{
+		BrokerURL:     broker,
+		ClientID:      "geo-engine-test",
+		LocationTopic: "fleet/+/location",
+		EventTopic:    "fleet/{device_id}/geofence",
+	}, ingester, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	require.NoError(t, bridge.Start())
+	defer bridge.Stop()
+
+	vehicle := connectClient(t, broker, "truck-42")
+
+	events := make(chan ingest.GeofenceEvent, 1)
+	sub := vehicle.Subscribe("fleet/truck-42/geofence", 1, func(_ paho.Client, msg paho.Message) {
+		var e ingest.GeofenceEvent
+		if json.Unmarshal(msg.Payload(), &e) == nil {
+			events <- e
+		}
+	})
+	require.True(t, sub.WaitTimeout(5*time.Second))
+
+	// El device_id del payload se ignora: manda el del tópico.
+	pub := vehicle.Publish("fleet/truck-42/location", 1, false,
+		`{"device_id":"otro","latitude":28.63,"longitude":-106.08,"speed":35}`)
+	require.True(t, pub.WaitTimeout(5*time.Second))
+
+	require.Eventually(t, func() bool { return len(ingester.received()) == 1 }, 5*time.Second, 20*time.Millisecond)
+	fix := ingester.received()[0]
+	assert.Equal(t, "truck-42", fix.DeviceID)
+	assert.InDelta(t, 28.63, fix.Latitude, 1e-9)
+	assert.InDelta(t, 35.0, fix.Speed, 1e-9)
+
+	// Android reporta m/s: speed_mps se convierte a km/h.
+	pub = vehicle.Publish("fleet/truck-42/location", 1, false,
+		`{"latitude":28.63,"longitude":-106.08,"speed_mps":10}`)
+	require.True(t, pub.WaitTimeout(5*time.Second))
+	require.Eventually(t, func() bool { return len(ingester.received()) == 2 }, 5*time.Second, 20*time.Millisecond)
+	assert.InDelta(t, 36.0, ingester.received()[1].Speed, 1e-9)
+
+	ingester.mu.Lock()
+	assert.Zero(t, ingester.unbounded, "la ingesta debe correr con un contexto acotado")
+	ingester.mu.Unlock()
+
+	bridge.PublishGeofenceEvent(ingest.GeofenceEvent{
+		Type:     "GEOFENCE_EVENT",
+		DeviceID: "truck-42",
+		ZoneName: "Patio",
+		Event:    "ENTER",
+	})
+
+	select {
+	case e := <-events:
+		assert.Equal(t, "ENTER", e.Event)
+		assert.Equal(t, "Patio", e.ZoneName)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no llegó el evento de geocerca al tópico MQTT")
+	}
+}
+
+func TestNewBridgeRequiresWildcard(t *testing.T) {
+	_, err := mqtt.NewBridge(mqtt.Options{LocationTopic: "fleet/location"}, &fakeIngester{}, zap.NewNop().Sugar())
+	assert.Error(t, err)
+}
@@ -0,0 +1,206 @@
+package udp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+)
+
+// Formato binario (big-endian), pensado para trackers con poco ancho de banda:
+//
+//	0      magic 'G' (0x47)
+//	1      versión (0x02)
+//	2      flags (bit 0: incluye recorded_at)
+//	3      longitud del device_id (N)
+//	4..    device_id (N bytes)
+//	+0     seq      uint32, contador del dispositivo
+//	+4     latitud  int32, grados * 1e7
+//	+8     longitud int32, grados * 1e7
+//	+12    speed    uint16, km/h * 100
+//	+14    heading  uint16, * 100
+//	+16    accuracy uint16, * 100
+//	+18    recorded_at uint32, epoch en segundos (solo si flag)
+//	final  tag de 8 bytes: HMAC-SHA256(DeviceToken, frame sin tag) truncado
+//
+// Un datagrama que empiece con '{' se trata como JSON:
+//
+//	{"fix": {...}, "seq": N, "sig": "<hex de HMAC-SHA256(DeviceToken, seq || bytes de fix)>"}
+//
+// donde seq entra a la firma como uint32 big-endian.
+//
+// seq numera los datagramas del dispositivo y debe crecer con cada envío,
+// incluidos los reintentos; el servidor acepta cada valor una sola vez (ver
+// ReplayGuard). Para no quedar bloqueado tras un reinicio, el tracker debe
+// persistir el contador.
+const (
+	frameMagic   byte = 0x47
+	frameVersion byte = 0x02
+
+	flagRecordedAt byte = 1 << 0
+
+	tagSize      = 8
+	coordScale   = 1e7
+	measureScale = 100
+)
+
+var (
+	ErrFrameTooShort   = errors.New("datagrama demasiado corto")
+	ErrUnknownFormat   = errors.New("formato de datagrama desconocido")
+	ErrUnauthenticated = errors.New("datagrama sin autenticación válida")
+)
+
+// Packet es un fix decodificado de un datagrama junto con su formato, para
+// responder con el mismo.
+type Packet struct {
+	Fix    ingest.Fix
+	Seq    uint32
+	Binary bool
+}
+
+// jsonDatagram conserva los bytes exactos del fix para verificar la firma
+// sin depender de cómo se serialicen los números.
+type jsonDatagram struct {
+	Fix json.RawMessage `json:"fix"`
+	Seq uint32          `json:"seq"`
+	Sig string          `json:"sig"`
+}
+
+// DeviceToken deriva el token de un dispositivo a partir del secreto del
+// servidor. Se entrega al tracker al darlo de alta y evita distribuir la
+// API key global a hardware que puede ser robado.
+func DeviceToken(secret, deviceID string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(deviceID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Decode interpreta un datagrama (JSON o binario) y verifica su autenticación.
+func Decode(data []byte, secret string) (Packet, error) {
+	if len(data) == 0 {
+		return Packet{}, ErrFrameTooShort
+	}
+
+	switch data[0] {
+	case '{':
+		return decodeJSON(data, secret)
+	case frameMagic:
+		return decodeBinary(data, secret)
+	default:
+		return Packet{}, ErrUnknownFormat
+	}
+}
+
+func decodeJSON(data []byte, secret string) (Packet, error) {
+	var d jsonDatagram
+	if err := json.Unmarshal(data, &d); err != nil {
+		return Packet{}, err
+	}
+	if len(d.Fix) == 0 || d.Sig == "" {
+		return Packet{}, ErrUnauthenticated
+	}
+
+	var msg ingest.FixMessage
+	if err := json.Unmarshal(d.Fix, &msg); err != nil {
+		return Packet{}, err
+	}
+	fix := msg.Normalized()
+
+	sig, err := hex.DecodeString(d.Sig)
+	if err != nil || !hmac.Equal(sig, jsonSig(DeviceToken(secret, fix.DeviceID), d.Seq, d.Fix)) {
+		return Packet{}, ErrUnauthenticated
+	}
+
+	return Packet{Fix: fix, Seq: d.Seq}, nil
+}
+
+func jsonSig(token string, seq uint32, fix []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write(binary.BigEndian.AppendUint32(nil, seq))
+	mac.Write(fix)
+	return mac.Sum(nil)
+}
+
+// EncodeJSON arma un datagrama JSON firmado, equivalente a EncodeBinary.
+func EncodeJSON(fix ingest.Fix, seq uint32, token string) []byte {
+	raw, _ := json.Marshal(fix)
+	data, _ := json.Marshal(jsonDatagram{Fix: raw, Seq: seq, Sig: hex.EncodeToString(jsonSig(token, seq, raw))})
+	return data
+}
+
+func decodeBinary(data []byte, secret string) (Packet, error) {
+	if len(data) < 4 {
+		return Packet{}, ErrFrameTooShort
+	}
+	if data[1] != frameVersion {
+		return Packet{}, ErrUnknownFormat
+	}
+
+	flags := data[2]
+	idLen := int(data[3])
+
+	bodyLen := 4 + idLen + 18
+	if flags&flagRecordedAt != 0 {
+		bodyLen += 4
+	}
+	if len(data) != bodyLen+tagSize {
+		return Packet{}, ErrFrameTooShort
+	}
+
+	deviceID := string(data[4 : 4+idLen])
+	body, tag := data[:bodyLen], data[bodyLen:]
+	if !hmac.Equal(tag, frameTag(DeviceToken(secret, deviceID), body)) {
+		return Packet{}, ErrUnauthenticated
+	}
+
+	p := data[4+idLen:]
+	fix := ingest.Fix{
+		DeviceID:  deviceID,
+		Latitude:  float64(int32(binary.BigEndian.Uint32(p[4:8]))) / coordScale,
+		Longitude: float64(int32(binary.BigEndian.Uint32(p[8:12]))) / coordScale,
+		Speed:     float64(binary.BigEndian.Uint16(p[12:14])) / measureScale,
+		Heading:   float64(binary.BigEndian.Uint16(p[14:16])) / measureScale,
+		Accuracy:  float64(binary.BigEndian.Uint16(p[16:18])) / measureScale,
+	}
+	if flags&flagRecordedAt != 0 {
+		at := time.Unix(int64(binary.BigEndian.Uint32(p[18:22])), 0).UTC()
+		fix.RecordedAt = &at
+	}
+
+	return Packet{Fix: fix, Seq: binary.BigEndian.Uint32(p[0:4]), Binary: true}, nil
+}
+
+func frameTag(token string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write(body)
+	return mac.Sum(nil)[:tagSize]
+}
+
+// EncodeBinary arma un frame binario firmado. Lo usan las pruebas y sirve
+// como referencia para el firmware de los trackers.
+func EncodeBinary(fix ingest.Fix, seq uint32, token string) []byte {
+	var flags byte
+	if fix.RecordedAt != nil {
+		flags |= flagRecordedAt
+	}
+
+	buf := []byte{frameMagic, frameVersion, flags, byte(len(fix.DeviceID))}
+	buf = append(buf, fix.DeviceID...)
+	buf = binary.BigEndian.AppendUint32(buf, seq)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(int32(math.Round(fix.Latitude*coordScale))))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(int32(math.Round(fix.Longitude*coordScale))))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(math.Round(fix.Speed*measureScale)))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(math.Round(fix.Heading*measureScale)))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(math.Round(fix.Accuracy*measureScale)))
+	if fix.RecordedAt != nil {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(fix.RecordedAt.Unix()))
+	}
+
+	return append(buf, frameTag(token, buf)...)
+}
@@ -0,0 +1,118 @@
+package udp_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+	"github.com/AlexG695/geo-engine-core/internal/udp"
+)
+
+const testSecret = "test-secret"
+
+func TestDecodeBinaryRoundTrip(t *testing.T) {
+	recordedAt := time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)
+	fix := ingest.Fix{
+		DeviceID:   "tracker-01",
+		Latitude:   28.6353123,
+		Longitude:  -106.0889456,
+		Speed:      42.5,
+		Heading:    180.25,
+		Accuracy:   4.8,
+		RecordedAt: &recordedAt,
+	}
+
+	frame := udp.EncodeBinary(fix, 7, udp.DeviceToken(testSecret, fix.DeviceID))
+
+	packet, err := udp.Decode(frame, testSecret)
+	require.NoError(t, err)
+	assert.True(t, packet.Binary)
+	assert.Equal(t, uint32(7), packet.Seq)
+	assert.Equal(t, fix.DeviceID, packet.Fix.DeviceID)
+	assert.InDelta(t, fix.Latitude, packet.Fix.Latitude, 1e-7)
+	assert.InDelta(t, fix.Longitude, packet.Fix.Longitude, 1e-7)
+	assert.InDelta(t, fix.Speed, packet.Fix.Speed, 0.01)
+	assert.InDelta(t, fix.Heading, packet.Fix.Heading, 0.01)
+	assert.InDelta(t, fix.Accuracy, packet.Fix.Accuracy, 0.01)
+	require.NotNil(t, packet.Fix.RecordedAt)
+	assert.True(t, recordedAt.Equal(*packet.Fix.RecordedAt))
+}
+
+func TestDecodeBinaryRejectsTamperedFrame(t *testing.T) {
+	fix := ingest.Fix{DeviceID: "tracker-01", Latitude: 19.4, Longitude: -99.1}
+
+	wrongToken := udp.EncodeBinary(fix, 1, udp.DeviceToken("otro-secreto", fix.DeviceID))
+	_, err := udp.Decode(wrongToken, testSecret)
+	assert.ErrorIs(t, err, udp.ErrUnauthenticated)
+
+	frame := udp.EncodeBinary(fix, 1, udp.DeviceToken(testSecret, fix.DeviceID))
+	frame[len(frame)-12] ^= 0xFF
+	_, err = udp.Decode(frame, testSecret)
+	assert.ErrorIs(t, err, udp.ErrUnauthenticated)
+
+	_, err = udp.Decode(frame[:10], testSecret)
+	assert.ErrorIs(t, err, udp.ErrFrameTooShort)
+}
+
+func TestDecodeJSONAuth(t *testing.T) {
+	recordedAt := time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)
+	fix := ingest.Fix{DeviceID: "tracker-02", Latitude: 19.4, Longitude: -99.1, RecordedAt: &recordedAt}
+	token := udp.DeviceToken(testSecret, fix.DeviceID)
+
+	packet, err := udp.Decode(udp.EncodeJSON(fix, 42, token), testSecret)
+	require.NoError(t, err)
+	assert.False(t, packet.Binary)
+	assert.Equal(t, uint32(42), packet.Seq)
+	assert.InDelta(t, 19.4, packet.Fix.Latitude, 1e-9)
+
+	cases := []struct {
+		name    string
+		payload []byte
+		wantErr error
+	}{
+		{"api key en claro", []byte(`{"key":"test-secret","device_id":"tracker-02","latitude":19.4,"longitude":-99.1}`), udp.ErrUnauthenticated},
+		{"token de otro dispositivo", udp.EncodeJSON(ingest.Fix{DeviceID: "tracker-03", RecordedAt: &recordedAt}, 1, token), udp.ErrUnauthenticated},
+		{"fix alterado", bytes.Replace(udp.EncodeJSON(fix, 42, token), []byte("19.4"), []byte("19.5"), 1), udp.ErrUnauthenticated},
+		{"secuencia alterada", bytes.Replace(udp.EncodeJSON(fix, 42, token), []byte(`"seq":42`), []byte(`"seq":43`), 1), udp.ErrUnauthenticated},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := udp.Decode(tc.payload, testSecret)
+			assert.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestDecodeBinaryWithoutTimestamp(t *testing.T) {
+	fix := ingest.Fix{DeviceID: "tracker-01", Latitude: 19.4, Longitude: -99.1}
+
+	packet, err := udp.Decode(udp.EncodeBinary(fix, 3, udp.DeviceToken(testSecret, fix.DeviceID)), testSecret)
+	require.NoError(t, err)
+	assert.Nil(t, packet.Fix.RecordedAt)
+	assert.Equal(t, uint32(3), packet.Seq)
+}
+
+func TestReplayGuard(t *testing.T) {
+	guard := udp.NewReplayGuard()
+
+	require.NoError(t, guard.Accept("tracker-01", 10))
+	assert.ErrorIs(t, guard.Accept("tracker-01", 10), udp.ErrReplayed, "repetido")
+	assert.NoError(t, guard.Accept("tracker-01", 12))
+	assert.NoError(t, guard.Accept("tracker-01", 11), "llegó desordenado dentro de la ventana")
+	assert.ErrorIs(t, guard.Accept("tracker-01", 11), udp.ErrReplayed, "repetido tras desorden")
+	assert.NoError(t, guard.Accept("tracker-02", 10), "otro dispositivo")
+
+	require.NoError(t, guard.Accept("tracker-01", 200))
+	assert.ErrorIs(t, guard.Accept("tracker-01", 12), udp.ErrReplayed, "fuera de la ventana")
+	assert.NoError(t, guard.Accept("tracker-01", 199))
+}
+
+func TestDecodeUnknownFormat(t *testing.T) {
+	_, err := udp.Decode([]byte("hola"), testSecret)
+	assert.ErrorIs(t, err, udp.ErrUnknownFormat)
+}
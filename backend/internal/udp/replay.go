@@ -0,0 +1,70 @@
+package udp
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrReplayed = errors.New("datagrama repetido o con secuencia demasiado antigua")
+
+// replayWindow es cuántas secuencias por detrás de la más alta se siguen
+// aceptando, para tolerar datagramas que la red entrega desordenados.
+const replayWindow = 64
+
+// ReplayGuard rechaza datagramas autenticados que alguien capturó y reenvía.
+// Cada dispositivo numera sus datagramas con un contador propio; se acepta
+// cada secuencia una sola vez, dentro de una ventana deslizante como la de
+// IPsec. La detección no depende de recorded_at, así que un tracker puede
+// mandar varios fixes del mismo segundo o subir fixes viejos que tenía en
+// buffer; la antigüedad de cada fix la valida la ingesta (FIX_MAX_AGE).
+//
+// El estado vive solo en memoria: al reiniciar el servidor se olvidan las
+// secuencias vistas.
+type ReplayGuard struct {
+	mu      sync.Mutex
+	devices map[string]*seqWindow
+}
+
+type seqWindow struct {
+	highest uint32
+	// seen marca las secuencias ya aceptadas: el bit i corresponde a
+	// highest-i.
+	seen uint64
+}
+
+func NewReplayGuard() *ReplayGuard {
+	return &ReplayGuard{devices: make(map[string]*seqWindow)}
+}
+
+// Accept registra seq como vista si es nueva para el dispositivo. Las
+// entradas no se expiran: solo se crean para dispositivos autenticados, así
+// que el mapa crece con la flota y no con el tráfico.
+func (g *ReplayGuard) Accept(deviceID string, seq uint32) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	w, ok := g.devices[deviceID]
+	if !ok {
+		g.devices[deviceID] = &seqWindow{highest: seq, seen: 1}
+		return nil
+	}
+
+	if seq > w.highest {
+		shift := seq - w.highest
+		if shift >= replayWindow {
+			w.seen = 0
+		} else {
+			w.seen <<= shift
+		}
+		w.seen |= 1
+		w.highest = seq
+		return nil
+	}
+
+	behind := w.highest - seq
+	if behind >= replayWindow || w.seen&(1<<behind) != 0 {
+		return ErrReplayed
+	}
+	w.seen |= 1 << behind
+	return nil
+}
@@ -0,0 +1,181 @@
+package udp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"net"
+	"sync"
+
+	"github.com/AlexG695/geo-engine-core/internal/ingest"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	maxDatagramSize = 1500
+	numWorkers      = 32
+	// queueSize es la capacidad de la cola de cada worker.
+	queueSize = 128
+)
+
+// ACK binario: magic + estado.
+//
+// Solo se responde a datagramas autenticados: contestar a cualquier paquete
+// convertiría el listener en un amplificador para direcciones falsificadas.
+const (
+	ackOK      byte = 0x00
+	ackInvalid byte = 0x01
+	ackError   byte = 0x03
+)
+
+// Ingester es el camino de ingesta compartido con el endpoint HTTP.
+type Ingester interface {
+	Ingest(ctx context.Context, fix ingest.Fix) (ingest.Result, error)
+}
+
+type datagram struct {
+	packet Packet
+	addr   *net.UDPAddr
+}
+
+type Server struct {
+	addr     string
+	secret   string
+	ingester Ingester
+	logger   *zap.SugaredLogger
+	replay   *ReplayGuard
+
+	conn *net.UDPConn
+	// Cada dispositivo cae siempre en la misma cola, así sus fixes se
+	// ingieren en el orden en que llegaron.
+	queues []chan datagram
+}
+
+func NewServer(addr, secret string, i Ingester, l *zap.SugaredLogger) *Server {
+	queues := make([]chan datagram, numWorkers)
+	for i := range queues {
+		queues[i] = make(chan datagram, queueSize)
+	}
+
+	return &Server{
+		addr:     addr,
+		secret:   secret,
+		ingester: i,
+		logger:   l,
+		replay:   NewReplayGuard(),
+		queues:   queues,
+	}
+}
+
+// ListenAndServe atiende datagramas hasta que ctx se cancela.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	s.conn, err = net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return err
+	}
+
+	// Los workers terminan de procesar lo encolado aunque ctx ya se haya
+	// cancelado.
+	workCtx := context.WithoutCancel(ctx)
+
+	var wg sync.WaitGroup
+	for _, queue := range s.queues {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range queue {
+				s.handle(workCtx, d)
+			}
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		s.conn.Close()
+	}()
+
+	s.logger.Infow("Listener UDP iniciado", "addr", s.conn.LocalAddr().String())
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			s.logger.Warnw("Error leyendo datagrama", "error", err)
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+
+		// Decodificar y verificar la secuencia aquí, en un solo goroutine,
+		// evita que dos workers compitan por el mismo dispositivo.
+		packet, err := Decode(buf[:n], s.secret)
+		if err == nil {
+			err = s.replay.Accept(packet.Fix.DeviceID, packet.Seq)
+		}
+		if err != nil {
+			s.logger.Debugw("Datagrama descartado", "from", addr.String(), "error", err)
+			continue
+		}
+
+		select {
+		case s.queueFor(packet.Fix.DeviceID) <- datagram{packet: packet, addr: addr}:
+		default:
+			s.logger.Warnw("Cola UDP llena, datagrama descartado", "from", addr.String(), "device_id", packet.Fix.DeviceID)
+		}
+	}
+
+	for _, queue := range s.queues {
+		close(queue)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (s *Server) queueFor(deviceID string) chan datagram {
+	h := fnv.New32a()
+	h.Write([]byte(deviceID))
+	return s.queues[h.Sum32()%uint32(len(s.queues))]
+}
+
+func (s *Server) handle(ctx context.Context, d datagram) {
+	packet := d.packet
+	result, err := s.ingester.Ingest(ctx, packet.Fix)
+
+	var validationErr *ingest.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		s.reply(d.addr, packet.Binary, ackInvalid, uuid.Nil, err)
+	case err != nil:
+		s.reply(d.addr, packet.Binary, ackError, uuid.Nil, errors.New("Error interno"))
+	default:
+		s.reply(d.addr, packet.Binary, ackOK, result.ID, nil)
+	}
+}
+
+func (s *Server) reply(addr *net.UDPAddr, binaryFormat bool, status byte, id uuid.UUID, err error) {
+	var msg []byte
+	if binaryFormat {
+		msg = []byte{frameMagic, status}
+	} else {
+		resp := map[string]interface{}{"status": "created", "id": id}
+		if err != nil {
+			resp = map[string]interface{}{"status": "rejected", "error": err.Error()}
+		}
+		msg, _ = json.Marshal(resp)
+	}
+
+	if _, werr := s.conn.WriteToUDP(msg, addr); werr != nil {
+		s.logger.Debugw("No se pudo responder datagrama", "to", addr.String(), "error", werr)
+	}
+}
@@ -1,9 +1,9 @@
 -- name: CreateLocation :one
 -- Guarda una nueva ubicación y devuelve el ID insertado.
 INSERT INTO locations (
-    id, device_id, latitude, longitude, accuracy, heading, speed, is_mock, created_at
+    id, device_id, latitude, longitude, accuracy, heading, speed, is_mock, created_at, recorded_at
 ) VALUES (
-             $1, $2, $3, $4, $5, $6, $7, $8, $9
+             $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
          )
     RETURNING id;
 
@@ -11,33 +11,110 @@ INSERT INTO locations (
 -- Obtiene la última ubicación conocida de un dispositivo.
 SELECT * FROM locations
 WHERE device_id = $1
-ORDER BY created_at DESC
+ORDER BY recorded_at DESC
     LIMIT 1;
 
 
 
 -- name: GetNearbyDrivers :many
--- Busca conductores dentro de un radio (en metros) usando PostGIS.
--- ST_DWithin usa índices espaciales, así que es ULTRA rápido.
+-- Último fix de cada dispositivo activo desde since que cae dentro del radio
+-- (en metros), con su distancia al centro, opcionalmente solo entre
+-- device_ids. Ordena por distancia o, con by_last_seen, del más reciente al
+-- más viejo.
+WITH latest AS (
+    SELECT DISTINCT ON (device_id)
+        device_id, latitude, longitude, heading, speed, recorded_at, geom
+    FROM locations
+    WHERE recorded_at > @since::timestamptz
+      AND (sqlc.narg(device_ids)::text[] IS NULL OR device_id = ANY(sqlc.narg(device_ids)::text[]))
+    ORDER BY device_id, recorded_at DESC
+)
 SELECT
-    id, device_id, latitude, longitude, heading, speed, created_at
-FROM locations
-WHERE
-  -- Compara la columna geom contra un punto creado al vuelo
-    ST_DWithin(
-            geom,
+    device_id, latitude, longitude,
+    COALESCE(heading, 0)::float8 AS heading,
+    COALESCE(speed, 0)::float8 AS speed,
+    recorded_at,
+    ST_Distance(
+            geom::geography,
+            ST_SetSRID(ST_MakePoint(@lng::float8, @lat::float8), 4326)::geography
+    )::float8 AS distance_meters
+FROM latest
+WHERE ST_DWithin(
+            geom::geography,
             ST_SetSRID(ST_MakePoint(@lng::float8, @lat::float8), 4326)::geography,
             @radius_meters::float8
-    )
-  AND created_at > NOW() - INTERVAL '5 minutes' -- Solo conductores activos recientemente
-ORDER BY created_at DESC;
+      )
+ORDER BY CASE WHEN @by_last_seen::bool THEN recorded_at END DESC, distance_meters, device_id
+LIMIT @max_results::int;
+
+
+
+-- name: GetNearestDrivers :many
+-- Los max_results dispositivos más cercanos (KNN sobre el último fix de cada
+-- uno), opcionalmente solo entre device_ids y dentro de max_distance metros.
+WITH latest AS (
+    SELECT DISTINCT ON (device_id)
+        device_id, latitude, longitude, heading, speed, recorded_at, geom
+    FROM locations
+    WHERE recorded_at > @since::timestamptz
+      AND (sqlc.narg(device_ids)::text[] IS NULL OR device_id = ANY(sqlc.narg(device_ids)::text[]))
+    ORDER BY device_id, recorded_at DESC
+)
+SELECT
+    device_id, latitude, longitude,
+    COALESCE(heading, 0)::float8 AS heading,
+    COALESCE(speed, 0)::float8 AS speed,
+    recorded_at,
+    ST_Distance(
+            geom::geography,
+            ST_SetSRID(ST_MakePoint(@lng::float8, @lat::float8), 4326)::geography
+    )::float8 AS distance_meters
+FROM latest
+WHERE sqlc.narg(max_distance)::float8 IS NULL
+   OR ST_DWithin(
+            geom::geography,
+            ST_SetSRID(ST_MakePoint(@lng::float8, @lat::float8), 4326)::geography,
+            sqlc.narg(max_distance)::float8
+      )
+ORDER BY geom::geography <-> ST_SetSRID(ST_MakePoint(@lng::float8, @lat::float8), 4326)::geography, device_id
+LIMIT @max_results::int;
+
+
+
+-- name: GetDriversWithin :many
+-- Último fix de cada dispositivo activo desde since que cae dentro del área
+-- (Polygon o MultiPolygon GeoJSON), con su distancia al centro del
+-- rectángulo que la contiene, opcionalmente solo entre device_ids.
+WITH area AS (
+    SELECT ST_SetSRID(ST_GeomFromGeoJSON(@geojson::text), 4326) AS geom
+), latest AS (
+    SELECT DISTINCT ON (device_id)
+        device_id, latitude, longitude, heading, speed, recorded_at, geom
+    FROM locations
+    WHERE recorded_at > @since::timestamptz
+      AND (sqlc.narg(device_ids)::text[] IS NULL OR device_id = ANY(sqlc.narg(device_ids)::text[]))
+    ORDER BY device_id, recorded_at DESC
+)
+SELECT
+    latest.device_id, latest.latitude, latest.longitude,
+    COALESCE(latest.heading, 0)::float8 AS heading,
+    COALESCE(latest.speed, 0)::float8 AS speed,
+    latest.recorded_at,
+    ST_Distance(
+            latest.geom::geography,
+            ST_Centroid(ST_Envelope(area.geom))::geography
+    )::float8 AS distance_meters
+FROM latest, area
+WHERE ST_Intersects(latest.geom, area.geom)
+ORDER BY CASE WHEN @by_last_seen::bool THEN latest.recorded_at END DESC, distance_meters, latest.device_id
+LIMIT @max_results::int;
 
 
 
 -- name: GetDriverRoute :one
 SELECT
     COALESCE(
-            ST_AsGeoJSON(ST_MakeLine(geom ORDER BY created_at))::text,
+            ST_AsGeoJSON(ST_MakeLine(geom ORDER BY recorded_at))::text,
             '{"type": "LineString", "coordinates": []}'
     )::text as geojson_route
 FROM locations
@@ -45,35 +122,416 @@ WHERE
     device_id = $1;
 
 
+-- name: GetGeofenceSchedule :one
+-- Cadena vacía si la zona no tiene horario.
+SELECT COALESCE(schedule::text, '')::text AS schedule
+FROM geofences
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: GetGeofenceName :one
+SELECT name FROM geofences
+WHERE id = $1 AND deleted_at IS NULL;
+
 -- name: GetGeofences :many
-SELECT id, name, ST_AsGeoJSON(area)::text as geojson
-FROM geofences;
+-- geojson es siempre el polígono (circunscrito en círculos y corredores);
+-- los parámetros originales de cada forma vienen aparte.
+-- Los filtros NULL no se aplican: tags exige todas las etiquetas, search
+-- busca en el nombre (con los comodines ya escapados) y el bbox se cruza con
+-- el área. page_limit NULL devuelve todas.
+SELECT id, name, ST_AsGeoJSON(area)::text as geojson, COALESCE(dwell_seconds, 0)::int as dwell_seconds,
+       min_fixes, min_duration_seconds, exit_buffer_meters,
+       shape,
+       COALESCE(ST_Y(center::geometry), 0)::float8 as center_latitude,
+       COALESCE(ST_X(center::geometry), 0)::float8 as center_longitude,
+       COALESCE(radius_meters, 0)::float8 as radius_meters,
+       COALESCE(ST_AsGeoJSON(path), '')::text as path_geojson,
+       COALESCE(width_meters, 0)::float8 as width_meters,
+       COALESCE(speed_limit_kmh, 0)::float8 as speed_limit_kmh,
+       COALESCE(description, '')::text as description,
+       COALESCE(color, '')::text as color,
+       COALESCE(category, '')::text as category,
+       COALESCE(tags, '{}')::text[] as tags,
+       COALESCE(properties, '{}')::jsonb as properties
+FROM geofences
+WHERE deleted_at IS NULL
+  AND (sqlc.narg(tags)::text[] IS NULL OR tags @> sqlc.narg(tags)::text[])
+  AND (sqlc.narg(category)::text IS NULL OR category = sqlc.narg(category)::text)
+  AND (sqlc.narg(search)::text IS NULL OR name ILIKE '%' || sqlc.narg(search)::text || '%')
+  AND (sqlc.narg(min_lng)::float8 IS NULL
+       OR ST_Intersects(area, ST_MakeEnvelope(sqlc.narg(min_lng)::float8, sqlc.narg(min_lat)::float8,
+                                              sqlc.narg(max_lng)::float8, sqlc.narg(max_lat)::float8, 4326)))
+ORDER BY name, id
+LIMIT sqlc.narg(page_limit)::int OFFSET @page_offset::int;
+
+-- name: CountGeofences :one
+-- Total de zonas con los mismos filtros que GetGeofences, para paginar.
+SELECT count(*)::int
+FROM geofences
+WHERE deleted_at IS NULL
+  AND (sqlc.narg(tags)::text[] IS NULL OR tags @> sqlc.narg(tags)::text[])
+  AND (sqlc.narg(category)::text IS NULL OR category = sqlc.narg(category)::text)
+  AND (sqlc.narg(search)::text IS NULL OR name ILIKE '%' || sqlc.narg(search)::text || '%')
+  AND (sqlc.narg(min_lng)::float8 IS NULL
+       OR ST_Intersects(area, ST_MakeEnvelope(sqlc.narg(min_lng)::float8, sqlc.narg(min_lat)::float8,
+                                              sqlc.narg(max_lng)::float8, sqlc.narg(max_lat)::float8, 4326)));
 
 -- name: FindGeofencesContainingPoint :many
-SELECT id, name
+-- Zonas que contienen el punto más las de $3 (donde estaba el dispositivo),
+-- para poder confirmar salidas aunque ya esté lejos. La distancia al borde
+-- permite comparar contra la precisión del fix. Círculos y corredores se
+-- evalúan en geography con sus parámetros; area solo prefiltra. Las zonas
+-- fuera de horario en $4 (hora del fix) solo vuelven por $3, marcadas con
+-- off_schedule, para poder cerrar la visita. Solo cuentan las zonas
+-- asignadas al dispositivo $5; las que dejaron de estarlo (o se borraron) se
+-- descartan. speed_limit_kmh 0 indica que se usa el límite
+-- global. tags viaja en los eventos para que los consumidores los enruten.
+SELECT id, name, COALESCE(dwell_seconds, 0)::int as dwell_seconds,
+       min_fixes, min_duration_seconds, exit_buffer_meters,
+       (CASE shape
+            WHEN 'circle' THEN ST_DWithin(center, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography, radius_meters)
+            WHEN 'corridor' THEN ST_DWithin(path, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography, width_meters / 2)
+            ELSE ST_Contains(area, ST_SetSRID(ST_MakePoint($1, $2), 4326))
+        END)::bool as inside,
+       (CASE shape
+            WHEN 'circle' THEN abs(ST_Distance(center, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography) - radius_meters)
+            WHEN 'corridor' THEN abs(ST_Distance(path, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography) - width_meters / 2)
+            ELSE ST_Distance(ST_Boundary(area)::geography, ST_SetSRID(ST_MakePoint($1, $2), 4326)::geography)
+        END)::float8 as boundary_distance_meters,
+       (NOT geofence_active_at(schedule, $4::timestamptz))::bool as off_schedule,
+       COALESCE(speed_limit_kmh, 0)::float8 as speed_limit_kmh,
+       COALESCE(tags, '{}')::text[] as tags
 FROM geofences
-WHERE ST_Contains(area, ST_SetSRID(ST_MakePoint($1, $2), 4326));
+WHERE deleted_at IS NULL
+  AND geofence_assigned_to(id, $5::text)
+  AND ((ST_Intersects(area, ST_SetSRID(ST_MakePoint($1, $2), 4326))
+            AND geofence_active_at(schedule, $4::timestamptz))
+       OR id = ANY($3::uuid[]));
+
+
+-- name: CheckGeofenceGeometry :one
+-- Revisa un Polygon/MultiPolygon antes de guardarlo: validez, motivo y punto
+-- del problema (ST_IsValidDetail), y vértices y área de lo que se guardaría.
+-- Con repair, una geometría inválida pasa por ST_MakeValid y se conservan
+-- solo sus partes poligonales.
+WITH input AS (
+    SELECT ST_GeomFromGeoJSON(@geojson::text) AS geom
+), detail AS (
+    SELECT geom, ST_IsValidDetail(geom) AS d FROM input
+), checked AS (
+    SELECT d,
+           CASE WHEN @repair::bool AND NOT (d).valid
+                    THEN ST_CollectionExtract(ST_MakeValid(geom), 3)
+                ELSE geom
+               END AS geom
+    FROM detail
+)
+SELECT (d).valid::bool AS valid,
+       COALESCE((d).reason, '')::text AS reason,
+       ((d).location IS NOT NULL)::bool AS has_location,
+       COALESCE(ST_Y((d).location), 0)::float8 AS location_latitude,
+       COALESCE(ST_X((d).location), 0)::float8 AS location_longitude,
+       (NOT (d).valid AND @repair::bool AND ST_IsValid(geom) AND NOT ST_IsEmpty(geom))::bool AS repaired,
+       ST_AsGeoJSON(geom)::text AS geojson,
+       ST_NPoints(geom)::int AS vertices,
+       COALESCE(ST_Area(geom::geography), 0)::float8 AS area_sq_meters
+FROM checked;
 
+-- name: CheckCircleGeometry :one
+-- Vértices y área del buffer que se guardaría para un círculo, para aplicarle
+-- los mismos límites que a un polígono.
+SELECT ST_NPoints(area)::int AS vertices,
+       COALESCE(ST_Area(area::geography), 0)::float8 AS area_sq_meters
+FROM (SELECT geofence_buffer(ST_SetSRID(ST_MakePoint(@lng::float8, @lat::float8), 4326)::geography,
+                             @radius_meters::float8) AS area) b;
+
+-- name: CheckCorridorGeometry :one
+-- Revisa la línea central de un corredor (que no se cruce consigo misma) y
+-- devuelve vértices y área del buffer que se guardaría.
+WITH input AS (
+    SELECT ST_GeomFromGeoJSON(@geojson::text) AS path
+)
+SELECT ST_IsSimple(path)::bool AS simple,
+       ST_NPoints(area)::int AS vertices,
+       COALESCE(ST_Area(area::geography), 0)::float8 AS area_sq_meters
+FROM (SELECT path, geofence_buffer(path::geography, @width_meters::float8 / 2) AS area FROM input) b;
 
 -- name: CreateGeofence :one
-INSERT INTO geofences (name, area)
-VALUES ($1, ST_GeomFromGeoJSON($2)) -- <-- Recibe un string GeoJSON
+-- updated_by (como en el resto de las escrituras) es quién hizo el cambio y
+-- queda en la versión que registra el trigger.
+INSERT INTO geofences (name, area, dwell_seconds, min_fixes, min_duration_seconds, exit_buffer_meters, speed_limit_kmh, updated_by,
+                       description, color, category, tags, properties)
+VALUES ($1, ST_GeomFromGeoJSON($2), $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) -- <-- Recibe un string GeoJSON
+    RETURNING id, name;
+
+-- name: CreateCircleGeofence :one
+INSERT INTO geofences (
+    name, shape, center, radius_meters, area, dwell_seconds, min_fixes, min_duration_seconds, exit_buffer_meters,
+    speed_limit_kmh, updated_by, description, color, category, tags, properties
+) VALUES (
+             @name, 'circle',
+             ST_SetSRID(ST_MakePoint(@lng::float8, @lat::float8), 4326)::geography,
+             @radius_meters::float8,
+             geofence_buffer(ST_SetSRID(ST_MakePoint(@lng::float8, @lat::float8), 4326)::geography, @radius_meters::float8),
+             sqlc.narg(dwell_seconds), @min_fixes, @min_duration_seconds, @exit_buffer_meters,
+             sqlc.narg(speed_limit_kmh), sqlc.narg(updated_by),
+             sqlc.narg(description), sqlc.narg(color), sqlc.narg(category), @tags::text[], @properties::jsonb
+         )
     RETURNING id, name;
 
--- name: DeleteGeofence :exec
-DELETE FROM geofences WHERE id = $1;
+-- name: CreateCorridorGeofence :one
+-- geojson es la línea central (LineString); width_meters es el ancho total.
+INSERT INTO geofences (
+    name, shape, path, width_meters, area, dwell_seconds, min_fixes, min_duration_seconds, exit_buffer_meters,
+    speed_limit_kmh, updated_by, description, color, category, tags, properties
+) VALUES (
+             @name, 'corridor',
+             ST_GeomFromGeoJSON(@geojson::text)::geography,
+             @width_meters::float8,
+             geofence_buffer(ST_GeomFromGeoJSON(@geojson::text)::geography, @width_meters::float8 / 2),
+             sqlc.narg(dwell_seconds), @min_fixes, @min_duration_seconds, @exit_buffer_meters,
+             sqlc.narg(speed_limit_kmh), sqlc.narg(updated_by),
+             sqlc.narg(description), sqlc.narg(color), sqlc.narg(category), @tags::text[], @properties::jsonb
+         )
+    RETURNING id, name;
+
+-- name: DeleteGeofence :execrows
+-- Borrado lógico: la zona deja de evaluarse pero sus eventos y versiones se
+-- conservan y se puede restaurar.
+UPDATE geofences
+SET deleted_at = NOW(), updated_by = sqlc.narg(updated_by)
+WHERE id = @id AND deleted_at IS NULL;
+
+-- name: SetGeofenceSchedule :execrows
+-- schedule NULL quita el horario (la zona queda siempre activa).
+UPDATE geofences
+SET schedule = (sqlc.narg(schedule)::text)::jsonb, updated_by = sqlc.narg(updated_by)
+WHERE id = @id AND deleted_at IS NULL;
+
+-- name: TimezoneExists :one
+-- geofence_active_at usa AT TIME ZONE: un nombre que Postgres no conoce
+-- rompería cada consulta que evalúe la zona.
+SELECT EXISTS (SELECT 1 FROM pg_timezone_names WHERE name = @name);
+
+-- name: ListScheduledGeofences :many
+-- Zonas con horario, si están activas en at y su bbox para buscar a los
+-- dispositivos que quedan adentro.
+SELECT id, name,
+       geofence_active_at(schedule, @at::timestamptz)::bool AS active,
+       ST_XMin(area)::float8 AS min_longitude,
+       ST_YMin(area)::float8 AS min_latitude,
+       ST_XMax(area)::float8 AS max_longitude,
+       ST_YMax(area)::float8 AS max_latitude
+FROM geofences
+WHERE schedule IS NOT NULL AND deleted_at IS NULL;
 
 -- name: UpdateGeofence :one
+-- shape NULL conserva la geometría actual; si no, la reemplaza con geojson
+-- (polygon/corridor), lng/lat/radius_meters (circle) o width_meters
+-- (corridor). dwell_seconds NULL conserva el umbral actual; 0 lo desactiva.
+-- Los parámetros de histéresis NULL también conservan el valor actual.
+-- speed_limit_kmh sigue la regla de dwell_seconds: 0 vuelve al límite global.
+-- Los metadatos NULL también se conservan; description, color y category
+-- vacíos los borran.
 UPDATE geofences
 SET
-    name = $2,
-    area = CASE
-               WHEN length($3::text) > 0 THEN ST_GeomFromGeoJSON($3)
+    name = @name,
+    shape = COALESCE(sqlc.narg(shape)::text, shape),
+    area = CASE sqlc.narg(shape)::text
+               WHEN 'polygon' THEN ST_GeomFromGeoJSON(@geojson::text)
+               WHEN 'circle' THEN geofence_buffer(ST_SetSRID(ST_MakePoint(@lng::float8, @lat::float8), 4326)::geography, @radius_meters::float8)
+               WHEN 'corridor' THEN geofence_buffer(ST_GeomFromGeoJSON(@geojson::text)::geography, @width_meters::float8 / 2)
                ELSE area
-        END
-WHERE id = $1
-    RETURNING id, name, ST_AsGeoJSON(area)::text as geojson;
+        END,
+    center = CASE
+               WHEN sqlc.narg(shape)::text IS NULL THEN center
+               WHEN sqlc.narg(shape)::text = 'circle' THEN ST_SetSRID(ST_MakePoint(@lng::float8, @lat::float8), 4326)::geography
+        END,
+    radius_meters = CASE
+               WHEN sqlc.narg(shape)::text IS NULL THEN radius_meters
+               WHEN sqlc.narg(shape)::text = 'circle' THEN @radius_meters::float8
+        END,
+    path = CASE
+               WHEN sqlc.narg(shape)::text IS NULL THEN path
+               WHEN sqlc.narg(shape)::text = 'corridor' THEN ST_GeomFromGeoJSON(@geojson::text)::geography
+        END,
+    width_meters = CASE
+               WHEN sqlc.narg(shape)::text IS NULL THEN width_meters
+               WHEN sqlc.narg(shape)::text = 'corridor' THEN @width_meters::float8
+        END,
+    dwell_seconds = CASE
+               WHEN sqlc.narg(dwell_seconds)::int IS NULL THEN dwell_seconds
+               ELSE NULLIF(sqlc.narg(dwell_seconds)::int, 0)
+        END,
+    min_fixes = COALESCE(sqlc.narg(min_fixes)::int, min_fixes),
+    min_duration_seconds = COALESCE(sqlc.narg(min_duration_seconds)::int, min_duration_seconds),
+    exit_buffer_meters = COALESCE(sqlc.narg(exit_buffer_meters)::float8, exit_buffer_meters),
+    speed_limit_kmh = CASE
+               WHEN sqlc.narg(speed_limit_kmh)::float8 IS NULL THEN speed_limit_kmh
+               ELSE NULLIF(sqlc.narg(speed_limit_kmh)::float8, 0)
+        END,
+    description = CASE
+               WHEN sqlc.narg(description)::text IS NULL THEN description
+               ELSE NULLIF(sqlc.narg(description)::text, '')
+        END,
+    color = CASE
+               WHEN sqlc.narg(color)::text IS NULL THEN color
+               ELSE NULLIF(sqlc.narg(color)::text, '')
+        END,
+    category = CASE
+               WHEN sqlc.narg(category)::text IS NULL THEN category
+               ELSE NULLIF(sqlc.narg(category)::text, '')
+        END,
+    tags = COALESCE(sqlc.narg(tags)::text[], tags),
+    properties = COALESCE((sqlc.narg(properties)::text)::jsonb, properties),
+    updated_by = sqlc.narg(updated_by)
+WHERE id = @id AND deleted_at IS NULL
+    RETURNING id, name, ST_AsGeoJSON(area)::text as geojson, COALESCE(dwell_seconds, 0)::int as dwell_seconds,
+              min_fixes, min_duration_seconds, exit_buffer_meters,
+              shape,
+              COALESCE(ST_Y(center::geometry), 0)::float8 as center_latitude,
+              COALESCE(ST_X(center::geometry), 0)::float8 as center_longitude,
+              COALESCE(radius_meters, 0)::float8 as radius_meters,
+              COALESCE(ST_AsGeoJSON(path), '')::text as path_geojson,
+              COALESCE(width_meters, 0)::float8 as width_meters,
+              COALESCE(speed_limit_kmh, 0)::float8 as speed_limit_kmh,
+              COALESCE(description, '')::text as description,
+              COALESCE(color, '')::text as color,
+              COALESCE(category, '')::text as category,
+              COALESCE(tags, '{}')::text[] as tags,
+              COALESCE(properties, '{}')::jsonb as properties;
 
 -- name: LogGeofenceEvent :exec
-INSERT INTO geofence_events (geofence_id, device_id, event_type)
-VALUES ($1, $2, $3);
\ No newline at end of file
+INSERT INTO geofence_events (
+    geofence_id, device_id, event_type, timestamp, duration_seconds, decision, accuracy, boundary_distance_meters,
+    start_speed_kmh, peak_speed_kmh, end_speed_kmh
+) VALUES (
+             $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+         );
+
+-- name: GetDeviceIDByIMEI :one
+SELECT device_id FROM device_imeis WHERE imei = $1;
+
+-- name: ListDeviceIMEIs :many
+SELECT imei, device_id, created_at FROM device_imeis
+WHERE sqlc.narg(device_id)::text IS NULL OR device_id = sqlc.narg(device_id)
+ORDER BY imei;
+
+-- name: UpsertDeviceIMEI :one
+-- Reasigna el IMEI si ya estaba registrado; created_at conserva el alta.
+INSERT INTO device_imeis (imei, device_id) VALUES (@imei, @device_id)
+ON CONFLICT (imei) DO UPDATE SET device_id = EXCLUDED.device_id
+RETURNING imei, device_id, created_at;
+
+-- name: DeleteDeviceIMEI :execrows
+DELETE FROM device_imeis WHERE imei = @imei;
+
+-- name: CreateDeviceGroup :one
+-- Sin fila si ya existe un grupo con ese nombre.
+INSERT INTO device_groups (name) VALUES (@name)
+ON CONFLICT (name) DO NOTHING
+RETURNING id, name, created_at;
+
+-- name: GetDeviceGroup :one
+SELECT id, name, created_at FROM device_groups WHERE id = $1;
+
+-- name: ListDeviceGroups :many
+SELECT g.id, g.name, g.created_at, COUNT(m.device_id)::int AS devices
+FROM device_groups g
+         LEFT JOIN device_group_members m ON m.group_id = g.id
+GROUP BY g.id
+ORDER BY g.name;
+
+-- name: RenameDeviceGroup :one
+-- Sin fila si el grupo no existe o el nombre ya lo usa otro.
+UPDATE device_groups
+SET name = @name
+WHERE id = @id
+  AND NOT EXISTS (SELECT 1 FROM device_groups o WHERE o.name = @name AND o.id <> @id)
+RETURNING id, name, created_at;
+
+-- name: DeleteDeviceGroup :execrows
+-- No borra grupos asignados a geocercas: esas zonas quedarían aplicando a
+-- todos los dispositivos.
+DELETE FROM device_groups
+WHERE id = $1
+  AND NOT EXISTS (SELECT 1 FROM geofence_group_assignments a WHERE a.group_id = $1);
+
+-- name: ListDeviceGroupMembers :many
+SELECT device_id FROM device_group_members WHERE group_id = $1 ORDER BY device_id;
+
+-- name: AddDeviceGroupMember :execrows
+-- Idempotente; 0 filas solo si el grupo no existe.
+INSERT INTO device_group_members (group_id, device_id)
+SELECT id, @device_id::text FROM device_groups WHERE id = @group_id
+ON CONFLICT (group_id, device_id) DO UPDATE SET device_id = EXCLUDED.device_id;
+
+-- name: RemoveDeviceGroupMember :execrows
+DELETE FROM device_group_members WHERE group_id = @group_id AND device_id = @device_id;
+
+-- name: ListGeofenceDeviceAssignments :many
+SELECT device_id FROM geofence_device_assignments WHERE geofence_id = $1 ORDER BY device_id;
+
+-- name: ListGeofenceGroupAssignments :many
+SELECT g.id, g.name
+FROM geofence_group_assignments a
+         JOIN device_groups g ON g.id = a.group_id
+WHERE a.geofence_id = $1
+ORDER BY g.name;
+
+-- name: AssignGeofenceToDevice :execrows
+-- Idempotente; 0 filas solo si la zona no existe.
+INSERT INTO geofence_device_assignments (geofence_id, device_id)
+SELECT id, @device_id::text FROM geofences WHERE id = @geofence_id AND deleted_at IS NULL
+ON CONFLICT (geofence_id, device_id) DO UPDATE SET device_id = EXCLUDED.device_id;
+
+-- name: AssignGeofenceToGroup :execrows
+-- Idempotente; 0 filas si la zona o el grupo no existen.
+INSERT INTO geofence_group_assignments (geofence_id, group_id)
+SELECT z.id, g.id
+FROM geofences z, device_groups g
+WHERE z.id = @geofence_id AND z.deleted_at IS NULL AND g.id = @group_id
+ON CONFLICT (geofence_id, group_id) DO UPDATE SET group_id = EXCLUDED.group_id;
+
+-- name: UnassignGeofenceFromDevice :execrows
+DELETE FROM geofence_device_assignments WHERE geofence_id = @geofence_id AND device_id = @device_id;
+
+-- name: UnassignGeofenceFromGroup :execrows
+DELETE FROM geofence_group_assignments WHERE geofence_id = @geofence_id AND group_id = @group_id;
+
+-- name: ListGeofenceVersions :many
+-- Historial de la zona, de la más nueva a la más vieja, con la geometría
+-- anterior a cada cambio (vacía en el alta).
+SELECT version, action, changed_by, changed_at, name, shape,
+       ST_AsGeoJSON(area)::text AS geojson,
+       COALESCE(ST_AsGeoJSON(lag(area) OVER (ORDER BY version)), '')::text AS previous_geojson
+FROM geofence_versions
+WHERE geofence_id = @geofence_id
+ORDER BY version DESC;
+
+-- name: RestoreGeofenceVersion :one
+-- Vuelve la zona (aunque esté borrada) al estado de una versión; el trigger
+-- la registra como una versión nueva.
+UPDATE geofences g
+SET name = v.name,
+    area = v.area,
+    shape = v.shape,
+    center = v.center,
+    radius_meters = v.radius_meters,
+    path = v.path,
+    width_meters = v.width_meters,
+    dwell_seconds = v.dwell_seconds,
+    min_fixes = v.min_fixes,
+    min_duration_seconds = v.min_duration_seconds,
+    exit_buffer_meters = v.exit_buffer_meters,
+    schedule = v.schedule,
+    speed_limit_kmh = v.speed_limit_kmh,
+    description = v.description,
+    color = v.color,
+    category = v.category,
+    tags = v.tags,
+    properties = v.properties,
+    deleted_at = NULL,
+    updated_by = sqlc.narg(updated_by)
+FROM geofence_versions v
+WHERE v.geofence_id = @geofence_id AND v.version = @version AND g.id = v.geofence_id
+    RETURNING g.id, g.name;
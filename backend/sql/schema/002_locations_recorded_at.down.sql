@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_locations_device_recorded;
+ALTER TABLE locations DROP COLUMN IF EXISTS recorded_at;
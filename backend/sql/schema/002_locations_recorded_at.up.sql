@@ -0,0 +1,12 @@
+-- Hora en la que el dispositivo tomó el fix (puede llegar con retraso).
+-- created_at queda como hora de recepción en el servidor.
+ALTER TABLE locations ADD COLUMN recorded_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE locations SET recorded_at = COALESCE(created_at, NOW());
+UPDATE locations SET created_at = recorded_at WHERE created_at IS NULL;
+
+ALTER TABLE locations
+    ALTER COLUMN recorded_at SET NOT NULL,
+    ALTER COLUMN recorded_at SET DEFAULT NOW();
+
+CREATE INDEX idx_locations_device_recorded ON locations (device_id, recorded_at DESC);
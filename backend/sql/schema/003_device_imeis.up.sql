@@ -0,0 +1,8 @@
+-- Mapeo de terminales GT06 (identificados por IMEI) a device_id.
+CREATE TABLE device_imeis (
+    imei VARCHAR(20) PRIMARY KEY,
+    device_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_device_imeis_device ON device_imeis(device_id);
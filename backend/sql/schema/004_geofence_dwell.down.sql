@@ -0,0 +1,4 @@
+DELETE FROM geofence_events WHERE event_type = 'DWELL';
+ALTER TABLE geofence_events DROP CONSTRAINT IF EXISTS geofence_events_event_type_check;
+ALTER TABLE geofence_events DROP COLUMN IF EXISTS duration_seconds;
+ALTER TABLE geofences DROP COLUMN IF EXISTS dwell_seconds;
@@ -0,0 +1,10 @@
+-- Umbral de permanencia por geocerca: tras dwell_seconds dentro se emite un
+-- evento DWELL. NULL desactiva el aviso.
+ALTER TABLE geofences ADD COLUMN dwell_seconds INTEGER CHECK (dwell_seconds > 0);
+
+-- Tiempo total dentro de la zona (en EXIT) o transcurrido al emitir DWELL.
+ALTER TABLE geofence_events ADD COLUMN duration_seconds INTEGER;
+
+ALTER TABLE geofence_events
+    ADD CONSTRAINT geofence_events_event_type_check
+        CHECK (event_type IN ('ENTER', 'EXIT', 'DWELL'));
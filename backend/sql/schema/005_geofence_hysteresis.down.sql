@@ -0,0 +1,4 @@
+ALTER TABLE geofences
+    DROP COLUMN IF EXISTS exit_buffer_meters,
+    DROP COLUMN IF EXISTS min_duration_seconds,
+    DROP COLUMN IF EXISTS min_fixes;
@@ -0,0 +1,7 @@
+-- Histéresis por geocerca para filtrar el rebote del GPS en los bordes:
+-- una transición cuenta tras min_fixes fixes consecutivos que además cubran
+-- min_duration_seconds. exit_buffer_meters extiende la zona solo para salir.
+ALTER TABLE geofences
+    ADD COLUMN min_fixes INTEGER NOT NULL DEFAULT 1 CHECK (min_fixes >= 1),
+    ADD COLUMN min_duration_seconds INTEGER NOT NULL DEFAULT 0 CHECK (min_duration_seconds >= 0),
+    ADD COLUMN exit_buffer_meters DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (exit_buffer_meters >= 0);
@@ -0,0 +1,4 @@
+ALTER TABLE geofence_events
+    DROP COLUMN IF EXISTS boundary_distance_meters,
+    DROP COLUMN IF EXISTS accuracy,
+    DROP COLUMN IF EXISTS decision;
@@ -0,0 +1,6 @@
+-- Cómo se decidió cada transición: precisión del fix que la confirmó y su
+-- distancia al borde de la geocerca.
+ALTER TABLE geofence_events
+    ADD COLUMN decision VARCHAR(20),
+    ADD COLUMN accuracy DOUBLE PRECISION,
+    ADD COLUMN boundary_distance_meters DOUBLE PRECISION;
@@ -0,0 +1,9 @@
+DELETE FROM geofences WHERE shape <> 'polygon';
+DROP FUNCTION IF EXISTS geofence_buffer(GEOGRAPHY, DOUBLE PRECISION);
+ALTER TABLE geofences DROP CONSTRAINT IF EXISTS geofences_shape_check;
+ALTER TABLE geofences
+    DROP COLUMN IF EXISTS width_meters,
+    DROP COLUMN IF EXISTS path,
+    DROP COLUMN IF EXISTS radius_meters,
+    DROP COLUMN IF EXISTS center,
+    DROP COLUMN IF EXISTS shape;
@@ -0,0 +1,27 @@
+-- Geocercas circulares (centro + radio) y corredores (línea + ancho). Los
+-- parámetros se guardan en geography y la evaluación se hace sobre ellos;
+-- area queda como el polígono circunscrito, para dibujar y como prefiltro
+-- del índice espacial.
+ALTER TABLE geofences
+    ADD COLUMN shape VARCHAR(10) NOT NULL DEFAULT 'polygon',
+    ADD COLUMN center GEOGRAPHY(Point, 4326),
+    ADD COLUMN radius_meters DOUBLE PRECISION,
+    ADD COLUMN path GEOGRAPHY(LineString, 4326),
+    ADD COLUMN width_meters DOUBLE PRECISION;
+
+ALTER TABLE geofences
+    ADD CONSTRAINT geofences_shape_check CHECK (
+        (shape = 'polygon') OR
+        (shape = 'circle' AND center IS NOT NULL AND radius_meters > 0) OR
+        (shape = 'corridor' AND path IS NOT NULL AND width_meters > 0)
+    );
+
+-- Buffer en metros que contiene por completo al buffer exacto: con
+-- quad_segs=8 cada lado del polígono es tangente al círculo si el radio se
+-- divide por cos(pi/32).
+CREATE OR REPLACE FUNCTION geofence_buffer(g GEOGRAPHY, meters DOUBLE PRECISION)
+    RETURNS GEOMETRY
+    LANGUAGE sql IMMUTABLE STRICT AS
+$$
+SELECT ST_Buffer(g, meters / cos(pi() / 32), 'quad_segs=8')::geometry
+$$;
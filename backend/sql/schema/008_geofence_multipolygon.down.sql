@@ -0,0 +1,4 @@
+DELETE FROM geofences WHERE GeometryType(area) = 'MULTIPOLYGON';
+ALTER TABLE geofences DROP CONSTRAINT IF EXISTS geofences_area_type_check;
+ALTER TABLE geofences
+    ALTER COLUMN area TYPE GEOMETRY(Polygon, 4326);
@@ -0,0 +1,9 @@
+-- Zonas de varias partes (MultiPolygon) y con huecos. La columna pasa a
+-- geometría genérica para no convertir los polígonos existentes: así
+-- ST_AsGeoJSON sigue devolviendo Polygon a los clientes que ya lo esperan.
+ALTER TABLE geofences
+    ALTER COLUMN area TYPE GEOMETRY(Geometry, 4326);
+
+ALTER TABLE geofences
+    ADD CONSTRAINT geofences_area_type_check
+        CHECK (GeometryType(area) IN ('POLYGON', 'MULTIPOLYGON'));
@@ -0,0 +1 @@
+ALTER TABLE geofences DROP CONSTRAINT IF EXISTS geofences_area_valid_check;
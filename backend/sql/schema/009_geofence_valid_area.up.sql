@@ -0,0 +1,9 @@
+-- Una geometría inválida (p. ej. un polígono que se auto-intersecta) da
+-- resultados incorrectos en ST_Contains. Se reparan las zonas existentes y
+-- desde ahora la base rechaza las inválidas.
+UPDATE geofences
+SET area = ST_CollectionExtract(ST_MakeValid(area), 3)
+WHERE NOT ST_IsValid(area);
+
+ALTER TABLE geofences
+    ADD CONSTRAINT geofences_area_valid_check CHECK (ST_IsValid(area));
@@ -0,0 +1,3 @@
+DROP FUNCTION IF EXISTS geofence_active_at(JSONB, TIMESTAMPTZ);
+ALTER TABLE geofences
+    DROP COLUMN IF EXISTS schedule;
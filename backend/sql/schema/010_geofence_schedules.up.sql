@@ -0,0 +1,36 @@
+-- Horario de activación de una geocerca:
+--   {"timezone": "America/Mexico_City",
+--    "windows": [{"days": [1,2,3,4,5], "start": "07:00", "end": "09:00"}],
+--    "exceptions": ["2026-12-25"]}
+-- days usa 0 = domingo (como EXTRACT(DOW)). Una ventana con end <= start
+-- cruza la medianoche. Las fechas de excepción son días locales sin
+-- actividad. NULL = siempre activa.
+ALTER TABLE geofences
+    ADD COLUMN schedule JSONB;
+
+CREATE OR REPLACE FUNCTION geofence_active_at(schedule JSONB, at TIMESTAMPTZ)
+    RETURNS BOOLEAN
+    LANGUAGE sql STABLE AS
+$$
+SELECT schedule IS NULL OR (
+    NOT COALESCE(schedule -> 'exceptions', '[]'::jsonb) ? to_char(l.local, 'YYYY-MM-DD')
+    AND EXISTS (
+        SELECT 1
+        FROM jsonb_array_elements(schedule -> 'windows') AS w,
+             jsonb_array_elements_text(w -> 'days') AS d(day),
+             LATERAL (SELECT (w ->> 'start')::time AS s, (w ->> 'end')::time AS e) AS b
+        WHERE (
+            -- Ventana que empieza hoy; si cruza la medianoche sigue abierta.
+            d.day::int = EXTRACT(DOW FROM l.local)
+            AND l.local::time >= b.s
+            AND (l.local::time < b.e OR b.e <= b.s)
+        ) OR (
+            -- Cola de una ventana que empezó ayer y cruza la medianoche.
+            b.e <= b.s
+            AND d.day::int = EXTRACT(DOW FROM l.local - INTERVAL '1 day')
+            AND l.local::time < b.e
+        )
+    )
+)
+FROM (SELECT at AT TIME ZONE (schedule ->> 'timezone') AS local) AS l
+$$;
@@ -0,0 +1,5 @@
+DROP FUNCTION IF EXISTS geofence_assigned_to(UUID, TEXT);
+DROP TABLE IF EXISTS geofence_group_assignments;
+DROP TABLE IF EXISTS geofence_device_assignments;
+DROP TABLE IF EXISTS device_group_members;
+DROP TABLE IF EXISTS device_groups;
@@ -0,0 +1,50 @@
+-- Grupos de dispositivos y asignación de geocercas. Una geocerca sin
+-- asignaciones aplica a todos los dispositivos (como antes); con
+-- asignaciones, solo a los asignados directamente o por alguno de sus grupos.
+CREATE TABLE device_groups (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE device_group_members (
+    group_id UUID NOT NULL REFERENCES device_groups(id) ON DELETE CASCADE,
+    device_id VARCHAR(255) NOT NULL,
+    PRIMARY KEY (group_id, device_id)
+);
+
+CREATE INDEX idx_device_group_members_device ON device_group_members(device_id);
+
+CREATE TABLE geofence_device_assignments (
+    geofence_id UUID NOT NULL REFERENCES geofences(id) ON DELETE CASCADE,
+    device_id VARCHAR(255) NOT NULL,
+    PRIMARY KEY (geofence_id, device_id)
+);
+
+-- RESTRICT: borrar un grupo asignado dejaría la zona sin asignaciones, es
+-- decir, aplicando a todos.
+CREATE TABLE geofence_group_assignments (
+    geofence_id UUID NOT NULL REFERENCES geofences(id) ON DELETE CASCADE,
+    group_id UUID NOT NULL REFERENCES device_groups(id) ON DELETE RESTRICT,
+    PRIMARY KEY (geofence_id, group_id)
+);
+
+CREATE INDEX idx_geofence_group_assignments_group ON geofence_group_assignments(group_id);
+
+CREATE OR REPLACE FUNCTION geofence_assigned_to(zone_id UUID, device TEXT)
+    RETURNS BOOLEAN
+    LANGUAGE sql STABLE AS
+$$
+SELECT (
+    NOT EXISTS (SELECT 1 FROM geofence_device_assignments WHERE geofence_id = zone_id)
+    AND NOT EXISTS (SELECT 1 FROM geofence_group_assignments WHERE geofence_id = zone_id)
+) OR EXISTS (
+    SELECT 1 FROM geofence_device_assignments
+    WHERE geofence_id = zone_id AND device_id = device
+) OR EXISTS (
+    SELECT 1
+    FROM geofence_group_assignments a
+    JOIN device_group_members m ON m.group_id = a.group_id
+    WHERE a.geofence_id = zone_id AND m.device_id = device
+)
+$$;
@@ -0,0 +1,10 @@
+DELETE FROM geofence_events WHERE event_type = 'OVERSPEED';
+ALTER TABLE geofence_events DROP CONSTRAINT IF EXISTS geofence_events_event_type_check;
+ALTER TABLE geofence_events
+    ADD CONSTRAINT geofence_events_event_type_check
+        CHECK (event_type IN ('ENTER', 'EXIT', 'DWELL'));
+ALTER TABLE geofence_events
+    DROP COLUMN IF EXISTS end_speed_kmh,
+    DROP COLUMN IF EXISTS peak_speed_kmh,
+    DROP COLUMN IF EXISTS start_speed_kmh;
+ALTER TABLE geofences DROP COLUMN IF EXISTS speed_limit_kmh;
@@ -0,0 +1,14 @@
+-- Límite de velocidad por geocerca (km/h). NULL usa el límite global.
+ALTER TABLE geofences ADD COLUMN speed_limit_kmh DOUBLE PRECISION CHECK (speed_limit_kmh > 0);
+
+-- Un OVERSPEED cubre un exceso completo dentro de la zona: velocidad al
+-- empezar, máxima y la del fix que lo cerró.
+ALTER TABLE geofence_events
+    ADD COLUMN start_speed_kmh DOUBLE PRECISION,
+    ADD COLUMN peak_speed_kmh DOUBLE PRECISION,
+    ADD COLUMN end_speed_kmh DOUBLE PRECISION;
+
+ALTER TABLE geofence_events DROP CONSTRAINT geofence_events_event_type_check;
+ALTER TABLE geofence_events
+    ADD CONSTRAINT geofence_events_event_type_check
+        CHECK (event_type IN ('ENTER', 'EXIT', 'DWELL', 'OVERSPEED'));
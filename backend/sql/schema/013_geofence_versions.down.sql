@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS geofences_versioned ON geofences;
+DROP FUNCTION IF EXISTS geofence_record_version();
+DROP TABLE IF EXISTS geofence_versions;
+DELETE FROM geofences WHERE deleted_at IS NOT NULL;
+ALTER TABLE geofences
+    DROP COLUMN IF EXISTS updated_by,
+    DROP COLUMN IF EXISTS deleted_at;
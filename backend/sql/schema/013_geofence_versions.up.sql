@@ -0,0 +1,76 @@
+-- Historial de geocercas: cada alta, cambio y borrado queda como una versión
+-- con la zona completa. Los borrados pasan a ser lógicos (deleted_at) para
+-- que los eventos sigan apuntando a la zona que los produjo.
+ALTER TABLE geofences
+    ADD COLUMN deleted_at TIMESTAMPTZ,
+    -- Quién hizo el último cambio; cada escritura lo fija.
+    ADD COLUMN updated_by VARCHAR(255);
+
+CREATE TABLE geofence_versions (
+    geofence_id UUID NOT NULL REFERENCES geofences(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    action VARCHAR(10) NOT NULL CHECK (action IN ('create', 'update', 'delete', 'restore')),
+    changed_by VARCHAR(255),
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    name VARCHAR(255) NOT NULL,
+    area GEOMETRY(Geometry, 4326) NOT NULL,
+    shape VARCHAR(10) NOT NULL,
+    center GEOGRAPHY(Point, 4326),
+    radius_meters DOUBLE PRECISION,
+    path GEOGRAPHY(LineString, 4326),
+    width_meters DOUBLE PRECISION,
+    dwell_seconds INTEGER,
+    min_fixes INTEGER NOT NULL,
+    min_duration_seconds INTEGER NOT NULL,
+    exit_buffer_meters DOUBLE PRECISION NOT NULL,
+    schedule JSONB,
+    speed_limit_kmh DOUBLE PRECISION,
+    PRIMARY KEY (geofence_id, version)
+);
+
+-- La fila de geofences está bloqueada mientras corre el trigger, así que
+-- max(version) + 1 no choca entre cambios concurrentes.
+CREATE OR REPLACE FUNCTION geofence_record_version()
+    RETURNS TRIGGER
+    LANGUAGE plpgsql AS
+$$
+DECLARE
+    change TEXT := 'update';
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        change := 'create';
+    ELSIF NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL THEN
+        change := 'delete';
+    ELSIF NEW.deleted_at IS NULL AND OLD.deleted_at IS NOT NULL THEN
+        change := 'restore';
+    END IF;
+
+    INSERT INTO geofence_versions (
+        geofence_id, version, action, changed_by,
+        name, area, shape, center, radius_meters, path, width_meters,
+        dwell_seconds, min_fixes, min_duration_seconds, exit_buffer_meters, schedule, speed_limit_kmh
+    ) VALUES (
+        NEW.id,
+        COALESCE((SELECT max(version) FROM geofence_versions WHERE geofence_id = NEW.id), 0) + 1,
+        change, NEW.updated_by,
+        NEW.name, NEW.area, NEW.shape, NEW.center, NEW.radius_meters, NEW.path, NEW.width_meters,
+        NEW.dwell_seconds, NEW.min_fixes, NEW.min_duration_seconds, NEW.exit_buffer_meters, NEW.schedule, NEW.speed_limit_kmh
+    );
+    RETURN NULL;
+END
+$$;
+
+-- Las zonas existentes arrancan con su alta como versión 1.
+INSERT INTO geofence_versions (
+    geofence_id, version, action, changed_at,
+    name, area, shape, center, radius_meters, path, width_meters,
+    dwell_seconds, min_fixes, min_duration_seconds, exit_buffer_meters, schedule, speed_limit_kmh
+)
+SELECT id, 1, 'create', created_at,
+       name, area, shape, center, radius_meters, path, width_meters,
+       dwell_seconds, min_fixes, min_duration_seconds, exit_buffer_meters, schedule, speed_limit_kmh
+FROM geofences;
+
+CREATE TRIGGER geofences_versioned
+    AFTER INSERT OR UPDATE ON geofences
+    FOR EACH ROW EXECUTE FUNCTION geofence_record_version();
@@ -0,0 +1,44 @@
+CREATE OR REPLACE FUNCTION geofence_record_version()
+    RETURNS TRIGGER
+    LANGUAGE plpgsql AS
+$$
+DECLARE
+    change TEXT := 'update';
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        change := 'create';
+    ELSIF NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL THEN
+        change := 'delete';
+    ELSIF NEW.deleted_at IS NULL AND OLD.deleted_at IS NOT NULL THEN
+        change := 'restore';
+    END IF;
+
+    INSERT INTO geofence_versions (
+        geofence_id, version, action, changed_by,
+        name, area, shape, center, radius_meters, path, width_meters,
+        dwell_seconds, min_fixes, min_duration_seconds, exit_buffer_meters, schedule, speed_limit_kmh
+    ) VALUES (
+        NEW.id,
+        COALESCE((SELECT max(version) FROM geofence_versions WHERE geofence_id = NEW.id), 0) + 1,
+        change, NEW.updated_by,
+        NEW.name, NEW.area, NEW.shape, NEW.center, NEW.radius_meters, NEW.path, NEW.width_meters,
+        NEW.dwell_seconds, NEW.min_fixes, NEW.min_duration_seconds, NEW.exit_buffer_meters, NEW.schedule, NEW.speed_limit_kmh
+    );
+    RETURN NULL;
+END
+$$;
+
+ALTER TABLE geofence_versions
+    DROP COLUMN IF EXISTS properties,
+    DROP COLUMN IF EXISTS tags,
+    DROP COLUMN IF EXISTS category,
+    DROP COLUMN IF EXISTS color,
+    DROP COLUMN IF EXISTS description;
+
+DROP INDEX IF EXISTS idx_geofences_tags;
+ALTER TABLE geofences
+    DROP COLUMN IF EXISTS properties,
+    DROP COLUMN IF EXISTS tags,
+    DROP COLUMN IF EXISTS category,
+    DROP COLUMN IF EXISTS color,
+    DROP COLUMN IF EXISTS description;
@@ -0,0 +1,51 @@
+-- Metadatos libres de las geocercas: descripción, color y categoría para la
+-- UI, etiquetas para filtrar y enrutar eventos, y propiedades JSON a gusto
+-- del cliente. tags y properties NULL se leen como vacíos.
+ALTER TABLE geofences
+    ADD COLUMN description TEXT,
+    ADD COLUMN color VARCHAR(7) CHECK (color ~ '^#[0-9A-Fa-f]{6}$'),
+    ADD COLUMN category VARCHAR(100),
+    ADD COLUMN tags TEXT[],
+    ADD COLUMN properties JSONB CHECK (jsonb_typeof(properties) = 'object');
+
+CREATE INDEX idx_geofences_tags ON geofences USING GIN (tags);
+
+-- Las versiones guardan también los metadatos para poder restaurarlos.
+ALTER TABLE geofence_versions
+    ADD COLUMN description TEXT,
+    ADD COLUMN color VARCHAR(7),
+    ADD COLUMN category VARCHAR(100),
+    ADD COLUMN tags TEXT[],
+    ADD COLUMN properties JSONB;
+
+CREATE OR REPLACE FUNCTION geofence_record_version()
+    RETURNS TRIGGER
+    LANGUAGE plpgsql AS
+$$
+DECLARE
+    change TEXT := 'update';
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        change := 'create';
+    ELSIF NEW.deleted_at IS NOT NULL AND OLD.deleted_at IS NULL THEN
+        change := 'delete';
+    ELSIF NEW.deleted_at IS NULL AND OLD.deleted_at IS NOT NULL THEN
+        change := 'restore';
+    END IF;
+
+    INSERT INTO geofence_versions (
+        geofence_id, version, action, changed_by,
+        name, area, shape, center, radius_meters, path, width_meters,
+        dwell_seconds, min_fixes, min_duration_seconds, exit_buffer_meters, schedule, speed_limit_kmh,
+        description, color, category, tags, properties
+    ) VALUES (
+        NEW.id,
+        COALESCE((SELECT max(version) FROM geofence_versions WHERE geofence_id = NEW.id), 0) + 1,
+        change, NEW.updated_by,
+        NEW.name, NEW.area, NEW.shape, NEW.center, NEW.radius_meters, NEW.path, NEW.width_meters,
+        NEW.dwell_seconds, NEW.min_fixes, NEW.min_duration_seconds, NEW.exit_buffer_meters, NEW.schedule, NEW.speed_limit_kmh,
+        NEW.description, NEW.color, NEW.category, NEW.tags, NEW.properties
+    );
+    RETURN NULL;
+END
+$$;
@@ -83,7 +83,7 @@ const MapClickHandler = ({ isDrawing, onAddPoint, onClearSelection }: any) => {
     return null;
 };
 
-interface Driver { id: string; device_id: string; latitude: number; longitude: number; heading: number; }
+interface Driver { device_id: string; latitude: number; longitude: number; heading: number; distance_meters?: number; speed?: number; last_seen?: string; status?: string; }
 interface Alert { id: number; title: string; body: string; time: string; color: string; bg: string; icon: string; }
 interface Toast { msg: string; type: 'success' | 'error'; }
 interface ModalConfig { show: boolean; type: 'create' | 'rename' | 'delete' | null; id?: string; initialValue?: string; }
@@ -112,7 +112,7 @@ function App() {
 
     const fetchDrivers = async () => {
         try {
-            const res = await axios.get(`${API_BASE_URL}/drivers/nearby`, { headers: { 'X-Geo-Key': VITE_API_KEY }, params: { lat: centerPos[0], lng: centerPos[1], radius: 50000 } });
+            const res = await axios.get(`${API_BASE_URL}/drivers/nearby`, { headers: { 'X-Geo-Key': VITE_API_KEY }, params: { lat: centerPos[0], lng: centerPos[1], radius: 50000, limit: 1000 } });
             setDrivers(res.data.data || []);
         } catch (error) { console.error(error); }
     };
@@ -129,10 +129,18 @@ function App() {
     const fetchGeofences = async () => {
         try {
             const res = await axios.get(`${API_BASE_URL}/geofences`, { headers: { 'X-Geo-Key': VITE_API_KEY } });
-            const parsed = res.data.map((z: any) => ({
-                ...z,
-                coordinates: JSON.parse(z.geojson).coordinates[0].map((c: number[]) => [c[1], c[0]])
-            }));
+            const toLatLng = (ring: number[][]) => ring.map((c: number[]) => [c[1], c[0]]);
+            const parsed = res.data.map((z: any) => {
+                const geo = JSON.parse(z.geojson);
+                // Polygon: [anillos]; MultiPolygon: [[anillos], ...]. Solo un polígono sin huecos se edita punto a punto.
+                const polygons = geo.type === 'MultiPolygon' ? geo.coordinates : [geo.coordinates];
+                return {
+                    ...z,
+                    positions: polygons.map((rings: number[][][]) => rings.map(toLatLng)),
+                    coordinates: toLatLng(polygons[0][0]),
+                    editable: polygons.length === 1 && polygons[0].length === 1
+                };
+            });
             setGeofences(parsed);
         } catch (e) { console.error(e); }
     };
@@ -200,7 +208,7 @@ function App() {
 
                 setModal({ show: false, type: null });
                 fetchGeofences();
-            } catch (e) { showToast("Error al guardar", "error"); }
+            } catch (e: any) { showToast(e.response?.data?.error || "Error al guardar", "error"); }
         }
     };
 
@@ -229,11 +237,24 @@ function App() {
                     setDrivers(prev => {
                         const exists = prev.find(d => d.device_id === msg.device_id);
                         if (exists) return prev.map(d => d.device_id === msg.device_id ? { ...d, latitude: msg.latitude, longitude: msg.longitude, heading: msg.heading } : d);
-                        else return [...prev, { id: "live-" + msg.device_id, device_id: msg.device_id, latitude: msg.latitude, longitude: msg.longitude, heading: msg.heading }];
+                        else return [...prev, { device_id: msg.device_id, latitude: msg.latitude, longitude: msg.longitude, heading: msg.heading }];
                     });
+                } else if (msg.type === "DRIVER_STATUS") {
+                    setDrivers(prev => prev.map(d => d.device_id === msg.device_id ? { ...d, status: msg.status } : d));
                 } else if (msg.type === "GEOFENCE_EVENT") {
                     const isEnter = msg.event === "ENTER";
-                    const newAlert: Alert = {
+                    const isDwell = msg.event === "DWELL";
+                    const isOverspeed = msg.event === "OVERSPEED";
+                    const minutes = Math.round((msg.duration_seconds || 0) / 60);
+                    const newAlert: Alert = isOverspeed ? {
+                        id: Date.now(), title: "EXCESO DE VELOCIDAD", body: `${msg.device_id} llegó a ${Math.round(msg.peak_speed_kmh)} km/h en ${msg.zone_name}`,
+                        time: new Date().toLocaleTimeString([], { hour: '2-digit', minute: '2-digit', second: '2-digit' }),
+                        color: "#FF6D00", icon: "🚨", bg: "rgba(255, 109, 0, 0.1)"
+                    } : isDwell ? {
+                        id: Date.now(), title: "PERMANENCIA", body: `${msg.device_id} lleva ${minutes} min en ${msg.zone_name}`,
+                        time: new Date().toLocaleTimeString([], { hour: '2-digit', minute: '2-digit', second: '2-digit' }),
+                        color: "#FFB300", icon: "⏱️", bg: "rgba(255, 179, 0, 0.1)"
+                    } : {
                         id: Date.now(), title: isEnter ? "ENTRADA" : "SALIDA", body: `${msg.device_id} en ${msg.zone_name}`,
                         time: new Date().toLocaleTimeString([], { hour: '2-digit', minute: '2-digit', second: '2-digit' }),
                         color: isEnter ? "#00E676" : "#FF5252", icon: isEnter ? "🛡️" : "⚠️", bg: isEnter ? "rgba(0, 230, 118, 0.1)" : "rgba(255, 82, 82, 0.1)"
@@ -274,14 +295,16 @@ function App() {
                 {geofences.map((geo) => {
                     if (geo.id === editingId) return null;
                     return (
-                        <Polygon key={geo.id} positions={geo.coordinates} pathOptions={{ color: '#FF5252', fillOpacity: 0.15, weight: 2 }}>
+                        <Polygon key={geo.id} positions={geo.positions} pathOptions={{ color: geo.color || '#FF5252', fillOpacity: 0.15, weight: 2 }}>
                             <Popup>
                                 <div style={{ textAlign: 'center', minWidth: '150px' }}>
                                     <h3 style={{ margin: '0 0 10px 0', fontSize: '15px', fontWeight: 'bold' }}>{geo.name}</h3>
                                     <div style={{ display: 'grid', gap: '8px', gridTemplateColumns: '1fr 1fr' }}>
-                                        <button onClick={(e) => { e.stopPropagation(); startEditGeometry(geo); }} style={{ background: '#f59e0b', border: 'none', borderRadius: '4px', padding: '6px', color: 'white', cursor: 'pointer', fontSize: '11px', gridColumn: '1 / -1' }}>
-                                            📐 Editar Forma
-                                        </button>
+                                        {geo.editable && (
+                                            <button onClick={(e) => { e.stopPropagation(); startEditGeometry(geo); }} style={{ background: '#f59e0b', border: 'none', borderRadius: '4px', padding: '6px', color: 'white', cursor: 'pointer', fontSize: '11px', gridColumn: '1 / -1' }}>
+                                                📐 Editar Forma
+                                            </button>
+                                        )}
                                         <button onClick={(e) => { e.stopPropagation(); openRenameModal(geo); }} style={{ background: '#3b82f6', border: 'none', borderRadius: '4px', padding: '6px', color: 'white', cursor: 'pointer', fontSize: '11px' }}>
                                             ✏️ Nombre
                                         </button>
@@ -298,7 +321,7 @@ function App() {
                 {selectedRoute.length > 0 && <Polyline positions={selectedRoute} pathOptions={{ color: '#F1C40F', weight: 5, opacity: 0.8, lineCap: 'round' }} />}
                 {drivers.map((driver) => (
                     <Marker key={driver.device_id} position={[driver.latitude, driver.longitude]} icon={createCarIcon(driver.heading || 0)} opacity={selectedId && selectedId !== driver.device_id ? 0.3 : 1} eventHandlers={{ click: (e) => { L.DomEvent.stopPropagation(e); fetchRoute(driver.device_id); } }}>
-                        <Popup>ID: {driver.device_id}</Popup>
+                        <Popup>ID: {driver.device_id}{driver.status ? ` · ${driver.status}` : ''}</Popup>
                     </Marker>
                 ))}
             </MapContainer>